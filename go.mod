@@ -1,8 +1,9 @@
 module github.com/stefaanc/golang-exec
 
-go 1.13
+go 1.16
 
 require (
+	github.com/creack/pty v1.1.18
 	github.com/mitchellh/go-homedir v1.1.0
 	golang.org/x/crypto v0.0.0-20191202143827-86a70503ff7e
 )
@@ -0,0 +1,67 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package runner
+
+import (
+    "fmt"
+    "net/url"
+    "strings"
+
+    "github.com/stefaanc/golang-exec/runner/dryrun"
+    "github.com/stefaanc/golang-exec/runner/internal/errs"
+    "github.com/stefaanc/golang-exec/runner/local"
+    "github.com/stefaanc/golang-exec/runner/ssh"
+)
+
+//------------------------------------------------------------------------------
+
+func ParseConnection(uri string) (interface{}, error) {
+    // returns a connection that can be used with New() and Run()
+    // - "local://" returns a *local.Connection
+    // - "dryrun://" returns a *dryrun.Connection
+    // - "ssh://<user>:<password>@<host>:<port>?<field>=<value>&..." returns a *ssh.Connection
+    // - for other registered types, returns a map[string]string with the "Type", "User", "Password", "Host" and "Port", and the query parameters
+    u, err := url.Parse(uri)
+    if err != nil {
+        return nil, errs.Wrap(errs.ErrConnection, fmt.Errorf("[golang-exec/runner/ParseConnection()] invalid 'uri' parameter: %w\n", err))
+    }
+
+    cType := strings.ToLower(u.Scheme)
+    switch cType {
+    case "local":
+        return local.ParseConnection(uri)
+    case "dryrun":
+        return dryrun.ParseConnection(uri)
+    case "ssh":
+        return ssh.ParseConnection(uri)
+    }
+
+    if _, ok := lookup(cType); !ok {
+        return nil, errs.Wrap(errs.ErrConnection, fmt.Errorf("[golang-exec/runner/ParseConnection()] invalid scheme in 'uri' parameter, registered types are %q\n", Types()))
+    }
+
+    c := map[string]string{ "Type": cType }
+    if u.User != nil {
+        c["User"] = u.User.Username()
+        if password, ok := u.User.Password(); ok {
+            c["Password"] = password
+        }
+    }
+    if u.Hostname() != "" {
+        c["Host"] = u.Hostname()
+    }
+    if u.Port() != "" {
+        c["Port"] = u.Port()
+    }
+    for key, values := range u.Query() {
+        c[key] = strings.Join(values, ",")
+    }
+
+    return c, nil
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,346 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package dryrun
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/stefaanc/golang-exec/runner/internal/decode"
+    "github.com/stefaanc/golang-exec/runner/internal/errs"
+    "github.com/stefaanc/golang-exec/script"
+)
+
+//------------------------------------------------------------------------------
+
+// a dry-run runner doesn't execute anything
+// it writes the command and the rendered script to stdout, and succeeds
+type Connection struct {
+    Type string   // must be "dryrun"
+}
+
+type Error struct {
+    script   *script.Script
+    command  string
+    exitCode int
+    err      error
+}
+
+type Runner struct {
+    script  *script.Script
+    command string
+    code    string
+    running bool
+
+    env      []string   // from the arguments, when using script.WithEnvArguments()
+    extraEnv []string
+    cleanEnv bool
+    dir      string
+    becomeMethod string
+    becomeUser   string
+    pty          string   // terminal type and size, "" when not using a pseudo-terminal
+
+    stdout     io.Writer
+    stderr     io.Writer
+    stdoutPipe *io.PipeWriter
+    stderrPipe *io.PipeWriter
+
+    done      chan struct{}   // closed when the output is written
+    closeOnce sync.Once
+
+    exitCode int
+}
+
+//------------------------------------------------------------------------------
+
+func (e *Error) Script()   *script.Script { return e.script }
+func (e *Error) Command()  string         { return e.command }
+func (e *Error) ExitCode() int            { return e.exitCode }
+func (e *Error) Error()    string         { return e.err.Error() }
+func (e *Error) Unwrap()   error          { return e.err }
+
+//------------------------------------------------------------------------------
+
+func ParseConnection(uri string) (*Connection, error) {
+    // parses "dryrun://"
+    c := new(Connection)
+    err := decode.DecodeURI(uri, c)
+    if err != nil {
+        return nil, fmt.Errorf("[golang-exec/runner/dryrun/ParseConnection()] invalid connection uri: %w\n", err)
+    }
+    if strings.ToLower(c.Type) != "dryrun" {
+        return nil, errs.Wrap(errs.ErrConnection, fmt.Errorf("[golang-exec/runner/dryrun/ParseConnection()] invalid connection uri, scheme must be \"dryrun\"\n"))
+    }
+
+    return c, nil
+}
+
+func (c Connection) String() string {
+    return "dryrun://"
+}
+
+//------------------------------------------------------------------------------
+
+func New(connection interface{}, s *script.Script, arguments interface{}) (*Runner, error) {
+    if connection != nil {
+        err := decode.Decode(connection, new(Connection))
+        if err != nil {
+            return nil, &Error{
+                script: s,
+                exitCode: -1,
+                err: fmt.Errorf("[golang-exec/runner/dryrun/New()] invalid 'connection' parameter: %w\n", err),
+            }
+        }
+    }
+
+    if s.Error != nil {
+        return nil, &Error{
+            script: s,
+            exitCode: -1,
+            err: fmt.Errorf("[golang-exec/runner/dryrun/New()] script failed to parse: %w\n", errs.Wrap(errs.ErrParse, s.Error)),
+        }
+    }
+
+    r := new(Runner)
+    r.script = s
+    r.command = s.Command()
+
+    code, err := s.Render(arguments)
+    if err != nil {
+        return nil, &Error{
+            script: s,
+            exitCode: -1,
+            err: fmt.Errorf("[golang-exec/runner/dryrun/New()] cannot render script: %w\n", errs.Wrap(errs.ErrRender, err)),
+        }
+    }
+    r.code = code
+
+    r.env, err = s.Environment(arguments)
+    if err != nil {
+        return nil, &Error{
+            script: s,
+            exitCode: -1,
+            err: fmt.Errorf("[golang-exec/runner/dryrun/New()] cannot create environment: %w\n", errs.Wrap(errs.ErrRender, err)),
+        }
+    }
+
+    return r, nil
+}
+
+//------------------------------------------------------------------------------
+
+func (r *Runner) SetStdoutWriter(stdout io.Writer) {
+    r.stdout = stdout
+}
+
+func (r *Runner) SetStderrWriter(stderr io.Writer) {
+    r.stderr = stderr
+}
+
+func (r *Runner) SetTimeout(timeout time.Duration) {
+    // nothing is executed, so nothing times out
+}
+
+func (r *Runner) SetIdleTimeout(timeout time.Duration) {
+    // nothing is executed, so nothing times out
+}
+
+func (r *Runner) SetDir(dir string) {
+    r.dir = dir
+}
+
+func (r *Runner) SetEnv(env []string) {
+    r.extraEnv = env
+}
+
+func (r *Runner) SetCleanEnv(clean bool) {
+    r.cleanEnv = clean
+}
+
+func (r *Runner) SetBecome(method string, user string, password string) {
+    // the password is never written to the output
+    r.becomeMethod = method
+    if r.becomeMethod == "" {
+        r.becomeMethod = "sudo"
+    }
+    r.becomeUser = user
+    if r.becomeUser == "" {
+        r.becomeUser = "root"
+    }
+}
+
+func (r *Runner) SetPty(term string, columns int, rows int) {
+    if term == "" {
+        term = "xterm"
+    }
+    if columns <= 0 {
+        columns = 80
+    }
+    if rows <= 0 {
+        rows = 24
+    }
+    r.pty = fmt.Sprintf("%s %dx%d", term, columns, rows)
+}
+
+func (r *Runner) StdoutPipe() (io.Reader, error) {
+    reader, writer := io.Pipe()
+    r.stdoutPipe = writer
+
+    return reader, nil
+}
+
+func (r *Runner) StderrPipe() (io.Reader, error) {
+    reader, writer := io.Pipe()
+    r.stderrPipe = writer
+
+    return reader, nil
+}
+
+func (r *Runner) Run() error {
+    return r.RunContext(context.Background())
+}
+
+func (r *Runner) RunContext(ctx context.Context) error {
+    err := r.StartContext(ctx)
+    if err != nil {
+        return err
+    }
+
+    return r.Wait()
+}
+
+func (r *Runner) Start() error {
+    return r.StartContext(context.Background())
+}
+
+func (r *Runner) StartContext(ctx context.Context) error {
+    if ctx.Err() != nil {
+        r.exitCode = -1
+        return &Error{
+            script: r.script,
+            command: r.command,
+            exitCode: r.exitCode,
+            err: fmt.Errorf("[golang-exec/runner/dryrun/Start()] runner cancelled: %w\n", errs.FromContext(ctx.Err())),
+        }
+    }
+
+    stdout := writer(r.stdout, r.stdoutPipe)
+
+    r.running = true
+    r.done = make(chan struct{})
+    go func() {
+        defer close(r.done)
+
+        _, _ = io.WriteString(stdout, r.output())
+        r.closePipes()
+    }()
+
+    return nil
+}
+
+func (r *Runner) Wait() error {
+    if r.done == nil {
+        r.exitCode = -1
+        return &Error{
+            script: r.script,
+            command: r.command,
+            exitCode: r.exitCode,
+            err: fmt.Errorf("[golang-exec/runner/dryrun/Wait()] runner not started\n"),
+        }
+    }
+
+    <-r.done
+    r.running = false
+
+    r.exitCode = 0
+    return nil
+}
+
+func (r *Runner) Close() error {
+    if r.running {
+        // unblocks writing output that isn't read
+        r.closePipes()
+    }
+
+    return nil
+}
+
+func (r *Runner) ExitCode() int {
+    return r.exitCode
+}
+
+func (r *Runner) Signal() string {
+    return ""
+}
+
+func (r *Runner) Command() string {
+    return r.command
+}
+
+//------------------------------------------------------------------------------
+
+func (r *Runner) output() string {
+    // returns the output of a dry-run: the command, the working directory, the become user, the terminal, the environment, and the rendered script that is sent to the command's stdin
+    var out strings.Builder
+    fmt.Fprintf(&out, "command: %s\n", r.command)
+    if r.dir != "" {
+        fmt.Fprintf(&out, "dir: %s\n", r.dir)
+    }
+    if r.becomeMethod != "" {
+        fmt.Fprintf(&out, "become: %s (%s)\n", r.becomeUser, r.becomeMethod)
+    }
+    if r.pty != "" {
+        fmt.Fprintf(&out, "pty: %s\n", r.pty)
+    }
+
+    env := append(append([]string{}, r.env...), r.extraEnv...)
+    if len(env) > 0 || r.cleanEnv {
+        if r.cleanEnv {
+            out.WriteString("env (clean):\n")
+        } else {
+            out.WriteString("env:\n")
+        }
+        for _, entry := range env {
+            fmt.Fprintf(&out, "    %q\n", entry)
+        }
+    }
+
+    out.WriteString("stdin:\n")
+    out.WriteString(r.code)
+    if r.code != "" && !strings.HasSuffix(r.code, "\n") {
+        out.WriteString("\n")
+    }
+    return out.String()
+}
+
+func writer(writer io.Writer, pipe *io.PipeWriter) io.Writer {
+    if pipe != nil {
+        return pipe
+    }
+    if writer == nil {
+        return ioutil.Discard
+    }
+    return writer
+}
+
+func (r *Runner) closePipes() {
+    r.closeOnce.Do(func() {
+        if r.stdoutPipe != nil {
+            _ = r.stdoutPipe.Close()
+        }
+        if r.stderrPipe != nil {
+            _ = r.stderrPipe.Close()
+        }
+    })
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,205 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package fake
+
+import (
+    "fmt"
+    "regexp"
+    "sync"
+    "time"
+
+    "github.com/stefaanc/golang-exec/runner"
+    "github.com/stefaanc/golang-exec/script"
+)
+
+//------------------------------------------------------------------------------
+
+// connection type registered by this package, importing the package makes it available to runner.New() and runner.Run()
+const Type = "fake"
+
+type Connection struct {
+    Type string   // must be "fake"
+    Host string   `exec:",required"`   // name of a host created with NewHost()
+}
+
+// the scripted behavior of a fake runner
+type Response struct {
+    Stdout     string
+    Stderr     string
+    ExitCode   int
+    Signal     string          // name of the signal that terminated the script, for instance "TERM", the exitcode defaults to -1
+    Delay      time.Duration   // time the script keeps running after writing its output, to test timeouts and cancellation
+
+    DialError  error           // returned by New(), matching runner.ErrDial
+    StartError error           // returned by Run() and Start(), matching runner.ErrStart
+}
+
+// a script that was rendered by a fake runner
+// the runner options are recorded when they are set, after the call is matched against the rules
+type Call struct {
+    Connection interface{}
+    Script     *script.Script
+    Arguments  interface{}
+    Command    string
+    Code       string     // rendered script
+    Env        []string   // environment of the script as "NAME=value", when using script.WithEnvArguments()
+
+    Dir        string     // working directory, when using runner.WithDir()
+    ExtraEnv   []string   // additional environment as "NAME=value", when using runner.WithEnv()
+    CleanEnv   bool       // when using runner.WithCleanEnv()
+    Become     *Become    // when using runner.WithBecome()
+    Pty        *Pty       // when using runner.WithPty()
+}
+
+// the options of runner.WithBecome()
+type Become struct {
+    Method   string
+    User     string
+    Password string
+}
+
+// the options of runner.WithPty()
+type Pty struct {
+    Term    string
+    Columns int
+    Rows    int
+}
+
+type Host struct {
+    name     string
+
+    mu       sync.Mutex
+    rules    []rule
+    fallback Response
+    calls    []Call
+}
+
+type rule struct {
+    match    func(Call) bool
+    response Response
+}
+
+var (
+    hostsMu sync.Mutex
+    hosts   = make(map[string]*Host)
+)
+
+//------------------------------------------------------------------------------
+
+func init() {
+    runner.Register(Type, func(connection interface{}, s *script.Script, arguments interface{}) (runner.Runner, error) {
+        r, err := New(connection, s, arguments)
+        if err != nil {
+            return nil, err
+        }
+        return r, nil
+    })
+}
+
+//------------------------------------------------------------------------------
+
+func NewHost(name string) *Host {
+    // creates a fake host, connections with 'Host' equal to 'name' use its responses
+    // panics when a host with the same name exists, use Close() when the host is no longer used
+    hostsMu.Lock()
+    defer hostsMu.Unlock()
+
+    if _, ok := hosts[name]; ok {
+        panic(fmt.Sprintf("[golang-exec/runner/fake/NewHost()] host %q already exists", name))
+    }
+
+    h := &Host{ name: name }
+    hosts[name] = h
+
+    return h
+}
+
+func (h *Host) Close() {
+    hostsMu.Lock()
+    defer hostsMu.Unlock()
+
+    if hosts[h.name] == h {
+        delete(hosts, h.name)
+    }
+}
+
+func (h *Host) Connection() *Connection {
+    return &Connection{ Type: Type, Host: h.name }
+}
+
+func (h *Host) OnScript(name string, response Response) {
+    // responds to scripts with 'Name' equal to 'name'
+    h.OnCall(func(call Call) bool { return call.Script.Name == name }, response)
+}
+
+func (h *Host) OnContent(pattern string, response Response) {
+    // responds to scripts with rendered code matching the regular expression 'pattern'
+    re := regexp.MustCompile(pattern)
+    h.OnCall(func(call Call) bool { return re.MatchString(call.Code) }, response)
+}
+
+func (h *Host) OnCall(match func(Call) bool, response Response) {
+    // responds to scripts for which 'match' returns true
+    // rules are tried in the order they are added, the first matching rule is used
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    h.rules = append(h.rules, rule{ match: match, response: response })
+}
+
+func (h *Host) Default(response Response) {
+    // responds to scripts that don't match any rule, by default with exitcode 0 and no output
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    h.fallback = response
+}
+
+func (h *Host) Calls() []Call {
+    // returns the scripts rendered by runners for this host, in the order they were rendered
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    calls := make([]Call, len(h.calls))
+    copy(calls, h.calls)
+    return calls
+}
+
+//------------------------------------------------------------------------------
+
+func lookupHost(name string) (*Host, bool) {
+    hostsMu.Lock()
+    defer hostsMu.Unlock()
+
+    h, ok := hosts[name]
+    return h, ok
+}
+
+func (h *Host) respond(call Call) (Response, int) {
+    // records the call, and returns the response and the index of the call
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    h.calls = append(h.calls, call)
+    index := len(h.calls) - 1
+    for _, rule := range h.rules {
+        if rule.match(call) {
+            return rule.response, index
+        }
+    }
+    return h.fallback, index
+}
+
+func (h *Host) record(index int, update func(*Call)) {
+    // updates a recorded call with a runner option
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    update(&h.calls[index])
+}
+
+//------------------------------------------------------------------------------
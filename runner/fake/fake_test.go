@@ -0,0 +1,279 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package fake_test
+
+import (
+    "bytes"
+    "errors"
+    "io/ioutil"
+    "strings"
+    "testing"
+    "testing/fstest"
+    "time"
+
+    "github.com/stefaanc/golang-exec/runner"
+    "github.com/stefaanc/golang-exec/runner/fake"
+    "github.com/stefaanc/golang-exec/script"
+)
+
+//------------------------------------------------------------------------------
+
+var deployScript = script.New("deploy", "bash", `deploy {{.Version}}`)
+var restartScript = script.New("restart", "bash", `systemctl restart {{.Service}}`)
+
+//------------------------------------------------------------------------------
+
+func TestRunFake(t *testing.T) {
+    h := fake.NewHost("TestRunFake")
+    defer h.Close()
+
+    h.OnScript("deploy", fake.Response{ Stdout: "deployed\n" })
+    h.OnContent(`restart nginx$`, fake.Response{ Stderr: "failed\n", ExitCode: 3 })
+
+    var stdout bytes.Buffer
+    err := runner.Run(h.Connection(), deployScript, struct{ Version string }{ "1.2.3" }, &stdout, nil)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if stdout.String() != "deployed\n" {
+        t.Errorf("stdout = %q, want %q", stdout.String(), "deployed\n")
+    }
+
+    result, err := runner.Output(map[string]string{ "Type": "fake", "Host": "TestRunFake" }, restartScript, struct{ Service string }{ "nginx" })
+    if !errors.Is(err, runner.ErrExit) {
+        t.Errorf("error %v does not match %v", err, runner.ErrExit)
+    }
+    if result.ExitCode != 3 || result.Stderr != "failed\n" {
+        t.Errorf("result = %+v, want exitcode 3 and stderr \"failed\\n\"", result)
+    }
+
+    // unmatched scripts use the default response
+    err = runner.Run(h.Connection(), restartScript, struct{ Service string }{ "sshd" }, nil, nil)
+    if err != nil {
+        t.Errorf("unexpected error: %v", err)
+    }
+
+    calls := h.Calls()
+    if len(calls) != 3 {
+        t.Fatalf("calls = %d, want 3", len(calls))
+    }
+    if calls[0].Script != deployScript || calls[0].Code != "deploy 1.2.3" || calls[0].Command != "bash -" {
+        t.Errorf("call = %+v, want rendered deploy script", calls[0])
+    }
+    if calls[2].Code != "systemctl restart sshd" {
+        t.Errorf("code = %q, want %q", calls[2].Code, "systemctl restart sshd")
+    }
+}
+
+func TestRunFakeErrors(t *testing.T) {
+    h := fake.NewHost("TestRunFakeErrors")
+    defer h.Close()
+
+    h.OnScript("deploy", fake.Response{ DialError: errors.New("connection refused") })
+    h.OnScript("restart", fake.Response{ StartError: errors.New("no such shell") })
+
+    _, err := runner.New(h.Connection(), deployScript, struct{ Version string }{ "1.2.3" })
+    if !errors.Is(err, runner.ErrDial) {
+        t.Errorf("error %v does not match %v", err, runner.ErrDial)
+    }
+
+    err = runner.Run(h.Connection(), restartScript, struct{ Service string }{ "nginx" }, nil, nil)
+    if !errors.Is(err, runner.ErrStart) {
+        t.Errorf("error %v does not match %v", err, runner.ErrStart)
+    }
+
+    _, err = runner.New(h.Connection(), restartScript, struct{ Other string }{})
+    if !errors.Is(err, runner.ErrRender) {
+        t.Errorf("error %v does not match %v", err, runner.ErrRender)
+    }
+
+    _, err = runner.New(&fake.Connection{ Type: "fake", Host: "unknown" }, restartScript, nil)
+    if !errors.Is(err, runner.ErrConnection) {
+        t.Errorf("error %v does not match %v", err, runner.ErrConnection)
+    }
+}
+
+func TestRunFakeTimeout(t *testing.T) {
+    h := fake.NewHost("TestRunFakeTimeout")
+    defer h.Close()
+
+    h.Default(fake.Response{ Stdout: "waiting\n", Delay: time.Minute })
+
+    result, err := runner.Output(h.Connection(), deployScript, struct{ Version string }{ "1.2.3" }, runner.WithTimeout(50 * time.Millisecond))
+    if !errors.Is(err, runner.ErrTimeout) {
+        t.Errorf("error %v does not match %v", err, runner.ErrTimeout)
+    }
+    if result.Stdout != "waiting\n" || result.ExitCode != -1 || result.Signal != "KILL" {
+        t.Errorf("result = %+v, want partial stdout, exitcode -1 and signal KILL", result)
+    }
+}
+
+func TestRunFakeFrontMatter(t *testing.T) {
+    h := fake.NewHost("TestRunFakeFrontMatter")
+    defer h.Close()
+
+    h.Default(fake.Response{ Delay: time.Minute })
+
+    s, err := script.NewFromFS(fstest.MapFS{
+        "deploy.sh": { Data: []byte("# ---\n# timeout: 50ms\n# params:\n#   Version: string, required\n# ---\ndeploy {{.Version}}") },
+    }, "deploy.sh")
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    // invalid arguments are not sent to the host
+    err = runner.Run(h.Connection(), s, struct{ Version *string }{}, nil, nil)
+    if !errors.Is(err, runner.ErrRender) || !strings.Contains(err.Error(), "missing required param \"Version\"") {
+        t.Errorf("error %v is not a missing param error", err)
+    }
+    if len(h.Calls()) != 0 {
+        t.Errorf("calls = %d, want 0", len(h.Calls()))
+    }
+
+    // the timeout of the script is used, unless overridden
+    err = runner.Run(h.Connection(), s, struct{ Version string }{ "1.2.3" }, nil, nil)
+    if !errors.Is(err, runner.ErrTimeout) {
+        t.Errorf("error %v does not match %v", err, runner.ErrTimeout)
+    }
+
+    h.Default(fake.Response{ Delay: 100 * time.Millisecond })
+    err = runner.Run(h.Connection(), s, struct{ Version string }{ "1.2.3" }, nil, nil, runner.WithTimeout(0))
+    if err != nil {
+        t.Errorf("unexpected error: %v", err)
+    }
+}
+
+func TestNewFakeArgumentType(t *testing.T) {
+    h := fake.NewHost("TestNewFakeArgumentType")
+    defer h.Close()
+
+    type deployArguments struct {
+        Version string
+    }
+
+    s := script.New("deploy", "bash", `deploy {{.Version}}`, script.WithArgumentType(deployArguments{}))
+    _, err := runner.New(h.Connection(), s, struct{ Version string }{ "1.2.3" })
+    if !errors.Is(err, runner.ErrRender) || !strings.Contains(err.Error(), "want fake_test.deployArguments") {
+        t.Errorf("error %v is not an argument type error", err)
+    }
+
+    s = script.New("deploy", "bash", `deploy {{.Versions}}`, script.WithArgumentType(deployArguments{}))
+    _, err = runner.New(h.Connection(), s, deployArguments{ "1.2.3" })
+    if !errors.Is(err, runner.ErrParse) || !strings.Contains(err.Error(), "can't evaluate field Versions") {
+        t.Errorf("error %v is not a field error", err)
+    }
+
+    if len(h.Calls()) != 0 {
+        t.Errorf("calls = %d, want 0", len(h.Calls()))
+    }
+}
+
+func TestStartWaitFake(t *testing.T) {
+    h := fake.NewHost("TestStartWaitFake")
+    defer h.Close()
+
+    h.Default(fake.Response{ Stdout: "line 1\nline 2\n", Signal: "TERM" })
+
+    r, err := runner.New(h.Connection(), deployScript, struct{ Version string }{ "1.2.3" })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    defer r.Close()
+
+    stdout, _ := r.StdoutPipe()
+    err = r.Start()
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    output, _ := ioutil.ReadAll(stdout)
+    if strings.Count(string(output), "line") != 2 {
+        t.Errorf("stdout = %q, want 2 lines", output)
+    }
+
+    err = r.Wait()
+    signal := r.(*fake.Runner).Signal()
+    if !errors.Is(err, runner.ErrExit) || r.ExitCode() != -1 || signal != "TERM" {
+        t.Errorf("error = %v, exitcode = %d, signal = %q, want ErrExit, -1, \"TERM\"", err, r.ExitCode(), signal)
+    }
+}
+
+func TestStartWaitFakeStderrFirst(t *testing.T) {
+    h := fake.NewHost("TestStartWaitFakeStderrFirst")
+    defer h.Close()
+
+    h.Default(fake.Response{ Stdout: "out\n", Stderr: "err\n" })
+
+    r, err := runner.New(h.Connection(), deployScript, struct{ Version string }{ "1.2.3" })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    defer r.Close()
+
+    stdout, _ := r.StdoutPipe()
+    stderr, _ := r.StderrPipe()
+    err = r.Start()
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    // reading stderr before stdout must not block on the unread stdout
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+
+        errput, _ := ioutil.ReadAll(stderr)
+        output, _ := ioutil.ReadAll(stdout)
+        if string(errput) != "err\n" || string(output) != "out\n" {
+            t.Errorf("stderr = %q, stdout = %q, want \"err\\n\", \"out\\n\"", errput, output)
+        }
+    }()
+
+    select {
+    case <-done:
+    case <-time.After(5 * time.Second):
+        t.Fatalf("reading stderr before stdout blocks")
+    }
+
+    err = r.Wait()
+    if err != nil {
+        t.Errorf("unexpected error: %v", err)
+    }
+}
+
+func TestRunFakeOptions(t *testing.T) {
+    h := fake.NewHost("TestRunFakeOptions")
+    defer h.Close()
+
+    err := runner.Run(h.Connection(), deployScript, struct{ Version string }{ "1.2.3" }, nil, nil,
+        runner.WithDir("/srv/app"),
+        runner.WithEnv("MODE=test"),
+        runner.WithCleanEnv(),
+        runner.WithBecome("sudo", "deploy", "secret"),
+        runner.WithPty("vt100", 120, 40),
+    )
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    calls := h.Calls()
+    if len(calls) != 1 {
+        t.Fatalf("calls = %d, want 1", len(calls))
+    }
+    call := calls[0]
+    if call.Dir != "/srv/app" || len(call.ExtraEnv) != 1 || call.ExtraEnv[0] != "MODE=test" || !call.CleanEnv {
+        t.Errorf("call = %+v, want dir, extra env and clean env", call)
+    }
+    if call.Become == nil || *call.Become != (fake.Become{ Method: "sudo", User: "deploy", Password: "secret" }) {
+        t.Errorf("become = %+v, want sudo as deploy", call.Become)
+    }
+    if call.Pty == nil || *call.Pty != (fake.Pty{ Term: "vt100", Columns: 120, Rows: 40 }) {
+        t.Errorf("pty = %+v, want vt100 120x40", call.Pty)
+    }
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,374 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package fake
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "sync"
+    "time"
+
+    "github.com/stefaanc/golang-exec/runner/internal/decode"
+    "github.com/stefaanc/golang-exec/runner/internal/errs"
+    "github.com/stefaanc/golang-exec/runner/internal/watchdog"
+    "github.com/stefaanc/golang-exec/script"
+)
+
+//------------------------------------------------------------------------------
+
+type Error struct {
+    script   *script.Script
+    command  string
+    exitCode int
+    err      error
+}
+
+type Runner struct {
+    script   *script.Script
+    command  string
+    response Response
+    running  bool
+
+    // the runner options are recorded in the call, a fake runner doesn't start a process
+    host     *Host
+    call     int   // index of the call in the calls of 'host'
+
+    stdout     io.Writer
+    stderr     io.Writer
+    stdoutPipe *io.PipeWriter
+    stderrPipe *io.PipeWriter
+
+    watchdog watchdog.Watchdog
+    done     chan struct{}   // closed when the script completes
+    kill     chan struct{}   // closed to terminate the script
+    killOnce sync.Once
+    killed   bool
+
+    exitCode int
+    signal   string
+}
+
+//------------------------------------------------------------------------------
+
+func (e *Error) Script()   *script.Script { return e.script }
+func (e *Error) Command()  string         { return e.command }
+func (e *Error) ExitCode() int            { return e.exitCode }
+func (e *Error) Error()    string         { return e.err.Error() }
+func (e *Error) Unwrap()   error          { return e.err }
+
+//------------------------------------------------------------------------------
+
+func New(connection interface{}, s *script.Script, arguments interface{}) (*Runner, error) {
+    c := new(Connection)
+    err := decode.Decode(connection, c)
+    if err != nil {
+        return nil, &Error{
+            script: s,
+            exitCode: -1,
+            err: fmt.Errorf("[golang-exec/runner/fake/New()] invalid 'connection' parameter: %w\n", err),
+        }
+    }
+
+    h, ok := lookupHost(c.Host)
+    if !ok {
+        return nil, &Error{
+            script: s,
+            exitCode: -1,
+            err: fmt.Errorf("[golang-exec/runner/fake/New()] invalid 'Host' in 'connection' parameter, no fake host %q: %w\n", c.Host, errs.ErrConnection),
+        }
+    }
+
+    if s.Error != nil {
+        return nil, &Error{
+            script: s,
+            exitCode: -1,
+            err: fmt.Errorf("[golang-exec/runner/fake/New()] script failed to parse: %w\n", errs.Wrap(errs.ErrParse, s.Error)),
+        }
+    }
+
+    r := new(Runner)
+    r.script = s
+    r.command = s.Command()
+    r.watchdog.Timeout = s.Timeout   // from the front-matter of the script, can be overridden using SetTimeout()
+
+    stdin, err := s.NewReader(arguments)
+    if err != nil {
+        return nil, &Error{
+            script: s,
+            exitCode: -1,
+            err: fmt.Errorf("[golang-exec/runner/fake/New()] cannot create stdin reader: %w\n", errs.Wrap(errs.ErrRender, err)),
+        }
+    }
+    code, _ := ioutil.ReadAll(stdin)
+
+    env, err := s.Environment(arguments)
+    if err != nil {
+        return nil, &Error{
+            script: s,
+            exitCode: -1,
+            err: fmt.Errorf("[golang-exec/runner/fake/New()] cannot create environment: %w\n", errs.Wrap(errs.ErrRender, err)),
+        }
+    }
+
+    r.host = h
+    r.response, r.call = h.respond(Call{
+        Connection: connection,
+        Script: s,
+        Arguments: arguments,
+        Command: r.command,
+        Code: string(code),
+        Env: env,
+    })
+    if r.response.DialError != nil {
+        return nil, &Error{
+            script: s,
+            exitCode: -1,
+            err: fmt.Errorf("[golang-exec/runner/fake/New()] cannot open session: %w\n", errs.Wrap(errs.ErrDial, r.response.DialError)),
+        }
+    }
+
+    return r, nil
+}
+
+//------------------------------------------------------------------------------
+
+func (r *Runner) SetStdoutWriter(stdout io.Writer) {
+    r.stdout = stdout
+}
+
+func (r *Runner) SetStderrWriter(stderr io.Writer) {
+    r.stderr = stderr
+}
+
+func (r *Runner) SetTimeout(timeout time.Duration) {
+    r.watchdog.Timeout = timeout
+}
+
+func (r *Runner) SetIdleTimeout(timeout time.Duration) {
+    r.watchdog.IdleTimeout = timeout
+}
+
+func (r *Runner) SetDir(dir string) {
+    r.host.record(r.call, func(call *Call) { call.Dir = dir })
+}
+
+func (r *Runner) SetEnv(env []string) {
+    r.host.record(r.call, func(call *Call) { call.ExtraEnv = env })
+}
+
+func (r *Runner) SetCleanEnv(clean bool) {
+    r.host.record(r.call, func(call *Call) { call.CleanEnv = clean })
+}
+
+func (r *Runner) SetBecome(method string, user string, password string) {
+    r.host.record(r.call, func(call *Call) { call.Become = &Become{ Method: method, User: user, Password: password } })
+}
+
+func (r *Runner) SetPty(term string, columns int, rows int) {
+    r.host.record(r.call, func(call *Call) { call.Pty = &Pty{ Term: term, Columns: columns, Rows: rows } })
+}
+
+func (r *Runner) StdoutPipe() (io.Reader, error) {
+    reader, writer := io.Pipe()
+    r.stdoutPipe = writer
+
+    return r.watchdog.Reader(reader), nil
+}
+
+func (r *Runner) StderrPipe() (io.Reader, error) {
+    reader, writer := io.Pipe()
+    r.stderrPipe = writer
+
+    return r.watchdog.Reader(reader), nil
+}
+
+func (r *Runner) Run() error {
+    return r.RunContext(context.Background())
+}
+
+func (r *Runner) RunContext(ctx context.Context) error {
+    err := r.StartContext(ctx)
+    if err != nil {
+        return err
+    }
+
+    return r.Wait()
+}
+
+func (r *Runner) Start() error {
+    return r.StartContext(context.Background())
+}
+
+func (r *Runner) StartContext(ctx context.Context) error {
+    if ctx.Err() != nil {
+        r.exitCode = -1
+        return &Error{
+            script: r.script,
+            command: r.command,
+            exitCode: r.exitCode,
+            err: fmt.Errorf("[golang-exec/runner/fake/Start()] runner cancelled: %w\n", errs.FromContext(ctx.Err())),
+        }
+    }
+
+    if r.response.StartError != nil {
+        r.exitCode = -1
+        return &Error{
+            script: r.script,
+            command: r.command,
+            exitCode: r.exitCode,
+            err: fmt.Errorf("[golang-exec/runner/fake/Start()] cannot start runner: %w\n", errs.Wrap(errs.ErrStart, r.response.StartError)),
+        }
+    }
+
+    r.running = true
+    r.done = make(chan struct{})
+    r.kill = make(chan struct{})
+    exited := make(chan struct{})
+
+    // every stream is written by its own goroutine, so the caller can read the pipes in any order
+    var written sync.WaitGroup
+    output := func(writer io.Writer, pipe *io.PipeWriter, s string) {
+        if pipe == nil {
+            written.Add(1)
+        }
+        go func() {
+            _, _ = io.WriteString(r.writer(writer, pipe), s)
+            if pipe == nil {
+                written.Done()
+                return
+            }
+
+            // like the pipe of a process, the pipe is closed when the script exits
+            <-exited
+            _ = pipe.Close()
+        }()
+    }
+    output(r.stdout, r.stdoutPipe, r.response.Stdout)
+    output(r.stderr, r.stderrPipe, r.response.Stderr)
+
+    go func() {
+        defer close(r.done)
+
+        timer := time.NewTimer(r.response.Delay)
+        defer timer.Stop()
+        select {
+        case <-timer.C:
+        case <-r.kill:
+            r.killed = true
+        }
+        close(exited)
+
+        // the output is written when Wait() returns, unless it is written to a pipe that isn't read yet
+        written.Wait()
+    }()
+
+    // kill the script when 'ctx' is done, or when the script times out
+    r.watchdog.Start(ctx, r.terminate)
+
+    return nil
+}
+
+func (r *Runner) Wait() error {
+    if r.done == nil {
+        r.exitCode = -1
+        return &Error{
+            script: r.script,
+            command: r.command,
+            exitCode: r.exitCode,
+            err: fmt.Errorf("[golang-exec/runner/fake/Wait()] runner not started\n"),
+        }
+    }
+
+    <-r.done
+    r.watchdog.Stop()
+    r.running = false
+
+    if r.killed {
+        r.exitCode = -1
+        r.signal = "KILL"
+        if cause := r.watchdog.Err(); cause != nil {
+            return &Error{
+                script: r.script,
+                command: r.command,
+                exitCode: r.exitCode,
+                err: fmt.Errorf("[golang-exec/runner/fake/Wait()] runner cancelled: %w\n", cause),
+            }
+        }
+        return &Error{
+            script: r.script,
+            command: r.command,
+            exitCode: r.exitCode,
+            err: fmt.Errorf("[golang-exec/runner/fake/Wait()] runner failed: %w\n", errs.Wrap(errs.ErrExit, fmt.Errorf("signal: killed"))),
+        }
+    }
+
+    r.exitCode = r.response.ExitCode
+    r.signal = r.response.Signal
+    if r.signal != "" && r.exitCode == 0 {
+        r.exitCode = -1
+    }
+    if r.exitCode != 0 {
+        return &Error{
+            script: r.script,
+            command: r.command,
+            exitCode: r.exitCode,
+            err: fmt.Errorf("[golang-exec/runner/fake/Wait()] runner failed: %w\n", errs.Wrap(errs.ErrExit, fmt.Errorf("exit status %d", r.exitCode))),
+        }
+    }
+
+    return nil
+}
+
+func (r *Runner) Close() error {
+    if r.running {
+        r.terminate()
+    }
+
+    return nil
+}
+
+func (r *Runner) ExitCode() int {
+    return r.exitCode
+}
+
+func (r *Runner) Signal() string {
+    return r.signal
+}
+
+func (r *Runner) Command() string {
+    return r.command
+}
+
+//------------------------------------------------------------------------------
+
+func (r *Runner) writer(writer io.Writer, pipe *io.PipeWriter) io.Writer {
+    if pipe != nil {
+        return pipe   // reads from the pipe register activity with the watchdog
+    }
+    if writer == nil {
+        writer = ioutil.Discard
+    }
+    return r.watchdog.Writer(writer)
+}
+
+func (r *Runner) terminate() {
+    r.killOnce.Do(func() {
+        close(r.kill)
+
+        // unblocks writing output that isn't read
+        if r.stdoutPipe != nil {
+            _ = r.stdoutPipe.Close()
+        }
+        if r.stderrPipe != nil {
+            _ = r.stderrPipe.Close()
+        }
+    })
+}
+
+//------------------------------------------------------------------------------
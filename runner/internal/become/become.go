@@ -0,0 +1,187 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package become
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "strings"
+    "sync"
+
+    "github.com/stefaanc/golang-exec/runner/internal/errs"
+)
+
+//------------------------------------------------------------------------------
+
+// privilege escalation for the shell of a script, used by the runners that execute scripts on a unix host
+//
+// the shell is wrapped in a "sh -c" command that
+// - reads the password from the first line of stdin, using shell builtins so it never appears in argv
+// - checks the password and the permission to become the user, and prints 'failedMessage' to stderr when they are rejected
+// - runs the shell as the user, feeding it the rest of stdin (the rendered script)
+type Become struct {
+    Method   string   // "sudo" or "su", "" for "sudo", "su" only without a password because it reads the password from a terminal
+    User     string   // "" for "root"
+    Password string   // "" when no password is needed
+}
+
+// line printed to stderr by the wrapper when the password or the user is rejected
+const failedMessage = "golang-exec: become failed"
+
+// line sent to the shell after the password, so the shell starts at the script whether or not sudo asked for the password
+const marker = "__golang_exec_become__"
+
+//------------------------------------------------------------------------------
+
+func (b *Become) Command(command string) (string, error) {
+    // returns the command that executes 'command' as the user
+    script, err := b.Script(command)
+    if err != nil {
+        return "", err
+    }
+
+    return "sh -c " + quote(script), nil
+}
+
+func (b *Become) Script(command string) (string, error) {
+    // returns the code for "sh -c" that executes 'command' as the user
+    if strings.ContainsAny(b.Password, "\n\r\x00") {
+        return "", fmt.Errorf("become password cannot contain a newline or a NUL byte")
+    }
+
+    user := b.User
+    if user == "" {
+        user = "root"
+    }
+    fail := "{ echo '" + failedMessage + "' >&2; exit 1; }"
+
+    switch b.Method {
+    case "", "sudo":
+        if b.Password == "" {
+            return "sudo -n -u " + quote(user) + " -- true 2>/dev/null || " + fail + "; " +
+                "exec sudo -n -u " + quote(user) + " -- " + command, nil
+        }
+
+        // "-k" ignores cached credentials, so a wrong password is always detected
+        // the shell skips the password when sudo didn't ask for it, for instance because of "NOPASSWD"
+        shell := "while IFS= read -r l; do [ \"$l\" = " + marker + " ] && exec " + command + "; done; exit 1"
+        return "IFS= read -r p; " +
+            "printf '%s\\n' \"$p\" | sudo -S -k -p '' -u " + quote(user) + " -- true 2>/dev/null || " + fail + "; " +
+            "{ printf '%s\\n%s\\n' \"$p\" " + marker + "; exec cat; } | sudo -S -p '' -u " + quote(user) + " -- sh -c " + quote(shell), nil
+    case "su":
+        // su reads the password from a terminal, not from stdin
+        if b.Password != "" {
+            return "", fmt.Errorf("become method \"su\" cannot read a password from stdin, use \"sudo\"")
+        }
+
+        return "su " + quote(user) + " -c true </dev/null >/dev/null 2>&1 || " + fail + "; " +
+            "exec su " + quote(user) + " -c " + quote("exec " + command), nil
+    default:
+        return "", fmt.Errorf("invalid become method %q, must be \"sudo\" or \"su\"", b.Method)
+    }
+}
+
+func (b *Become) Err() error {
+    // returns the error for a command that failed because the password or the user was rejected
+    user := b.User
+    if user == "" {
+        user = "root"
+    }
+
+    return errs.Wrap(errs.ErrBecome, fmt.Errorf("password rejected, or not allowed to become user %q", user))
+}
+
+func (b *Become) Stdin(stdin io.Reader) io.Reader {
+    // returns the stdin for the command, with the password on the first line
+    if b.Password == "" {
+        return stdin
+    }
+
+    return io.MultiReader(strings.NewReader(b.Password + "\n"), stdin)
+}
+
+func quote(s string) string {
+    return "'" + strings.Replace(s, "'", "'\\''", -1) + "'"
+}
+
+//------------------------------------------------------------------------------
+
+// a detector scans the output of the command for 'failedMessage', stderr or the output of a pseudo-terminal
+type Detector struct {
+    mu     sync.Mutex
+    failed bool
+}
+
+func (d *Detector) Failed() bool {
+    // returns true when the password or the user was rejected
+    d.mu.Lock()
+    defer d.mu.Unlock()
+
+    return d.failed
+}
+
+func (d *Detector) fail() {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+
+    d.failed = true
+}
+
+// a line scanner keeps the start of the current line of a stream
+type lineScanner struct {
+    detector *Detector
+    line     []byte
+}
+
+func (s *lineScanner) scan(p []byte) {
+    for _, c := range p {
+        if c == '\n' {
+            if string(bytes.TrimSuffix(s.line, []byte("\r"))) == failedMessage {
+                s.detector.fail()
+            }
+            s.line = s.line[:0]
+        } else if len(s.line) <= len(failedMessage) {
+            s.line = append(s.line, c)
+        }
+    }
+}
+
+//------------------------------------------------------------------------------
+
+func (d *Detector) Writer(writer io.Writer) io.Writer {
+    // returns a writer that scans the output before writing it to 'writer'
+    return &detectorWriter{ scanner: lineScanner{ detector: d }, writer: writer }
+}
+
+func (d *Detector) Reader(reader io.Reader) io.Reader {
+    // returns a reader that scans the output after reading it from 'reader'
+    return &detectorReader{ scanner: lineScanner{ detector: d }, reader: reader }
+}
+
+type detectorWriter struct {
+    scanner lineScanner
+    writer  io.Writer
+}
+
+func (w *detectorWriter) Write(p []byte) (int, error) {
+    w.scanner.scan(p)
+    return w.writer.Write(p)
+}
+
+type detectorReader struct {
+    scanner lineScanner
+    reader  io.Reader
+}
+
+func (r *detectorReader) Read(p []byte) (int, error) {
+    n, err := r.reader.Read(p)
+    r.scanner.scan(p[:n])
+    return n, err
+}
+
+//------------------------------------------------------------------------------
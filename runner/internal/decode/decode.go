@@ -0,0 +1,560 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package decode
+
+import (
+    "encoding"
+    "fmt"
+    "math"
+    "reflect"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/stefaanc/golang-exec/runner/internal/errs"
+)
+
+//------------------------------------------------------------------------------
+
+// name of the struct tag, for instance `exec:"host"`, `exec:"port,default=22"`, `exec:"-"`
+//
+// in a connection struct, the tag renames a field or skips it ("-"), the option "inline" flattens a nested struct
+// in a target struct, the option "required" rejects a zero value, the option "default=<value>" replaces a zero value
+const TagName = "exec"
+
+// fields of a connection, keyed by lowercase field name
+type source map[string]interface{}
+
+// elements of a slice from map keys "<field>[<index>].<subfield>", stored under key "<field>[]"
+type indexed map[int]source
+
+var indexedKey = regexp.MustCompile(`^([^\[\]]+)\[(\d+)\]\.(.+)$`)
+
+// maximum number of elements of a slice from indexed keys
+const maxIndexed = 100
+
+var durationType = reflect.TypeOf(time.Duration(0))
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+//------------------------------------------------------------------------------
+
+func Decode(connection interface{}, target interface{}) error {
+    // copies the fields of 'connection' into the struct pointed to by 'target', then validates 'target'
+    err := DecodeFields(connection, target)
+    if err != nil {
+        return err
+    }
+
+    return Validate(target)
+}
+
+func DecodeFields(connection interface{}, target interface{}) error {
+    // copies the fields of 'connection' into the struct pointed to by 'target', without applying defaults
+    // 'connection' can be a struct, a pointer to a struct, a map[string]string or a map[string]interface{}
+    // field names are matched case-insensitively, embedded structs are flattened
+    // keys of a map that don't match a field are rejected, fields of a struct that don't match a field are ignored
+    t := reflect.ValueOf(target)
+    if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+        panic("[golang-exec/runner/internal/decode/DecodeFields()] 'target' must be a pointer to a struct")
+    }
+
+    src, err := newSource(reflect.ValueOf(connection))
+    if err != nil {
+        return errs.Wrap(errs.ErrConnection, err)
+    }
+
+    err = decodeStruct(src, t.Elem(), "", isMap(reflect.ValueOf(connection)))
+    if err != nil {
+        return errs.Wrap(errs.ErrConnection, err)
+    }
+
+    return nil
+}
+
+func Validate(target interface{}) error {
+    // applies the defaults of the struct pointed to by 'target', and checks its required fields
+    // also for nested structs and slices of structs
+    t := reflect.ValueOf(target)
+    if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+        panic("[golang-exec/runner/internal/decode/Validate()] 'target' must be a pointer to a struct")
+    }
+
+    err := validate(t.Elem(), "")
+    if err != nil {
+        return errs.Wrap(errs.ErrConnection, err)
+    }
+
+    return nil
+}
+
+func Type(connection interface{}) (string, error) {
+    // returns the lowercase 'Type' of a connection
+    src, err := newSource(reflect.ValueOf(connection))
+    if err != nil {
+        return "", errs.Wrap(errs.ErrConnection, err)
+    }
+
+    var cType string
+    err = assign(reflect.ValueOf(&cType).Elem(), src["type"], "Type")
+    if err != nil {
+        return "", errs.Wrap(errs.ErrConnection, err)
+    }
+    if cType == "" {
+        return "", errs.Wrap(errs.ErrConnection, fmt.Errorf("[golang-exec/runner/internal/decode/Type()] missing 'Type' in 'connection' parameter\n"))
+    }
+
+    return strings.ToLower(cType), nil
+}
+
+//------------------------------------------------------------------------------
+
+func newSource(v reflect.Value) (source, error) {
+    for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+        if v.IsNil() {
+            return nil, fmt.Errorf("[golang-exec/runner/internal/decode/DecodeFields()] 'connection' parameter is nil\n")
+        }
+        v = v.Elem()
+    }
+    if !v.IsValid() {
+        return nil, fmt.Errorf("[golang-exec/runner/internal/decode/DecodeFields()] 'connection' parameter is nil\n")
+    }
+
+    src := make(source)
+    switch v.Kind() {
+    case reflect.Struct:
+        addStructFields(src, v)
+    case reflect.Map:
+        if v.Type().Key().Kind() != reflect.String {
+            return nil, fmt.Errorf("[golang-exec/runner/internal/decode/DecodeFields()] 'connection' parameter must be a map with string keys, got %s\n", v.Type())
+        }
+        iter := v.MapRange()
+        for iter.Next() {
+            err := src.add(iter.Key().String(), iter.Value().Interface())
+            if err != nil {
+                return nil, err
+            }
+        }
+    default:
+        return nil, fmt.Errorf("[golang-exec/runner/internal/decode/DecodeFields()] 'connection' parameter must be a struct or a map, got %s\n", v.Type())
+    }
+
+    return src, nil
+}
+
+func addStructFields(src source, v reflect.Value) {
+    // fields of the outer struct take precedence over fields of embedded structs, like in golang
+    t := v.Type()
+    var embedded []reflect.Value
+    for i := 0; i < t.NumField(); i++ {
+        f := t.Field(i)
+        name, options := parseTag(f.Tag.Get(TagName))
+        if name == "-" {
+            continue
+        }
+
+        fv := v.Field(i)
+        if _, inline := options["inline"]; f.Anonymous || inline {
+            for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+                fv = fv.Elem()
+            }
+            if fv.Kind() == reflect.Struct {
+                embedded = append(embedded, fv)
+                continue
+            }
+        }
+
+        if f.PkgPath != "" {
+            continue   // unexported
+        }
+        if name == "" {
+            name = f.Name
+        }
+
+        key := strings.ToLower(name)
+        if _, ok := src[key]; !ok {
+            src[key] = fv.Interface()
+        }
+    }
+
+    for _, fv := range embedded {
+        addStructFields(src, fv)
+    }
+}
+
+func (src source) add(key string, value interface{}) error {
+    m := indexedKey.FindStringSubmatch(key)
+    if m == nil {
+        src[strings.ToLower(key)] = value
+        return nil
+    }
+
+    // "<field>[<index>].<subfield>"
+    base := strings.ToLower(m[1]) + "[]"
+    i, err := strconv.Atoi(m[2])
+    if err != nil || i < 0 || i >= maxIndexed {
+        return fmt.Errorf("[golang-exec/runner/internal/decode/DecodeFields()] invalid key %q in 'connection' parameter, the index must be between 0 and %d\n", key, maxIndexed - 1)
+    }
+
+    elements, _ := src[base].(indexed)
+    if elements == nil {
+        elements = make(indexed)
+        src[base] = elements
+    }
+    if elements[i] == nil {
+        elements[i] = make(source)
+    }
+    return elements[i].add(m[3], value)
+}
+
+//------------------------------------------------------------------------------
+
+func decodeStruct(src source, v reflect.Value, path string, strict bool) error {
+    // when 'strict' is set, keys of 'src' that don't match a field are rejected
+    used := make(map[string]bool)
+    t := v.Type()
+    for i := 0; i < t.NumField(); i++ {
+        f := t.Field(i)
+        if f.PkgPath != "" {
+            continue   // unexported
+        }
+
+        name, _ := parseTag(f.Tag.Get(TagName))
+        if name == "-" {
+            continue
+        }
+        if name == "" {
+            name = f.Name
+        }
+        key := strings.ToLower(name)
+        fpath := path + f.Name
+        fv := v.Field(i)
+        used[key] = true
+        used[key + "[]"] = true
+
+        if value, ok := src[key]; ok {
+            err := assign(fv, value, fpath)
+            if err != nil {
+                return err
+            }
+        }
+
+        if elements, ok := src[key + "[]"].(indexed); ok {
+            err := assignIndexed(fv, elements, fpath)
+            if err != nil {
+                return err
+            }
+        }
+    }
+
+    if strict {
+        var unknown []string
+        for key := range src {
+            if !used[key] {
+                unknown = append(unknown, "'" + path + strings.TrimSuffix(key, "[]") + "'")
+            }
+        }
+        if len(unknown) > 0 {
+            sort.Strings(unknown)
+            return fmt.Errorf("[golang-exec/runner/internal/decode/DecodeFields()] unknown %s in 'connection' parameter\n", strings.Join(unknown, ", "))
+        }
+    }
+
+    return nil
+}
+
+func validate(v reflect.Value, path string) error {
+    t := v.Type()
+    for i := 0; i < t.NumField(); i++ {
+        f := t.Field(i)
+        if f.PkgPath != "" {
+            continue   // unexported
+        }
+
+        _, options := parseTag(f.Tag.Get(TagName))
+        fpath := path + f.Name
+        fv := v.Field(i)
+
+        if def, ok := options["default"]; ok && isZero(fv) {
+            err := assign(fv, def, fpath)
+            if err != nil {
+                panic(fmt.Sprintf("[golang-exec/runner/internal/decode/Validate()] invalid default for '%s': %v", fpath, err))
+            }
+        }
+
+        if _, required := options["required"]; required && isZero(fv) {
+            return fmt.Errorf("[golang-exec/runner/internal/decode/Validate()] missing '%s' in 'connection' parameter\n", fpath)
+        }
+
+        switch {
+        case fv.Kind() == reflect.Struct:
+            err := validate(fv, fpath + ".")
+            if err != nil {
+                return err
+            }
+        case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.Struct:
+            for j := 0; j < fv.Len(); j++ {
+                err := validate(fv.Index(j), fmt.Sprintf("%s[%d].", fpath, j))
+                if err != nil {
+                    return err
+                }
+            }
+        }
+    }
+
+    return nil
+}
+
+func assignIndexed(fv reflect.Value, elements indexed, path string) error {
+    if fv.Kind() != reflect.Slice {
+        return fmt.Errorf("[golang-exec/runner/internal/decode/DecodeFields()] invalid '%s' in 'connection' parameter: cannot use indexed keys for a %s\n", path, fv.Type())
+    }
+
+    indexes := make([]int, 0, len(elements))
+    for i := range elements {
+        indexes = append(indexes, i)
+    }
+    sort.Ints(indexes)
+
+    // the indexed elements must continue the elements decoded from "<field>" (if any) without gaps
+    n := fv.Len()
+    for _, i := range indexes {
+        if i > n {
+            return fmt.Errorf("[golang-exec/runner/internal/decode/DecodeFields()] invalid '%s[%d]' in 'connection' parameter: missing '%s[%d]'\n", path, i, path, n)
+        }
+        if i == n {
+            n++
+        }
+    }
+
+    // grow the slice, keeping the elements decoded from "<field>"
+    if fv.Len() < n {
+        grown := reflect.MakeSlice(fv.Type(), n, n)
+        reflect.Copy(grown, fv)
+        fv.Set(grown)
+    }
+
+    for _, i := range indexes {
+        err := assign(fv.Index(i), elements[i], fmt.Sprintf("%s[%d]", path, i))
+        if err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+func assign(fv reflect.Value, value interface{}, path string) error {
+    rv := reflect.ValueOf(value)
+    for rv.IsValid() && (rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface) {
+        if rv.IsNil() {
+            return nil   // keep the zero value
+        }
+        rv = rv.Elem()
+    }
+    if !rv.IsValid() {
+        return nil
+    }
+
+    invalid := func(err error) error {
+        if err == nil {
+            err = fmt.Errorf("cannot use %s as %s", rv.Type(), fv.Type())
+        }
+        return fmt.Errorf("[golang-exec/runner/internal/decode/DecodeFields()] invalid '%s' in 'connection' parameter: %w\n", path, err)
+    }
+
+    if rv.Kind() == reflect.String && fv.CanAddr() && fv.Addr().Type().Implements(textUnmarshalerType) {
+        err := fv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(rv.String()))
+        if err != nil {
+            return invalid(err)
+        }
+        return nil
+    }
+
+    switch fv.Kind() {
+    case reflect.String:
+        if rv.Kind() != reflect.String {
+            return invalid(nil)
+        }
+        fv.SetString(rv.String())
+    case reflect.Bool:
+        switch rv.Kind() {
+        case reflect.Bool:
+            fv.SetBool(rv.Bool())
+        case reflect.String:
+            b, err := strconv.ParseBool(strings.ToLower(strings.TrimSpace(rv.String())))
+            if err != nil {
+                return invalid(err)
+            }
+            fv.SetBool(b)
+        default:
+            return invalid(nil)
+        }
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        var i int64
+        switch {
+        case rv.Kind() == reflect.String && fv.Type() == durationType:
+            d, err := time.ParseDuration(strings.TrimSpace(rv.String()))
+            if err != nil {
+                return invalid(err)
+            }
+            i = int64(d)
+        case rv.Kind() == reflect.String:
+            n, err := strconv.ParseInt(strings.TrimSpace(rv.String()), 10, 64)
+            if err != nil {
+                return invalid(err)
+            }
+            i = n
+        case isInt(rv):
+            i = rv.Int()
+        case isUint(rv):
+            if rv.Uint() > math.MaxInt64 {
+                return invalid(fmt.Errorf("%d overflows %s", rv.Uint(), fv.Type()))
+            }
+            i = int64(rv.Uint())
+        case isFloat(rv) && rv.Float() == math.Trunc(rv.Float()):
+            i = int64(rv.Float())
+        default:
+            return invalid(nil)
+        }
+        if fv.OverflowInt(i) {
+            return invalid(fmt.Errorf("%d overflows %s", i, fv.Type()))
+        }
+        fv.SetInt(i)
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+        var u uint64
+        switch {
+        case rv.Kind() == reflect.String:
+            n, err := strconv.ParseUint(strings.TrimSpace(rv.String()), 10, 64)
+            if err != nil {
+                return invalid(err)
+            }
+            u = n
+        case isUint(rv):
+            u = rv.Uint()
+        case isInt(rv) && rv.Int() >= 0:
+            u = uint64(rv.Int())
+        case isFloat(rv) && rv.Float() >= 0 && rv.Float() == math.Trunc(rv.Float()):
+            u = uint64(rv.Float())
+        default:
+            return invalid(nil)
+        }
+        if fv.OverflowUint(u) {
+            return invalid(fmt.Errorf("%d overflows %s", u, fv.Type()))
+        }
+        fv.SetUint(u)
+    case reflect.Struct:
+        src, err := newSource(rv)
+        if err != nil {
+            return invalid(nil)
+        }
+        return decodeStruct(src, fv, path + ".", rv.Kind() == reflect.Map)
+    case reflect.Slice:
+        switch rv.Kind() {
+        case reflect.String:
+            // comma-separated list of elements
+            elemType := fv.Type().Elem()
+            if elemType.Kind() != reflect.String && !reflect.PtrTo(elemType).Implements(textUnmarshalerType) {
+                return invalid(nil)
+            }
+
+            var parts []string
+            for _, part := range strings.Split(rv.String(), ",") {
+                if part = strings.TrimSpace(part); part != "" {
+                    parts = append(parts, part)
+                }
+            }
+
+            if len(parts) == 0 {
+                return nil   // keep a nil slice
+            }
+
+            slice := reflect.MakeSlice(fv.Type(), len(parts), len(parts))
+            for i, part := range parts {
+                err := assign(slice.Index(i), part, fmt.Sprintf("%s[%d]", path, i))
+                if err != nil {
+                    return err
+                }
+            }
+            fv.Set(slice)
+        case reflect.Slice, reflect.Array:
+            if rv.Len() == 0 {
+                return nil   // keep a nil slice
+            }
+
+            slice := reflect.MakeSlice(fv.Type(), rv.Len(), rv.Len())
+            for i := 0; i < rv.Len(); i++ {
+                err := assign(slice.Index(i), rv.Index(i).Interface(), fmt.Sprintf("%s[%d]", path, i))
+                if err != nil {
+                    return err
+                }
+            }
+            fv.Set(slice)
+        default:
+            return invalid(nil)
+        }
+    default:
+        if !rv.Type().AssignableTo(fv.Type()) {
+            return invalid(nil)
+        }
+        fv.Set(rv)
+    }
+
+    return nil
+}
+
+//------------------------------------------------------------------------------
+
+func parseTag(tag string) (string, map[string]string) {
+    // returns the name and the options of a tag, options without a value map to ""
+    // the "default" option must be the last one, its value can contain commas
+    parts := strings.Split(tag, ",")
+    options := make(map[string]string)
+    for i := 1; i < len(parts); i++ {
+        option := strings.TrimSpace(parts[i])
+        if strings.HasPrefix(option, "default=") {
+            options["default"] = strings.Join(append([]string{ strings.TrimPrefix(option, "default=") }, parts[i+1:]...), ",")
+            break
+        }
+        options[option] = ""
+    }
+    return strings.TrimSpace(parts[0]), options
+}
+
+func isMap(v reflect.Value) bool {
+    for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && !v.IsNil() {
+        v = v.Elem()
+    }
+    return v.Kind() == reflect.Map
+}
+
+func isZero(v reflect.Value) bool {
+    return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+func isInt(v reflect.Value) bool {
+    switch v.Kind() {
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        return true
+    }
+    return false
+}
+
+func isUint(v reflect.Value) bool {
+    switch v.Kind() {
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+        return true
+    }
+    return false
+}
+
+func isFloat(v reflect.Value) bool {
+    return v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,150 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package decode
+
+import (
+    "errors"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/stefaanc/golang-exec/runner/internal/errs"
+)
+
+//------------------------------------------------------------------------------
+
+type testHop struct {
+    Host string `exec:",required"`
+    Port uint16 `exec:",default=22"`
+}
+
+func (h *testHop) UnmarshalText(text []byte) error {
+    h.Host = string(text)
+    return nil
+}
+
+type testTarget struct {
+    Type    string
+    Host    string   `exec:",required"`
+    Port    uint16   `exec:",default=22"`
+    Debug   bool
+    Timeout time.Duration
+    Tags    []string `exec:",default=a,b"`
+    Hops    []testHop
+}
+
+//------------------------------------------------------------------------------
+
+func TestDecodeStruct(t *testing.T) {
+    type credentials struct {
+        Host string
+    }
+    type options struct {
+        Verbose bool `exec:"debug"`
+    }
+    type connection struct {
+        *credentials
+        Options  options `exec:",inline"`
+        Type     string
+        Address  string  `exec:"host"`   // shadows the embedded field
+        Secret   string  `exec:"-"`
+    }
+
+    var c testTarget
+    err := Decode(&connection{
+        credentials: &credentials{ Host: "embedded" },
+        Options: options{ Verbose: true },
+        Type: "test",
+        Address: "outer",
+    }, &c)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    want := testTarget{ Type: "test", Host: "outer", Port: 22, Debug: true, Tags: []string{ "a", "b" } }
+    if !reflect.DeepEqual(c, want) {
+        t.Errorf("decoded = %+v, want %+v", c, want)
+    }
+}
+
+func TestDecodeMap(t *testing.T) {
+    var c testTarget
+    err := Decode(map[string]interface{}{
+        "type": "test",
+        "HOST": "target",
+        "Port": float64(2222),   // as decoded by encoding/json
+        "Debug": "True",
+        "Timeout": "90s",
+        "Tags": []interface{}{ "x" },
+        "Hops": "bastion1, bastion2",
+        "Hops[1].Port": "2200",
+        "Hops[2].Host": "bastion3",
+    }, &c)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    want := testTarget{
+        Type: "test",
+        Host: "target",
+        Port: 2222,
+        Debug: true,
+        Timeout: 90 * time.Second,
+        Tags: []string{ "x" },
+        Hops: []testHop{ { "bastion1", 22 }, { "bastion2", 2200 }, { "bastion3", 22 } },
+    }
+    if !reflect.DeepEqual(c, want) {
+        t.Errorf("decoded = %+v, want %+v", c, want)
+    }
+}
+
+func TestDecodeErrors(t *testing.T) {
+    tests := []struct {
+        name       string
+        connection interface{}
+        message    string
+    }{
+        { "nil",      nil,                                                      "is nil" },
+        { "kind",     42,                                                       "must be a struct or a map" },
+        { "keys",     map[int]string{},                                         "string keys" },
+        { "port",     map[string]string{ "Host": "h", "Port": "x" },            "'Port'" },
+        { "overflow", map[string]interface{}{ "Host": "h", "Port": -1 },        "'Port'" },
+        { "bool",     map[string]string{ "Host": "h", "Debug": "maybe" },       "'Debug'" },
+        { "type",     map[string]interface{}{ "Host": 42 },                     "'Host'" },
+        { "required", map[string]string{ "Port": "22" },                        "missing 'Host'" },
+        { "nested",   map[string]string{ "Host": "h", "Hops[0].Port": "22" },   "missing 'Hops[0].Host'" },
+        { "atoi",     map[string]string{ "Host": "h", "Hops[99999999999999999999].Host": "b" },   "index must be between 0 and 99" },
+        { "limit",    map[string]string{ "Host": "h", "Hops[2000000000].Host": "b" },               "index must be between 0 and 99" },
+        { "gap",      map[string]string{ "Host": "h", "Hops[0].Host": "b", "Hops[2].Host": "c" },   "missing 'Hops[1]'" },
+        { "gap list", map[string]string{ "Host": "h", "Hops": "b", "Hops[2].Host": "c" },           "missing 'Hops[1]'" },
+        { "unknown",  map[string]string{ "Host": "h", "Pasword": "secret" },                        "unknown 'pasword'" },
+        { "unknown nested", map[string]string{ "Host": "h", "Hops[0].Host": "b", "Hops[0].Prot": "22" }, "unknown 'Hops[0].prot'" },
+    }
+
+    for _, test := range tests {
+        var c testTarget
+        err := Decode(test.connection, &c)
+        if !errors.Is(err, errs.ErrConnection) || !strings.Contains(err.Error(), test.message) {
+            t.Errorf("%s: error = %v, want ErrConnection containing %q", test.name, err, test.message)
+        }
+    }
+}
+
+func TestType(t *testing.T) {
+    cType, err := Type(map[string]string{ "Type": "SSH" })
+    if err != nil || cType != "ssh" {
+        t.Errorf("type = %q, %v, want \"ssh\"", cType, err)
+    }
+
+    _, err = Type(struct{ Host string }{ "h" })
+    if !errors.Is(err, errs.ErrConnection) {
+        t.Errorf("error = %v, want ErrConnection", err)
+    }
+}
+
+//------------------------------------------------------------------------------
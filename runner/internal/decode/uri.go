@@ -0,0 +1,253 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package decode
+
+import (
+    "fmt"
+    "net"
+    "net/url"
+    "reflect"
+    "strings"
+    "unicode"
+
+    "github.com/stefaanc/golang-exec/runner/internal/errs"
+)
+
+//------------------------------------------------------------------------------
+
+// replaces the values of fields tagged with `exec:",secret"` when encoding a connection as a URI
+const Redacted = "xxxxx"
+
+// keeps characters that are common in parameter values readable, like paths and lists
+var queryUnescaper = strings.NewReplacer("%2F", "/", "%2C", ",", "%3A", ":", "%40", "@", "%7E", "~")
+
+//------------------------------------------------------------------------------
+
+func DecodeURI(uri string, target interface{}) error {
+    // copies the parts of 'uri' into the struct pointed to by 'target', without applying defaults
+    // "<type>://<user>:<password>@<host>:<port>?<field>=<value>&...", field names are matched ignoring case, "_" and "-"
+    // repeated query parameters are joined with commas
+    u, err := url.Parse(uri)
+    if err != nil {
+        return errs.Wrap(errs.ErrConnection, fmt.Errorf("[golang-exec/runner/internal/decode/DecodeURI()] invalid 'uri' parameter: %w\n", err))
+    }
+    if u.Scheme == "" || u.Opaque != "" || (u.Path != "" && u.Path != "/") || u.Fragment != "" {
+        return errs.Wrap(errs.ErrConnection, fmt.Errorf("[golang-exec/runner/internal/decode/DecodeURI()] invalid 'uri' parameter, must be \"<type>://[<user>[:<password>]@]<host>[:<port>][?<field>=<value>&...]\", got %q\n", u.Redacted()))
+    }
+
+    m := make(map[string]string)
+    m["type"] = u.Scheme
+    if u.User != nil {
+        m["user"] = u.User.Username()
+        if password, ok := u.User.Password(); ok {
+            m["password"] = password
+        }
+    }
+    if u.Hostname() != "" {
+        m["host"] = u.Hostname()
+    }
+    if u.Port() != "" {
+        m["port"] = u.Port()
+    }
+
+    keys := fieldKeys(reflect.TypeOf(target).Elem())
+    for key := range m {
+        if !keys[key] {
+            return errs.Wrap(errs.ErrConnection, fmt.Errorf("[golang-exec/runner/internal/decode/DecodeURI()] unexpected %s in 'uri' parameter %q\n", key, u.Redacted()))
+        }
+    }
+
+    query, err := url.ParseQuery(u.RawQuery)
+    if err != nil {
+        return errs.Wrap(errs.ErrConnection, fmt.Errorf("[golang-exec/runner/internal/decode/DecodeURI()] invalid query in 'uri' parameter: %w\n", err))
+    }
+
+    for param, values := range query {
+        key := strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(param))
+        base := key
+        if i := strings.Index(base, "["); i >= 0 {
+            base = base[:i]
+        }
+        if !keys[base] || base == "type" {
+            return errs.Wrap(errs.ErrConnection, fmt.Errorf("[golang-exec/runner/internal/decode/DecodeURI()] unknown parameter %q in 'uri' parameter\n", param))
+        }
+
+        m[key] = strings.Join(values, ",")
+    }
+
+    return DecodeFields(m, target)
+}
+
+func EncodeURI(source interface{}) string {
+    // returns the struct 'source' as a URI that can be decoded with DecodeURI(), secrets are redacted
+    // the fields "Type", "User", "Password", "Host" and "Port" make up the scheme and the authority, other fields the query
+    // fields with zero values are left out
+    v := reflect.Indirect(reflect.ValueOf(source))
+
+    var scheme, user, password, host, port string
+    var query []string
+    visitFields(v, func(key string, f reflect.StructField, fv reflect.Value) {
+        switch key {
+        case "type":
+            scheme = strings.ToLower(fmt.Sprint(fv.Interface()))
+        case "user":
+            user = fmt.Sprint(fv.Interface())
+        case "password":
+            password = encodeValue(f, fv)
+        case "host":
+            host = fmt.Sprint(fv.Interface())
+        case "port":
+            port = fmt.Sprint(fv.Interface())
+        default:
+            query = append(query, encodeParams(snakeCase(f.Name), f, fv)...)
+        }
+    })
+
+    u := &url.URL{ Scheme: scheme, Host: joinHostPort(host, port), RawQuery: strings.Join(query, "&") }
+    if password != "" {
+        u.User = url.UserPassword(user, password)
+    } else if user != "" {
+        u.User = url.User(user)
+    }
+
+    s := u.String()
+    if scheme != "" && u.Host == "" && u.User == nil {
+        // url.URL.String() leaves out the "//" for an empty authority
+        s = strings.Replace(s, ":", "://", 1)
+    }
+    return s
+}
+
+//------------------------------------------------------------------------------
+
+func fieldKeys(t reflect.Type) map[string]bool {
+    keys := make(map[string]bool)
+    visitFields(reflect.Zero(t), func(key string, f reflect.StructField, fv reflect.Value) {
+        keys[key] = true
+    })
+    return keys
+}
+
+func visitFields(v reflect.Value, visit func(string, reflect.StructField, reflect.Value)) {
+    // visits the exported fields of a struct, skipping zero values unless 'v' itself is a zero value
+    all := isZero(v)
+    t := v.Type()
+    for i := 0; i < t.NumField(); i++ {
+        f := t.Field(i)
+        name, _ := parseTag(f.Tag.Get(TagName))
+        if f.PkgPath != "" || name == "-" {
+            continue
+        }
+        if name == "" {
+            name = f.Name
+        }
+
+        fv := v.Field(i)
+        if !all && isZero(fv) {
+            continue
+        }
+        visit(strings.ToLower(name), f, fv)
+    }
+}
+
+func encodeParams(name string, f reflect.StructField, fv reflect.Value) []string {
+    if fv.Kind() != reflect.Slice || fv.Type().Elem().Kind() != reflect.Struct {
+        return []string{ name + "=" + encodeValue(f, fv) }
+    }
+
+    // slices of structs are encoded as a comma-separated list of "user@host:port" when possible
+    addresses := make([]string, fv.Len())
+    for i := 0; i < fv.Len(); i++ {
+        var user, host, port string
+        compact := true
+        visitFields(fv.Index(i), func(key string, f reflect.StructField, fv reflect.Value) {
+            switch key {
+            case "user":
+                user = fmt.Sprint(fv.Interface())
+            case "host":
+                host = fmt.Sprint(fv.Interface())
+            case "port":
+                port = fmt.Sprint(fv.Interface())
+            case "type":
+            default:
+                compact = false
+            }
+        })
+        if !compact || host == "" {
+            addresses = nil
+            break
+        }
+
+        addresses[i] = joinHostPort(host, port)
+        if user != "" {
+            addresses[i] = user + "@" + addresses[i]
+        }
+    }
+    if addresses != nil {
+        return []string{ name + "=" + queryEscape(strings.Join(addresses, ",")) }
+    }
+
+    // otherwise as "<name>[<index>].<field>=<value>"
+    var params []string
+    for i := 0; i < fv.Len(); i++ {
+        visitFields(fv.Index(i), func(key string, f reflect.StructField, fv reflect.Value) {
+            if key != "type" {
+                params = append(params, encodeParams(fmt.Sprintf("%s[%d].%s", name, i, snakeCase(f.Name)), f, fv)...)
+            }
+        })
+    }
+    return params
+}
+
+func encodeValue(f reflect.StructField, fv reflect.Value) string {
+    _, options := parseTag(f.Tag.Get(TagName))
+    if _, secret := options["secret"]; secret {
+        return Redacted
+    }
+
+    if fv.Kind() == reflect.Slice {
+        values := make([]string, fv.Len())
+        for i := range values {
+            values[i] = fmt.Sprint(fv.Index(i).Interface())
+        }
+        return queryEscape(strings.Join(values, ","))
+    }
+
+    return queryEscape(fmt.Sprint(fv.Interface()))
+}
+
+func queryEscape(s string) string {
+    return queryUnescaper.Replace(url.QueryEscape(s))
+}
+
+func joinHostPort(host string, port string) string {
+    if port != "" {
+        return net.JoinHostPort(host, port)
+    }
+    if strings.Contains(host, ":") {
+        return "[" + host + "]"   // ipv6 address
+    }
+    return host
+}
+
+func snakeCase(name string) string {
+    // "HostKeyFingerprint" -> "host_key_fingerprint", "AuthMethods" -> "auth_methods"
+    var b strings.Builder
+    runes := []rune(name)
+    for i, r := range runes {
+        if unicode.IsUpper(r) {
+            if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+                b.WriteRune('_')
+            }
+            r = unicode.ToLower(r)
+        }
+        b.WriteRune(r)
+    }
+    return b.String()
+}
+
+//------------------------------------------------------------------------------
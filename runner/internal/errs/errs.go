@@ -0,0 +1,69 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package errs
+
+import (
+    "context"
+    "errors"
+)
+
+//------------------------------------------------------------------------------
+
+// sentinel errors shared by the runners, re-exported by the "runner" package
+// use errors.Is() to test for them
+var (
+    ErrConnection  = errors.New("invalid connection")
+    ErrDial        = errors.New("cannot connect to host")
+    ErrAuth        = errors.New("authentication failed")
+    ErrHostKey     = errors.New("host key rejected")
+    ErrSession     = errors.New("session failed")
+    ErrParse       = errors.New("script failed to parse")
+    ErrRender      = errors.New("script failed to render")
+    ErrStart       = errors.New("script failed to start")
+    ErrExit        = errors.New("script exited with non-zero exitcode")
+    ErrTimeout     = errors.New("script timed out")
+    ErrIdleTimeout = errors.New("script produced no output")
+    ErrCancelled   = errors.New("script cancelled")
+    ErrBecome      = errors.New("cannot become user")
+    ErrUnsupported = errors.New("option not supported by runner")
+)
+
+//------------------------------------------------------------------------------
+
+type kindError struct {
+    kind error
+    err  error
+}
+
+func (e *kindError) Error()  string { return e.err.Error() }
+func (e *kindError) Unwrap() error  { return e.err }
+
+func (e *kindError) Is(target error) bool {
+    return target == e.kind
+}
+
+//------------------------------------------------------------------------------
+
+func Wrap(kind error, err error) error {
+    // returns an error with the same message as 'err', that matches 'kind' when using errors.Is()
+    if err == nil {
+        return nil
+    }
+
+    return &kindError{ kind: kind, err: err }
+}
+
+func FromContext(err error) error {
+    // returns an error for a context that is done, matching ErrTimeout when the deadline is exceeded, ErrCancelled otherwise
+    if errors.Is(err, context.DeadlineExceeded) {
+        return Wrap(ErrTimeout, err)
+    }
+
+    return Wrap(ErrCancelled, err)
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,169 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package watchdog
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "sync"
+    "time"
+
+    "github.com/stefaanc/golang-exec/runner/internal/errs"
+)
+
+//------------------------------------------------------------------------------
+
+// a watchdog terminates a running script when
+// - the context passed to Start() is done
+// - the script runs longer than 'Timeout'
+// - the script doesn't produce any output on stdout or stderr for 'IdleTimeout'
+type Watchdog struct {
+    Timeout     time.Duration   // 0 when no timeout
+    IdleTimeout time.Duration   // 0 when no idle timeout
+
+    mu       sync.Mutex
+    done     chan struct{}   // closed when the watchdog is stopped
+    activity time.Time       // time of last output
+    err      error           // reason for terminating the script
+}
+
+//------------------------------------------------------------------------------
+
+func (w *Watchdog) Start(ctx context.Context, kill func()) {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+
+    done := make(chan struct{})
+    w.done = done
+    w.activity = time.Now()
+    w.err = nil
+
+    timeout := w.Timeout
+    idleTimeout := w.IdleTimeout
+    if ctx.Done() == nil && timeout <= 0 && idleTimeout <= 0 {
+        return   // nothing to watch
+    }
+
+    go func() {
+        var timeoutC <-chan time.Time
+        if timeout > 0 {
+            t := time.NewTimer(timeout)
+            defer t.Stop()
+            timeoutC = t.C
+        }
+
+        var idleTimer *time.Timer
+        var idleC <-chan time.Time
+        if idleTimeout > 0 {
+            idleTimer = time.NewTimer(idleTimeout)
+            defer idleTimer.Stop()
+            idleC = idleTimer.C
+        }
+
+        var err error
+        for err == nil {
+            select {
+            case <-ctx.Done():
+                err = errs.FromContext(ctx.Err())
+            case <-timeoutC:
+                err = fmt.Errorf("%w after %s", errs.ErrTimeout, timeout)
+            case <-idleC:
+                remaining := idleTimeout - time.Since(w.lastActivity())
+                if remaining > 0 {
+                    idleTimer.Reset(remaining)
+                    continue
+                }
+                err = errs.Wrap(errs.ErrTimeout, fmt.Errorf("%w for %s", errs.ErrIdleTimeout, idleTimeout))
+            case <-done:
+                return
+            }
+        }
+
+        w.mu.Lock()
+        if w.done != done {
+            w.mu.Unlock()
+            return   // stopped while handling the event
+        }
+        w.err = err
+        w.mu.Unlock()
+
+        kill()
+    }()
+}
+
+func (w *Watchdog) Stop() {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+
+    if w.done != nil {
+        close(w.done)
+        w.done = nil
+    }
+}
+
+func (w *Watchdog) Err() error {
+    // returns the reason why the script was terminated, nil if it wasn't terminated by the watchdog
+    w.mu.Lock()
+    defer w.mu.Unlock()
+
+    return w.err
+}
+
+func (w *Watchdog) Touch() {
+    // registers output from the script
+    w.mu.Lock()
+    defer w.mu.Unlock()
+
+    w.activity = time.Now()
+}
+
+func (w *Watchdog) lastActivity() time.Time {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+
+    return w.activity
+}
+
+//------------------------------------------------------------------------------
+
+func (w *Watchdog) Writer(writer io.Writer) io.Writer {
+    // returns a writer that registers output from the script before writing it to 'writer'
+    return &activityWriter{ watchdog: w, writer: writer }
+}
+
+func (w *Watchdog) Reader(reader io.Reader) io.Reader {
+    // returns a reader that registers output from the script after reading it from 'reader'
+    return &activityReader{ watchdog: w, reader: reader }
+}
+
+type activityWriter struct {
+    watchdog *Watchdog
+    writer   io.Writer
+}
+
+func (a *activityWriter) Write(p []byte) (int, error) {
+    if len(p) > 0 {
+        a.watchdog.Touch()
+    }
+    return a.writer.Write(p)
+}
+
+type activityReader struct {
+    watchdog *Watchdog
+    reader   io.Reader
+}
+
+func (a *activityReader) Read(p []byte) (int, error) {
+    n, err := a.reader.Read(p)
+    if n > 0 {
+        a.watchdog.Touch()
+    }
+    return n, err
+}
+
+//------------------------------------------------------------------------------
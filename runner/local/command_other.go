@@ -0,0 +1,106 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+
+//go:build !windows
+// +build !windows
+
+package local
+
+import (
+    "os"
+    "os/exec"
+    "strconv"
+    "strings"
+    "syscall"
+
+    "github.com/creack/pty"
+)
+
+//------------------------------------------------------------------------------
+
+// signal names as used by ssh, see RFC 4254 section 6.10
+var signalNames = map[syscall.Signal]string{
+    syscall.SIGABRT: "ABRT",
+    syscall.SIGALRM: "ALRM",
+    syscall.SIGFPE:  "FPE",
+    syscall.SIGHUP:  "HUP",
+    syscall.SIGILL:  "ILL",
+    syscall.SIGINT:  "INT",
+    syscall.SIGKILL: "KILL",
+    syscall.SIGPIPE: "PIPE",
+    syscall.SIGQUIT: "QUIT",
+    syscall.SIGSEGV: "SEGV",
+    syscall.SIGTERM: "TERM",
+    syscall.SIGUSR1: "USR1",
+    syscall.SIGUSR2: "USR2",
+}
+
+//------------------------------------------------------------------------------
+
+func newCommand(command string) *exec.Cmd {
+    // "cmd" and "powershell" are windows-only shells, other shells don't need special argument-escaping
+    args := strings.Split(command, " ")
+    cmd := exec.Command(args[0], args[1:]...)
+
+    // start the shell in its own process group, so we can kill the processes started by the script together with the shell
+    cmd.SysProcAttr = &syscall.SysProcAttr{
+        Setpgid: true,
+    }
+
+    return cmd
+}
+
+func openTerminal(cmd *exec.Cmd, columns int, rows int) (*os.File, *os.File, error) {
+    // attaches stdout and stderr of the command to a new pseudo-terminal, and makes it the controlling terminal of the shell
+    // returns the master side to read the output of the command, and the terminal to close after starting the command
+    ptmx, tty, err := pty.Open()
+    if err != nil {
+        return nil, nil, err
+    }
+
+    err = pty.Setsize(ptmx, &pty.Winsize{ Cols: uint16(columns), Rows: uint16(rows) })
+    if err != nil {
+        _ = ptmx.Close()
+        _ = tty.Close()
+        return nil, nil, err
+    }
+
+    cmd.Stdout = tty
+    cmd.Stderr = tty
+
+    // the shell starts a new session, and thus also its own process group
+    cmd.SysProcAttr = &syscall.SysProcAttr{
+        Setsid: true,
+        Setctty: true,
+        Ctty: 1,   // stdout of the shell
+    }
+
+    return ptmx, tty, nil
+}
+
+func killCommand(cmd *exec.Cmd) error {
+    if cmd.Process == nil {
+        return nil
+    }
+
+    return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+func signalName(state *os.ProcessState) string {
+    // returns the name of the signal that terminated the process, "" when not terminated by a signal
+    status, ok := state.Sys().(syscall.WaitStatus)
+    if !ok || !status.Signaled() {
+        return ""
+    }
+
+    if name, ok := signalNames[status.Signal()]; ok {
+        return name
+    }
+    return strconv.Itoa(int(status.Signal()))
+}
+
+//------------------------------------------------------------------------------
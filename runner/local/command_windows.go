@@ -0,0 +1,50 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package local
+
+import (
+    "fmt"
+    "os"
+    "os/exec"
+    "strings"
+    "syscall"
+)
+
+//------------------------------------------------------------------------------
+
+func newCommand(command string) *exec.Cmd {
+    args := strings.Split(command, " ")
+    if args[0] == "cmd" {
+        // cmd has argument-escaping rules that are different from other programs, so needs different treatment
+        cmd := exec.Command(args[0])
+        cmd.SysProcAttr = &syscall.SysProcAttr{
+            CmdLine: " " + strings.Join(args[1:], " "),
+        }
+        return cmd
+    }
+
+    return exec.Command(args[0], args[1:]...)
+}
+
+func openTerminal(cmd *exec.Cmd, columns int, rows int) (*os.File, *os.File, error) {
+    return nil, nil, fmt.Errorf("pseudo-terminals are not supported on windows")
+}
+
+func killCommand(cmd *exec.Cmd) error {
+    if cmd.Process == nil {
+        return nil
+    }
+
+    return cmd.Process.Kill()
+}
+
+func signalName(state *os.ProcessState) string {
+    // processes are not terminated by signals on windows
+    return ""
+}
+
+//------------------------------------------------------------------------------
@@ -11,10 +11,16 @@ import (
     "errors"
     "fmt"
     "io"
+    "io/ioutil"
+    "os"
     "os/exec"
     "strings"
-    "syscall"
+    "time"
 
+    "github.com/stefaanc/golang-exec/runner/internal/become"
+    "github.com/stefaanc/golang-exec/runner/internal/decode"
+    "github.com/stefaanc/golang-exec/runner/internal/errs"
+    "github.com/stefaanc/golang-exec/runner/internal/watchdog"
     "github.com/stefaanc/golang-exec/script"
 )
 
@@ -35,9 +41,28 @@ type Runner struct {
     script  *script.Script
     command string
     cmd     *exec.Cmd
-    cancel  context.CancelFunc
+    running bool
+
+    env      []string   // from the arguments, when using script.WithEnvArguments()
+    extraEnv []string
+    cleanEnv bool
+    become   *become.Become
+    detector become.Detector   // detects when the become password or user is rejected
+
+    pty     bool
+    term    string
+    columns int
+    rows    int
+    ptmx    *os.File        // master side of the pseudo-terminal
+    output  chan struct{}   // closed when the output from the pseudo-terminal is copied
+
+    watchdog   watchdog.Watchdog
+    stdoutPipe *os.File     // write end of the pipe returned by StdoutPipe()
+    stderrPipe *os.File     // write end of the pipe returned by StderrPipe()
+    readers    []*os.File   // read ends of the pipes, closed when the script completes
 
     exitCode int
+    signal   string
 }
 
 //------------------------------------------------------------------------------
@@ -50,44 +75,74 @@ func (e *Error) Unwrap()   error          { return e.err }
 
 //------------------------------------------------------------------------------
 
+func ParseConnection(uri string) (*Connection, error) {
+    // parses "local://"
+    c := new(Connection)
+    err := decode.DecodeURI(uri, c)
+    if err != nil {
+        return nil, fmt.Errorf("[golang-exec/runner/local/ParseConnection()] invalid connection uri: %w\n", err)
+    }
+    if strings.ToLower(c.Type) != "local" {
+        return nil, errs.Wrap(errs.ErrConnection, fmt.Errorf("[golang-exec/runner/local/ParseConnection()] invalid connection uri, scheme must be \"local\"\n"))
+    }
+
+    return c, nil
+}
+
+func (c Connection) String() string {
+    return "local://"
+}
+
+//------------------------------------------------------------------------------
+
 func New(connection interface{}, s *script.Script, arguments interface{}) (*Runner, error) {
+    if connection != nil {
+        err := decode.Decode(connection, new(Connection))
+        if err != nil {
+            return nil, &Error{
+                script: s,
+                exitCode: -1,
+                err: fmt.Errorf("[golang-exec/runner/local/New()] invalid 'connection' parameter: %w\n", err),
+            }
+        }
+    }
+
     if s.Error != nil {
         return nil, &Error{
             script: s,
             exitCode: -1,
-            err: fmt.Errorf("[golang-exec/runner/local/New()] script failed to parse: %#w\n", s.Error),
+            err: fmt.Errorf("[golang-exec/runner/local/New()] script failed to parse: %w\n", errs.Wrap(errs.ErrParse, s.Error)),
         }
     }
 
     r := new(Runner)
     r.script = s
     r.command = s.Command()
+    r.watchdog.Timeout = s.Timeout   // from the front-matter of the script, can be overridden using SetTimeout()
 
     stdin, err := s.NewReader(arguments)
     if err != nil {
         return nil, &Error{
             script: s,
             exitCode: -1,
-            err: fmt.Errorf("[golang-exec/runner/local/New()] cannot create stdin reader: %#w\n", err),
+            err: fmt.Errorf("[golang-exec/runner/local/New()] cannot create stdin reader: %w\n", errs.Wrap(errs.ErrRender, err)),
         }
     }
 
-    // create command, ready to start
-    ctx, cancel := context.WithCancel(context.Background())
-    args := strings.Split(r.command, " ")
-    var cmd *exec.Cmd
-    if args[0] == "cmd" {
-        // cmd has argument-escaping rules that are different from other programs, so needs different treatment
-        cmd = exec.CommandContext(ctx, args[0])
-        cmd.SysProcAttr = &syscall.SysProcAttr{
-            CmdLine: " " + strings.Join(args[1:], " "),
-        }
-    } else {
-        cmd = exec.CommandContext(ctx, args[0], args[1:]...)
+    env, err := s.Environment(arguments)
+    if err != nil {
+        return nil, &Error{
+            script: s,
+            exitCode: -1,
+            err: fmt.Errorf("[golang-exec/runner/local/New()] cannot create environment: %w\n", errs.Wrap(errs.ErrRender, err)),
+        }
     }
+
+    // create command, ready to start
+    cmd := newCommand(r.command)
     r.cmd = cmd
     r.cmd.Stdin  = stdin
-    r.cancel = cancel
+    r.env = env
 
     return r, nil
 }
@@ -102,37 +157,118 @@ func (r *Runner) SetStderrWriter(stderr io.Writer) {
     r.cmd.Stderr = stderr
 }
 
+func (r *Runner) SetTimeout(timeout time.Duration) {
+    r.watchdog.Timeout = timeout
+}
+
+func (r *Runner) SetIdleTimeout(timeout time.Duration) {
+    r.watchdog.IdleTimeout = timeout
+}
+
+func (r *Runner) SetDir(dir string) {
+    r.cmd.Dir = dir
+}
+
+func (r *Runner) SetEnv(env []string) {
+    r.extraEnv = env
+}
+
+func (r *Runner) SetCleanEnv(clean bool) {
+    r.cleanEnv = clean
+}
+
+func (r *Runner) SetBecome(method string, user string, password string) {
+    r.become = &become.Become{ Method: method, User: user, Password: password }
+}
+
+func (r *Runner) SetPty(term string, columns int, rows int) {
+    // stdout and stderr of the script are attached to a pseudo-terminal, the script is still sent to stdin using a pipe
+    r.pty = true
+    r.term = term
+    r.columns = columns
+    r.rows = rows
+}
+
 func (r *Runner) StdoutPipe() (io.Reader, error) {
-    reader, err := r.cmd.StdoutPipe()
+    // like exec.Cmd.StdoutPipe(), but the pipe can also be used to read from a pseudo-terminal
+    var reader, writer *os.File
+    err := errors.New("Stdout already set")
+    if r.cmd.Stdout == nil {
+        reader, writer, err = os.Pipe()
+    }
     if err != nil {
         r.exitCode = -1
         return nil, &Error{
             script: r.script,
             exitCode: r.exitCode,
-            err: fmt.Errorf("[golang-exec/runner/local/StdoutPipe()] cannot create stdout reader: %#w\n", err),
+            err: fmt.Errorf("[golang-exec/runner/local/StdoutPipe()] cannot create stdout reader: %w\n", errs.Wrap(errs.ErrStart, err)),
         }
     }
+    r.cmd.Stdout = writer
+    r.stdoutPipe = writer
+    r.readers = append(r.readers, reader)
 
-    return reader, nil
+    return r.watchdog.Reader(reader), nil
 }
 
 func (r *Runner) StderrPipe() (io.Reader, error) {
-    reader, err := r.cmd.StderrPipe()
+    // like exec.Cmd.StderrPipe(), but the pipe can also be used to read from a pseudo-terminal
+    var reader, writer *os.File
+    err := errors.New("Stderr already set")
+    if r.cmd.Stderr == nil {
+        reader, writer, err = os.Pipe()
+    }
     if err != nil {
         r.exitCode = -1
         return nil, &Error{
             script: r.script,
             exitCode: r.exitCode,
-            err: fmt.Errorf("[golang-exec/runner/local/StderrPipe()] cannot create stderr reader: %#w\n", err),
+            err: fmt.Errorf("[golang-exec/runner/local/StderrPipe()] cannot create stderr reader: %w\n", errs.Wrap(errs.ErrStart, err)),
         }
     }
+    r.cmd.Stderr = writer
+    r.stderrPipe = writer
+    r.readers = append(r.readers, reader)
 
-    return reader, nil
+    return r.watchdog.Reader(r.detector.Reader(reader)), nil
 }
 
 func (r *Runner) Run() error {
-    err := r.cmd.Run()
+    return r.RunContext(context.Background())
+}
+
+func (r *Runner) RunContext(ctx context.Context) error {
+    err := r.start(ctx)
+    if err != nil {
+        r.exitCode = -1
+        if ctx.Err() != nil {
+            return &Error{
+                script: r.script,
+                command: r.command,
+                exitCode: r.exitCode,
+                err: fmt.Errorf("[golang-exec/runner/local/Run()] runner cancelled: %w\n", errs.FromContext(ctx.Err())),
+            }
+        }
+        return &Error{
+            script: r.script,
+            command: r.command,
+            exitCode: r.exitCode,
+            err: fmt.Errorf("[golang-exec/runner/local/Run()] cannot execute runner: %w\n", errs.Wrap(errs.ErrStart, err)),
+        }
+    }
+
+    err = r.wait()
     if err != nil {
+        if cause := r.watchdog.Err(); cause != nil {
+            r.exitCode = -1
+            return &Error{
+                script: r.script,
+                command: r.command,
+                exitCode: r.exitCode,
+                err: fmt.Errorf("[golang-exec/runner/local/Run()] runner cancelled: %w\n", cause),
+            }
+        }
+
         var exitErr *exec.ExitError
         if errors.As(err, &exitErr) {
             r.exitCode = exitErr.ProcessState.ExitCode()
@@ -140,7 +276,7 @@ func (r *Runner) Run() error {
                 script: r.script,
                 command: r.command,
                 exitCode: r.exitCode,
-                err: fmt.Errorf("[golang-exec/runner/local/Run()] runner failed: %#w\n", err),
+                err: fmt.Errorf("[golang-exec/runner/local/Run()] runner failed: %w\n", errs.Wrap(errs.ErrExit, err)),
             }
         } else {
             r.exitCode = -1
@@ -148,23 +284,36 @@ func (r *Runner) Run() error {
                 script: r.script,
                 command: r.command,
                 exitCode: r.exitCode,
-                err: fmt.Errorf("[golang-exec/runner/local/Run()] cannot execute runner: %#w\n", err),
+                err: fmt.Errorf("[golang-exec/runner/local/Run()] cannot execute runner: %w\n", err),
             }
         }
     }
 
+    r.exitCode = 0
     return nil
 }
 
 func (r *Runner) Start() error {
-    err := r.cmd.Start()
+    return r.StartContext(context.Background())
+}
+
+func (r *Runner) StartContext(ctx context.Context) error {
+    err := r.start(ctx)
     if err != nil {
         r.exitCode = -1
+        if ctx.Err() != nil {
+            return &Error{
+                script: r.script,
+                command: r.command,
+                exitCode: r.exitCode,
+                err: fmt.Errorf("[golang-exec/runner/local/Start()] runner cancelled: %w\n", errs.FromContext(ctx.Err())),
+            }
+        }
         return &Error{
             script: r.script,
             command: r.command,
             exitCode: r.exitCode,
-            err: fmt.Errorf("[golang-exec/runner/local/Start()] cannot start runner: %#w\n", err),
+            err: fmt.Errorf("[golang-exec/runner/local/Start()] cannot start runner: %w\n", errs.Wrap(errs.ErrStart, err)),
         }
     }
 
@@ -172,11 +321,22 @@ func (r *Runner) Start() error {
 }
 
 func (r *Runner) Wait() error {
-    err := r.cmd.Wait()
+    err := r.wait()
     if err != nil {
+        if cause := r.watchdog.Err(); cause != nil {
+            r.exitCode = -1
+            return &Error{
+                script: r.script,
+                command: r.command,
+                exitCode: r.exitCode,
+                err: fmt.Errorf("[golang-exec/runner/local/Wait()] runner cancelled: %w\n", cause),
+            }
+        }
+
         var exitErr  *exec.ExitError
         if errors.As(err, &exitErr) {
             r.exitCode = exitErr.ProcessState.ExitCode()
+            err = errs.Wrap(errs.ErrExit, err)
         } else {
             r.exitCode = -1
         }
@@ -184,7 +344,7 @@ func (r *Runner) Wait() error {
             script: r.script,
             command: r.command,
             exitCode: r.exitCode,
-            err: fmt.Errorf("[golang-exec/runner/local/Wait()] runner failed: %#w\n", err),
+            err: fmt.Errorf("[golang-exec/runner/local/Wait()] runner failed: %w\n", err),
         }
     }
 
@@ -193,8 +353,10 @@ func (r *Runner) Wait() error {
 }
 
 func (r *Runner) Close() error {
-    if r.cancel != nil {
-        r.cancel()
+    if r.running {
+        // wait for the killed process, so it doesn't remain a zombie, and release the pipes and the terminal
+        _ = killCommand(r.cmd)
+        _ = r.wait()
     }
 
     return nil
@@ -204,4 +366,226 @@ func (r *Runner) ExitCode() int {
     return r.exitCode
 }
 
+func (r *Runner) Signal() string {
+    return r.signal
+}
+
+func (r *Runner) Command() string {
+    return r.command
+}
+
+//------------------------------------------------------------------------------
+
+func (r *Runner) start(ctx context.Context) error {
+    if ctx.Err() != nil {
+        return ctx.Err()
+    }
+
+    if r.become != nil {
+        err := r.prepareBecome()
+        if err != nil {
+            return err
+        }
+    } else if r.env != nil || r.extraEnv != nil || r.cleanEnv || r.pty {
+        // the environment of this process is inherited when 'cmd.Env' is nil
+        for _, entry := range r.extraEnv {
+            if strings.Index(entry, "=") <= 0 {
+                return fmt.Errorf("invalid environment variable %q, must be \"NAME=value\"", entry)
+            }
+        }
+
+        env := []string{}
+        if !r.cleanEnv {
+            env = os.Environ()
+        }
+        if r.pty {
+            env = append(env, "TERM=" + r.terminalType())
+        }
+        r.cmd.Env = append(append(env, r.env...), r.extraEnv...)
+    }
+
+    if r.watchdog.IdleTimeout > 0 {
+        // register output from the script, also when the caller doesn't capture it
+        if r.stdoutPipe == nil {
+            if r.cmd.Stdout == nil {
+                r.cmd.Stdout = ioutil.Discard
+            }
+            r.cmd.Stdout = r.watchdog.Writer(r.cmd.Stdout)
+        }
+        if r.stderrPipe == nil {
+            if r.cmd.Stderr == nil {
+                r.cmd.Stderr = ioutil.Discard
+            }
+            r.cmd.Stderr = r.watchdog.Writer(r.cmd.Stderr)
+        }
+    }
+
+    var output io.Writer
+    var tty *os.File
+    if r.pty {
+        output = r.cmd.Stdout
+        if output == nil {
+            output = ioutil.Discard
+        }
+        if r.become != nil {
+            // the terminal merges stderr into stdout
+            output = r.detector.Writer(output)
+        }
+        if r.watchdog.IdleTimeout > 0 && r.stdoutPipe != nil {
+            // the runner copies the output of the terminal to the pipe, so it is registered before the caller reads it
+            output = r.watchdog.Writer(output)
+        }
+
+        columns, rows := r.terminalSize()
+        var err error
+        r.ptmx, tty, err = openTerminal(r.cmd, columns, rows)
+        if err != nil {
+            r.closePipes()
+            return err
+        }
+    }
+
+    err := r.cmd.Start()
+    if tty != nil {
+        _ = tty.Close()   // the shell has its own copy
+    }
+    if err != nil {
+        if r.ptmx != nil {
+            _ = r.ptmx.Close()
+        }
+        r.closePipes()
+        return err
+    }
+    r.running = true
+
+    // the shell has its own copies of the write ends of the pipes
+    if r.stderrPipe != nil {
+        _ = r.stderrPipe.Close()
+    }
+    if r.pty {
+        r.output = make(chan struct{})
+        go func() {
+            // reading fails when the shell and all processes started by the script closed the terminal
+            _, _ = io.Copy(output, r.ptmx)
+            if r.stdoutPipe != nil {
+                _ = r.stdoutPipe.Close()
+            }
+            close(r.output)
+        }()
+    } else if r.stdoutPipe != nil {
+        _ = r.stdoutPipe.Close()
+    }
+
+    // kill the process when 'ctx' is done, or when the script times out
+    r.watchdog.Start(ctx, func() {
+        _ = killCommand(r.cmd)
+    })
+
+    return nil
+}
+
+func (r *Runner) wait() error {
+    err := r.cmd.Wait()
+    if r.output != nil {
+        <-r.output
+        _ = r.ptmx.Close()
+    }
+    for _, reader := range r.readers {
+        _ = reader.Close()
+    }
+    r.watchdog.Stop()
+    r.running = false
+    if r.cmd.ProcessState != nil {
+        r.signal = signalName(r.cmd.ProcessState)
+    }
+
+    if err != nil && r.become != nil && r.detector.Failed() {
+        return r.become.Err()
+    }
+
+    return err
+}
+
+func (r *Runner) closePipes() {
+    // closes the pipes when the script fails to start
+    for _, pipe := range []*os.File{ r.stdoutPipe, r.stderrPipe } {
+        if pipe != nil {
+            _ = pipe.Close()
+        }
+    }
+    for _, reader := range r.readers {
+        _ = reader.Close()
+    }
+}
+
+func (r *Runner) terminalType() string {
+    if r.term == "" {
+        return "xterm"
+    }
+    return r.term
+}
+
+func (r *Runner) terminalSize() (int, int) {
+    columns, rows := r.columns, r.rows
+    if columns <= 0 {
+        columns = 80
+    }
+    if rows <= 0 {
+        rows = 24
+    }
+    return columns, rows
+}
+
+func (r *Runner) prepareBecome() error {
+    // wraps the shell in a command that runs it as another user
+    // sudo and su reset the environment, hence the environment is set by code that is prepended to the script
+    switch r.script.Shell {
+    case "cmd", "powershell", "pwsh":
+        return fmt.Errorf("become is not supported for shell %q", r.script.Shell)
+    }
+
+    stdin := r.cmd.Stdin
+    env := append(append([]string{}, r.env...), r.extraEnv...)
+    if r.pty {
+        env = append([]string{ "TERM=" + r.terminalType() }, env...)
+    }
+    if len(env) > 0 {
+        prologue, err := r.script.EnvPrologue(env)
+        if err != nil {
+            return err
+        }
+        stdin = io.MultiReader(strings.NewReader(prologue), stdin)
+    }
+
+    command := r.command
+    if r.cleanEnv {
+        command = "env -i " + command
+    }
+
+    code, err := r.become.Script(command)
+    if err != nil {
+        return err
+    }
+
+    path, err := exec.LookPath("sh")
+    if err != nil {
+        return err
+    }
+
+    r.command, _ = r.become.Command(command)
+    r.cmd.Path = path
+    r.cmd.Args = []string{ "sh", "-c", code }
+    r.cmd.Stdin = r.become.Stdin(stdin)
+
+    // detect when the password or the user is rejected, also when the caller doesn't capture stderr
+    if r.stderrPipe == nil {
+        if r.cmd.Stderr == nil {
+            r.cmd.Stderr = ioutil.Discard
+        }
+        r.cmd.Stderr = r.detector.Writer(r.cmd.Stderr)
+    }
+
+    return nil
+}
+
 //------------------------------------------------------------------------------
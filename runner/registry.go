@@ -0,0 +1,101 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package runner
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+    "sync"
+
+    "github.com/stefaanc/golang-exec/script"
+    "github.com/stefaanc/golang-exec/runner/dryrun"
+    "github.com/stefaanc/golang-exec/runner/local"
+    "github.com/stefaanc/golang-exec/runner/ssh"
+)
+
+//------------------------------------------------------------------------------
+
+// a factory creates a runner for a connection with a registered 'Type'
+type Factory func(connection interface{}, s *script.Script, arguments interface{}) (Runner, error)
+
+var (
+    factoriesMu sync.RWMutex
+    factories   = make(map[string]Factory)
+)
+
+//------------------------------------------------------------------------------
+
+func init() {
+    Register("local", func(connection interface{}, s *script.Script, arguments interface{}) (Runner, error) {
+        r, err := local.New(connection, s, arguments)
+        if err != nil {
+            return nil, err
+        }
+        return r, nil
+    })
+
+    Register("ssh", func(connection interface{}, s *script.Script, arguments interface{}) (Runner, error) {
+        r, err := ssh.New(connection, s, arguments)
+        if err != nil {
+            return nil, err
+        }
+        return r, nil
+    })
+
+    Register("dryrun", func(connection interface{}, s *script.Script, arguments interface{}) (Runner, error) {
+        r, err := dryrun.New(connection, s, arguments)
+        if err != nil {
+            return nil, err
+        }
+        return r, nil
+    })
+}
+
+//------------------------------------------------------------------------------
+
+func Register(cType string, factory Factory) {
+    // makes a runner available to New() and Run() for connections with 'Type' equal to 'cType' (case-insensitive)
+    // panics when 'factory' is nil or when 'cType' is already registered, like database/sql.Register()
+    cType = strings.ToLower(cType)
+
+    factoriesMu.Lock()
+    defer factoriesMu.Unlock()
+
+    if factory == nil {
+        panic(fmt.Sprintf("[golang-exec/runner/Register()] factory for type %q is nil", cType))
+    }
+    if _, ok := factories[cType]; ok {
+        panic(fmt.Sprintf("[golang-exec/runner/Register()] type %q is already registered", cType))
+    }
+
+    factories[cType] = factory
+}
+
+func Types() []string {
+    // returns the sorted list of registered connection types
+    factoriesMu.RLock()
+    defer factoriesMu.RUnlock()
+
+    types := make([]string, 0, len(factories))
+    for cType := range factories {
+        types = append(types, cType)
+    }
+    sort.Strings(types)
+
+    return types
+}
+
+func lookup(cType string) (Factory, bool) {
+    factoriesMu.RLock()
+    defer factoriesMu.RUnlock()
+
+    factory, ok := factories[strings.ToLower(cType)]
+    return factory, ok
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,134 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package runner_test
+
+import (
+    "bytes"
+    "errors"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/stefaanc/golang-exec/runner"
+    "github.com/stefaanc/golang-exec/runner/local"
+    "github.com/stefaanc/golang-exec/script"
+)
+
+//------------------------------------------------------------------------------
+
+type customConnection struct {
+    Type   string
+    Prefix string
+}
+
+func init() {
+    // a custom transport that runs the script locally, after prefixing its arguments
+    runner.Register("Test-Custom", func(connection interface{}, s *script.Script, arguments interface{}) (runner.Runner, error) {
+        c := connection.(*customConnection)
+        a := arguments.(testArguments)
+        a.Message = c.Prefix + a.Message
+        return runner.New(&local.Connection{ Type: "local" }, s, a)
+    })
+
+    // a transport that only implements the methods of runner.Runner, not the optional methods
+    runner.Register("Test-Minimal", func(connection interface{}, s *script.Script, arguments interface{}) (runner.Runner, error) {
+        r, err := runner.New(&local.Connection{ Type: "local" }, s, arguments)
+        if err != nil {
+            return nil, err
+        }
+        return &minimalRunner{ r }, nil
+    })
+}
+
+type minimalRunner struct {
+    runner.Runner
+}
+
+//------------------------------------------------------------------------------
+
+func TestRegister(t *testing.T) {
+    skipIfNoBash(t)
+
+    var stdout bytes.Buffer
+    err := runner.Run(&customConnection{ Type: "test-custom", Prefix: "custom " }, testScript, testArguments{
+        Message: "hello",
+    }, &stdout, nil)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    if got := strings.TrimSpace(stdout.String()); got != "stdout: custom hello" {
+        t.Errorf("stdout = %q, want %q", got, "stdout: custom hello")
+    }
+}
+
+func TestRegisterMinimal(t *testing.T) {
+    skipIfNoBash(t)
+
+    connection := map[string]string{ "Type": "test-minimal" }
+    var stdout bytes.Buffer
+    err := runner.Run(connection, testScript, testArguments{ Message: "hello" }, &stdout, nil)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if got := strings.TrimSpace(stdout.String()); got != "stdout: hello" {
+        t.Errorf("stdout = %q, want %q", got, "stdout: hello")
+    }
+
+    // options that need an optional method fail before running the script
+    options := map[string]runner.Option{
+        "SetTimeout(time.Duration)":     runner.WithTimeout(time.Minute),
+        "SetIdleTimeout(time.Duration)": runner.WithIdleTimeout(time.Minute),
+        "SetPty(term string, columns int, rows int)": runner.WithPty("", 0, 0),
+        "SetBecome(method string, user string, password string)": runner.WithBecome("sudo", "", ""),
+        "SetDir(string)":                runner.WithDir("/tmp"),
+        "SetEnv([]string)":              runner.WithEnv("A=b"),
+        "SetCleanEnv(bool)":             runner.WithCleanEnv(),
+    }
+    for method, option := range options {
+        stdout.Reset()
+        err = runner.Run(connection, testScript, testArguments{ Message: "hello" }, &stdout, nil, option)
+        if !errors.Is(err, runner.ErrUnsupported) || !strings.Contains(err.Error(), method) {
+            t.Errorf("error %v is not an unsupported option error for %s", err, method)
+        }
+        if stdout.Len() != 0 {
+            t.Errorf("stdout = %q, want no output", stdout.String())
+        }
+    }
+
+    // the result doesn't have the command and the signal
+    result, err := runner.Output(connection, testScript, testArguments{ Message: "hello" })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if result.Command != "" || result.Signal != "" || strings.TrimSpace(result.Stdout) != "stdout: hello" {
+        t.Errorf("result = %+v", result)
+    }
+}
+
+func TestRegisterDuplicate(t *testing.T) {
+    defer func() {
+        if recover() == nil {
+            t.Error("expected a panic when registering a duplicate type")
+        }
+    }()
+
+    runner.Register("SSH", func(connection interface{}, s *script.Script, arguments interface{}) (runner.Runner, error) {
+        return nil, nil
+    })
+}
+
+func TestTypes(t *testing.T) {
+    types := strings.Join(runner.Types(), ",")
+    for _, want := range []string{ "local", "ssh", "dryrun", "test-custom" } {
+        if !strings.Contains(types, want) {
+            t.Errorf("types %q don't contain %q", types, want)
+        }
+    }
+}
+
+//------------------------------------------------------------------------------
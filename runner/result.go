@@ -0,0 +1,80 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package runner
+
+import (
+    "bytes"
+    "context"
+    "time"
+
+    "github.com/stefaanc/golang-exec/script"
+)
+
+//------------------------------------------------------------------------------
+
+type Result struct {
+    Command   string          // command that executes the shell, "" when the runner couldn't be created
+    Stdout    string
+    Stderr    string
+    ExitCode  int             // -1 when runner error without completing script
+    Signal    string          // name of the signal that terminated the script, "" when not terminated by a signal
+    StartTime time.Time       // zero when the runner couldn't be created
+    EndTime   time.Time       // zero when the runner couldn't be created
+    Duration  time.Duration
+}
+
+//------------------------------------------------------------------------------
+
+func Output(connection interface {}, s *script.Script, arguments interface{}, options ...Option) (*Result, error) {
+    return OutputContext(context.Background(), connection, s, arguments, options...)
+}
+
+func OutputContext(ctx context.Context, connection interface {}, s *script.Script, arguments interface{}, options ...Option) (*Result, error) {
+    // runs the script and returns its result, also when the script fails
+    r, err := New(connection, s, arguments)
+    if err != nil {
+        return &Result{ ExitCode: -1 }, err
+    }
+    defer r.Close()
+
+    err = Apply(r, options...)
+    if err != nil {
+        return &Result{ ExitCode: -1 }, err
+    }
+
+    return RunResult(ctx, r)
+}
+
+func RunResult(ctx context.Context, r Runner) (*Result, error) {
+    // runs a runner created using New() and returns its result, also when the script fails
+    // stdout and stderr are captured in the result, replacing any writers set on the runner
+    var stdout bytes.Buffer
+    var stderr bytes.Buffer
+    r.SetStdoutWriter(&stdout)
+    r.SetStderrWriter(&stderr)
+
+    result := new(Result)
+    result.StartTime = time.Now()
+    err := r.RunContext(ctx)
+    result.EndTime = time.Now()
+
+    // the command and the signal are optional methods of a runner
+    if c, ok := r.(interface{ Command() string }); ok {
+        result.Command = c.Command()
+    }
+    result.Stdout = stdout.String()
+    result.Stderr = stderr.String()
+    result.ExitCode = r.ExitCode()
+    if s, ok := r.(interface{ Signal() string }); ok {
+        result.Signal = s.Signal()
+    }
+    result.Duration = result.EndTime.Sub(result.StartTime)
+
+    return result, err
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,121 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package runner_test
+
+import (
+    "context"
+    "errors"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/stefaanc/golang-exec/runner"
+    "github.com/stefaanc/golang-exec/runner/local"
+    "github.com/stefaanc/golang-exec/script"
+)
+
+//------------------------------------------------------------------------------
+
+func TestOutputLocal(t *testing.T) {
+    skipIfNoBash(t)
+
+    result, err := runner.Output(&local.Connection{ Type: "local" }, testScript, testArguments{
+        Message: "result",
+    })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    if result.Command != "bash -" {
+        t.Errorf("command = %q, want %q", result.Command, "bash -")
+    }
+    if strings.TrimSpace(result.Stdout) != "stdout: result" {
+        t.Errorf("stdout = %q, want %q", result.Stdout, "stdout: result")
+    }
+    if strings.TrimSpace(result.Stderr) != "stderr: result" {
+        t.Errorf("stderr = %q, want %q", result.Stderr, "stderr: result")
+    }
+    if result.ExitCode != 0 || result.Signal != "" {
+        t.Errorf("exitcode = %d, signal = %q, want 0 and no signal", result.ExitCode, result.Signal)
+    }
+    if result.StartTime.IsZero() || result.EndTime.Before(result.StartTime) || result.Duration != result.EndTime.Sub(result.StartTime) {
+        t.Errorf("invalid timing: start %v, end %v, duration %v", result.StartTime, result.EndTime, result.Duration)
+    }
+}
+
+func TestOutputLocalFailure(t *testing.T) {
+    skipIfNoBash(t)
+
+    result, err := runner.Output(&local.Connection{ Type: "local" }, testScript, testArguments{
+        Message: "failed",
+        ExitCode: 4,
+    })
+    if !errors.Is(err, runner.ErrExit) {
+        t.Fatalf("error %v is not an exit error", err)
+    }
+
+    if result.ExitCode != 4 {
+        t.Errorf("exitcode = %d, want 4", result.ExitCode)
+    }
+    if strings.TrimSpace(result.Stderr) != "stderr: failed" {
+        t.Errorf("stderr = %q, want %q", result.Stderr, "stderr: failed")
+    }
+}
+
+func TestOutputLocalSignal(t *testing.T) {
+    skipIfNoBash(t)
+
+    signalScript := script.New("signal", "bash", `
+        echo "terminating"
+        kill -TERM $$
+    `)
+
+    result, err := runner.Output(&local.Connection{ Type: "local" }, signalScript, nil)
+    if err == nil {
+        t.Fatal("expected an error")
+    }
+
+    if result.Signal != "TERM" {
+        t.Errorf("signal = %q, want %q", result.Signal, "TERM")
+    }
+    if strings.TrimSpace(result.Stdout) != "terminating" {
+        t.Errorf("stdout = %q, want %q", result.Stdout, "terminating")
+    }
+}
+
+func TestOutputContextLocalTimeout(t *testing.T) {
+    skipIfNoBash(t)
+
+    sleepScript := script.New("sleep", "bash", `
+        echo "sleeping"
+        sleep 10
+    `)
+
+    result, err := runner.OutputContext(context.Background(), &local.Connection{ Type: "local" }, sleepScript, nil, runner.WithTimeout(200 * time.Millisecond))
+    if !errors.Is(err, runner.ErrTimeout) {
+        t.Fatalf("error %v is not a timeout error", err)
+    }
+
+    if result.ExitCode != -1 || result.Signal != "KILL" {
+        t.Errorf("exitcode = %d, signal = %q, want -1 and %q", result.ExitCode, result.Signal, "KILL")
+    }
+    if strings.TrimSpace(result.Stdout) != "sleeping" {
+        t.Errorf("stdout = %q, want %q", result.Stdout, "sleeping")
+    }
+}
+
+func TestOutputInvalidConnection(t *testing.T) {
+    result, err := runner.Output(map[string]string{ "Type": "unknown" }, testScript, nil)
+    if err == nil {
+        t.Fatal("expected an error")
+    }
+    if result == nil || result.ExitCode != -1 {
+        t.Errorf("result = %+v, want exitcode -1", result)
+    }
+}
+
+//------------------------------------------------------------------------------
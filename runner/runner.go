@@ -7,18 +7,37 @@
 package runner
 
 import (
+    "context"
     "fmt"
     "io"
-    "reflect"
-    "strings"
+    "time"
 
     "github.com/stefaanc/golang-exec/script"
-    "github.com/stefaanc/golang-exec/runner/local"
-    "github.com/stefaanc/golang-exec/runner/ssh"
+    "github.com/stefaanc/golang-exec/runner/internal/decode"
+    "github.com/stefaanc/golang-exec/runner/internal/errs"
 )
 
 //------------------------------------------------------------------------------
 
+// errors wrapped by a runner.Error, shared by all runners
+// use errors.Is() to test for them, for instance to retry only when failing to connect
+var (
+    ErrConnection  = errs.ErrConnection    // 'connection' parameter is invalid
+    ErrDial        = errs.ErrDial          // cannot connect to the host
+    ErrAuth        = errs.ErrAuth          // cannot authenticate with the host
+    ErrHostKey     = errs.ErrHostKey       // host key is rejected
+    ErrSession     = errs.ErrSession       // cannot open a session on the host, or the session failed while running the script
+    ErrParse       = errs.ErrParse         // script template failed to parse
+    ErrRender      = errs.ErrRender        // script template failed to render with the arguments
+    ErrStart       = errs.ErrStart         // shell failed to start
+    ErrExit        = errs.ErrExit          // script completed with a non-zero exitcode
+    ErrTimeout     = errs.ErrTimeout       // script ran longer than the timeout, or the deadline of the context expired, also for idle timeouts
+    ErrIdleTimeout = errs.ErrIdleTimeout   // script didn't produce output on stdout or stderr for longer than the idle timeout
+    ErrCancelled   = errs.ErrCancelled     // context was cancelled
+    ErrBecome      = errs.ErrBecome        // become password is incorrect, or not allowed to become the user
+    ErrUnsupported = errs.ErrUnsupported   // runner doesn't support an option, for instance a registered runner without SetTimeout() for WithTimeout()
+)
+
 type Error interface {
     Script() *script.Script
     Command() string
@@ -27,6 +46,8 @@ type Error interface {
     Unwrap() error
 }
 
+// the methods that every runner implements, including the runners registered using Register()
+// the options and RunResult() use optional methods, see below
 type Runner interface {
     SetStdoutWriter(io.Writer)
     SetStderrWriter(io.Writer)
@@ -34,18 +55,141 @@ type Runner interface {
     StderrPipe() (io.Reader, error)   // use in combination with Start() & Wait(), don't use in combination with Run()
 
     Run() error
+    RunContext(context.Context) error     // cancelling the context terminates the script
     Start() error
+    StartContext(context.Context) error   // cancelling the context terminates the script
     Wait() error
     Close() error
 
     ExitCode() int   // -1 when runner error without completing script
 }
 
+// optional methods of a runner, use before Run() or Start()
+//
+//     SetTimeout(time.Duration)       // 0 when no timeout
+//     SetIdleTimeout(time.Duration)   // 0 when no idle timeout, output on StdoutPipe() or StderrPipe() may only count when it is read
+//     SetDir(string)                  // working directory of the script, "" for the default directory
+//     SetEnv([]string)                // extra environment variables of the script as "NAME=value"
+//     SetCleanEnv(bool)               // don't inherit the environment, only use the extra environment variables
+//     SetBecome(method string, user string, password string)   // run the script as another user, using "sudo" or "su"
+//     SetPty(term string, columns int, rows int)                // attach the script to a pseudo-terminal, "" for "xterm", 0 for 80 columns and 24 rows
+//
+// optional methods of a runner, use after Run() or Wait()
+//
+//     Signal() string    // name of the signal that terminated the script, as used by ssh ("TERM", "KILL", ...), "" when not terminated by a signal
+//     Command() string   // command that executes the shell
+//
+// an option returns an error wrapping ErrUnsupported when the runner doesn't have its method, "WithTimeout()" needs "SetTimeout(time.Duration)", ...
+// RunResult() leaves the command and the signal of the result empty when the runner doesn't have their methods
+type Option func(Runner) error
+
+//------------------------------------------------------------------------------
+
+func WithTimeout(timeout time.Duration) Option {
+    return func(r Runner) error {
+        setter, ok := r.(interface{ SetTimeout(time.Duration) })
+        if !ok {
+            return unsupported(r, "WithTimeout", "SetTimeout(time.Duration)")
+        }
+        setter.SetTimeout(timeout)
+        return nil
+    }
+}
+
+func WithIdleTimeout(timeout time.Duration) Option {
+    // output to the writers passed to SetStdoutWriter() and SetStderrWriter() counts when the script writes it
+    // output on the readers returned by StdoutPipe() and StderrPipe() may only count when the caller reads it, because the
+    // runner doesn't read the pipes, hence a caller that stops reading a pipe can make the script time out
+    return func(r Runner) error {
+        setter, ok := r.(interface{ SetIdleTimeout(time.Duration) })
+        if !ok {
+            return unsupported(r, "WithIdleTimeout", "SetIdleTimeout(time.Duration)")
+        }
+        setter.SetIdleTimeout(timeout)
+        return nil
+    }
+}
+
+func WithDir(dir string) Option {
+    return func(r Runner) error {
+        setter, ok := r.(interface{ SetDir(string) })
+        if !ok {
+            return unsupported(r, "WithDir", "SetDir(string)")
+        }
+        setter.SetDir(dir)
+        return nil
+    }
+}
+
+func WithEnv(env ...string) Option {
+    return func(r Runner) error {
+        setter, ok := r.(interface{ SetEnv([]string) })
+        if !ok {
+            return unsupported(r, "WithEnv", "SetEnv([]string)")
+        }
+        setter.SetEnv(env)
+        return nil
+    }
+}
+
+func WithCleanEnv() Option {
+    return func(r Runner) error {
+        setter, ok := r.(interface{ SetCleanEnv(bool) })
+        if !ok {
+            return unsupported(r, "WithCleanEnv", "SetCleanEnv(bool)")
+        }
+        setter.SetCleanEnv(true)
+        return nil
+    }
+}
+
+func WithBecome(method string, user string, password string) Option {
+    return func(r Runner) error {
+        setter, ok := r.(interface{ SetBecome(string, string, string) })
+        if !ok {
+            return unsupported(r, "WithBecome", "SetBecome(method string, user string, password string)")
+        }
+        setter.SetBecome(method, user, password)
+        return nil
+    }
+}
+
+func WithPty(term string, columns int, rows int) Option {
+    return func(r Runner) error {
+        setter, ok := r.(interface{ SetPty(string, int, int) })
+        if !ok {
+            return unsupported(r, "WithPty", "SetPty(term string, columns int, rows int)")
+        }
+        setter.SetPty(term, columns, rows)
+        return nil
+    }
+}
+
+func unsupported(r Runner, option string, method string) error {
+    return errs.Wrap(errs.ErrUnsupported, fmt.Errorf("[golang-exec/runner/%s()] runner %T doesn't support this option, it has no method %s\n", option, r, method))
+}
+
+func Apply(r Runner, options ...Option) error {
+    // applies the options to a runner created using New(), use before Run() or Start()
+    for _, option := range options {
+        err := option(r)
+        if err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
 //------------------------------------------------------------------------------
 
-func Run(connection interface {}, s *script.Script, arguments interface{}, stdout, stderr io.Writer) error {
+func Run(connection interface {}, s *script.Script, arguments interface{}, stdout, stderr io.Writer, options ...Option) error {
+    return RunContext(context.Background(), connection, s, arguments, stdout, stderr, options...)
+}
+
+func RunContext(ctx context.Context, connection interface {}, s *script.Script, arguments interface{}, stdout, stderr io.Writer, options ...Option) error {
     if s.Error != nil {
-        return s.Error
+        return errs.Wrap(errs.ErrParse, s.Error)
     }
 
     r, err := New(connection, s, arguments)
@@ -62,7 +206,12 @@ func Run(connection interface {}, s *script.Script, arguments interface{}, stdou
         r.SetStderrWriter(stderr)
     }
 
-    err = r.Run()
+    err = Apply(r, options...)
+    if err != nil {
+        return err
+    }
+
+    err = r.RunContext(ctx)
     if err != nil {
         return err
     }
@@ -72,31 +221,20 @@ func Run(connection interface {}, s *script.Script, arguments interface{}, stdou
 
 func New(connection interface {}, s *script.Script, arguments interface{}) (Runner, error) {
     if s.Error != nil {
-        return nil, s.Error
-    }
-
-    var cType string
-    v := reflect.Indirect(reflect.ValueOf(connection))
-    if v.Kind() == reflect.Struct {
-        cType = strings.ToLower(v.FieldByName("Type").String())
-    } else {   // panics if not a map
-        iter := v.MapRange()
-        for iter.Next() {
-            if iter.Key().String() == "Type" {
-                cType = strings.ToLower(iter.Value().String())
-                break
-            }
-        }
+        return nil, errs.Wrap(errs.ErrParse, s.Error)
     }
 
-    switch cType {
-    case "local":
-        return local.New(connection, s, arguments)
-    case "ssh":
-        return ssh.New(connection, s, arguments)
-    default:
-        return nil, fmt.Errorf("[golang-exec/runner/New()] invalid 'Type' in 'connection' parameter")
+    cType, err := decode.Type(connection)
+    if err != nil {
+        return nil, fmt.Errorf("[golang-exec/runner/New()] invalid 'connection' parameter: %w\n", err)
     }
+
+    factory, ok := lookup(cType)
+    if !ok {
+        return nil, errs.Wrap(errs.ErrConnection, fmt.Errorf("[golang-exec/runner/New()] invalid 'Type' in 'connection' parameter, registered types are %q\n", Types()))
+    }
+
+    return factory(connection, s, arguments)
 }
 
 //------------------------------------------------------------------------------
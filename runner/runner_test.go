@@ -0,0 +1,710 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package runner_test
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "io/ioutil"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/stefaanc/golang-exec/runner"
+    "github.com/stefaanc/golang-exec/runner/local"
+    "github.com/stefaanc/golang-exec/script"
+)
+
+//------------------------------------------------------------------------------
+
+type testArguments struct {
+    Message  string
+    ExitCode int
+}
+
+var testScript = script.New("test", "bash", `
+    set -e -o pipefail
+
+    echo "stdout: {{.Message}}"
+    echo "stderr: {{.Message}}" >&2
+
+    exit {{.ExitCode}}
+`)
+
+func skipIfNoBash(t *testing.T) {
+    t.Helper()
+    if _, err := exec.LookPath("bash"); err != nil {
+        t.Skip("bash not found on this host")
+    }
+}
+
+//------------------------------------------------------------------------------
+
+func TestRunLocal(t *testing.T) {
+    skipIfNoBash(t)
+
+    var stdout, stderr bytes.Buffer
+    err := runner.Run(&local.Connection{ Type: "local" }, testScript, testArguments{
+        Message: "hello",
+    }, &stdout, &stderr)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    if got := strings.TrimSpace(stdout.String()); got != "stdout: hello" {
+        t.Errorf("stdout = %q, want %q", got, "stdout: hello")
+    }
+    if got := strings.TrimSpace(stderr.String()); got != "stderr: hello" {
+        t.Errorf("stderr = %q, want %q", got, "stderr: hello")
+    }
+}
+
+func TestRunLocalMapConnection(t *testing.T) {
+    skipIfNoBash(t)
+
+    var stdout bytes.Buffer
+    err := runner.Run(map[string]string{ "Type": "Local" }, testScript, testArguments{
+        Message: "map",
+    }, &stdout, nil)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    if got := strings.TrimSpace(stdout.String()); got != "stdout: map" {
+        t.Errorf("stdout = %q, want %q", got, "stdout: map")
+    }
+}
+
+func TestRunLocalExitCode(t *testing.T) {
+    skipIfNoBash(t)
+
+    var stdout, stderr bytes.Buffer
+    err := runner.Run(&local.Connection{ Type: "local" }, testScript, testArguments{
+        Message: "failed",
+        ExitCode: 3,
+    }, &stdout, &stderr)
+    if err == nil {
+        t.Fatal("expected an error")
+    }
+
+    if !errors.Is(err, runner.ErrExit) {
+        t.Errorf("error %q is not an exit error", err)
+    }
+
+    var runnerErr runner.Error
+    if !errors.As(err, &runnerErr) {
+        t.Fatalf("error %T does not implement runner.Error", err)
+    }
+    if runnerErr.ExitCode() != 3 {
+        t.Errorf("exitcode = %d, want 3", runnerErr.ExitCode())
+    }
+    if runnerErr.Script() != testScript {
+        t.Errorf("error does not reference the script")
+    }
+    if got := strings.TrimSpace(stderr.String()); got != "stderr: failed" {
+        t.Errorf("stderr = %q, want %q", got, "stderr: failed")
+    }
+}
+
+func TestNewLocalStartWait(t *testing.T) {
+    skipIfNoBash(t)
+
+    r, err := runner.New(local.Connection{ Type: "local" }, testScript, testArguments{
+        Message: "pipe",
+    })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    defer r.Close()
+
+    stdout, err := r.StdoutPipe()
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    if err := r.Start(); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    var result bytes.Buffer
+    if _, err := result.ReadFrom(stdout); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    if err := r.Wait(); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    if r.ExitCode() != 0 {
+        t.Errorf("exitcode = %d, want 0", r.ExitCode())
+    }
+    if got := strings.TrimSpace(result.String()); got != "stdout: pipe" {
+        t.Errorf("stdout = %q, want %q", got, "stdout: pipe")
+    }
+}
+
+func TestNewLocalClose(t *testing.T) {
+    skipIfNoBash(t)
+
+    sleepScript := script.New("sleep", "bash", `sleep 10`)
+
+    r, err := runner.New(local.Connection{ Type: "local" }, sleepScript, nil)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    if err := r.Start(); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    // the killed script is waited for
+    if err := r.Close(); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if got := r.(interface{ Signal() string }).Signal(); got != "KILL" {
+        t.Errorf("signal = %q, want %q", got, "KILL")
+    }
+}
+
+func TestRunContextLocalCancel(t *testing.T) {
+    skipIfNoBash(t)
+
+    sleepScript := script.New("sleep", "bash", `
+        sleep 10
+    `)
+
+    ctx, cancel := context.WithTimeout(context.Background(), 100 * time.Millisecond)
+    defer cancel()
+
+    var stdout, stderr bytes.Buffer
+    start := time.Now()
+    err := runner.RunContext(ctx, &local.Connection{ Type: "local" }, sleepScript, nil, &stdout, &stderr)
+    if err == nil {
+        t.Fatal("expected an error")
+    }
+    if time.Since(start) > 5 * time.Second {
+        t.Errorf("script was not terminated when the context was done")
+    }
+
+    if !errors.Is(err, context.DeadlineExceeded) {
+        t.Errorf("error %q does not report the cancellation cause", err)
+    }
+    if !errors.Is(err, runner.ErrTimeout) || errors.Is(err, runner.ErrCancelled) {
+        t.Errorf("error %q is not a timeout error", err)
+    }
+
+    var runnerErr runner.Error
+    if !errors.As(err, &runnerErr) {
+        t.Fatalf("error %T does not implement runner.Error", err)
+    }
+    if runnerErr.ExitCode() != -1 {
+        t.Errorf("exitcode = %d, want -1", runnerErr.ExitCode())
+    }
+}
+
+func TestRunLocalTimeout(t *testing.T) {
+    skipIfNoBash(t)
+
+    slowScript := script.New("slow", "bash", `
+        echo "started"
+        while true; do
+            echo "working"
+            sleep 0.05
+        done
+    `)
+
+    var stdout bytes.Buffer
+    err := runner.Run(&local.Connection{ Type: "local" }, slowScript, nil, &stdout, nil, runner.WithTimeout(300 * time.Millisecond))
+    if !errors.Is(err, runner.ErrTimeout) {
+        t.Fatalf("error %v is not a timeout error", err)
+    }
+    if errors.Is(err, runner.ErrIdleTimeout) {
+        t.Errorf("error %q must not be an idle timeout error", err)
+    }
+
+    if !strings.HasPrefix(stdout.String(), "started\nworking\n") {
+        t.Errorf("partial output %q is not available", stdout.String())
+    }
+}
+
+func TestRunLocalIdleTimeout(t *testing.T) {
+    skipIfNoBash(t)
+
+    promptScript := script.New("prompt", "bash", `
+        echo "waiting for input"
+        sleep 10
+    `)
+
+    var stdout bytes.Buffer
+    start := time.Now()
+    err := runner.Run(&local.Connection{ Type: "local" }, promptScript, nil, &stdout, nil, runner.WithIdleTimeout(200 * time.Millisecond))
+    if !errors.Is(err, runner.ErrIdleTimeout) {
+        t.Fatalf("error %v is not an idle timeout error", err)
+    }
+    if time.Since(start) > 5 * time.Second {
+        t.Errorf("script was not terminated by the idle timeout")
+    }
+
+    if got := strings.TrimSpace(stdout.String()); got != "waiting for input" {
+        t.Errorf("partial output = %q, want %q", got, "waiting for input")
+    }
+}
+
+func TestRunLocalIdleTimeoutWithOutput(t *testing.T) {
+    skipIfNoBash(t)
+
+    busyScript := script.New("busy", "bash", `
+        for i in 1 2 3 4 5 6; do
+            echo "tick $i" >&2
+            sleep 0.1
+        done
+    `)
+
+    err := runner.Run(&local.Connection{ Type: "local" }, busyScript, nil, nil, nil, runner.WithIdleTimeout(400 * time.Millisecond))
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+}
+
+func TestRunLocalIdleTimeoutWithPtyPipe(t *testing.T) {
+    skipIfNoBash(t)
+
+    busyScript := script.New("busy", "bash", `
+        for i in 1 2 3 4 5 6; do
+            echo "tick $i"
+            sleep 0.1
+        done
+    `)
+
+    r, err := runner.New(&local.Connection{ Type: "local" }, busyScript, nil)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    defer r.Close()
+
+    err = runner.Apply(r, runner.WithPty("", 0, 0), runner.WithIdleTimeout(400 * time.Millisecond))
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    // the runner copies the output of the terminal to the pipe, so the output counts although the pipe is not read
+    _, err = r.StdoutPipe()
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    err = r.Run()
+    if err != nil {
+        t.Errorf("unexpected error: %v", err)
+    }
+}
+
+func TestRunContextLocalCancelled(t *testing.T) {
+    skipIfNoBash(t)
+
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+
+    err := runner.RunContext(ctx, &local.Connection{ Type: "local" }, testScript, testArguments{}, nil, nil)
+    if !errors.Is(err, runner.ErrCancelled) || !errors.Is(err, context.Canceled) {
+        t.Errorf("error %v is not a cancelled error", err)
+    }
+    if errors.Is(err, runner.ErrExit) || errors.Is(err, runner.ErrTimeout) {
+        t.Errorf("error %q matches the wrong sentinel", err)
+    }
+}
+
+func TestRunLocalErrors(t *testing.T) {
+    skipIfNoBash(t)
+
+    tests := []struct {
+        name      string
+        script    *script.Script
+        arguments interface{}
+        want      error
+    }{
+        { "parse",  script.New("parse", "bash", `echo "{{.Message"`), testArguments{}, runner.ErrParse },
+        { "render", testScript, struct{ Other string }{}, runner.ErrRender },
+        { "start",  script.New("start", "no-such-shell", `echo`), nil, runner.ErrStart },
+        { "exit",   testScript, testArguments{ ExitCode: 1 }, runner.ErrExit },
+    }
+
+    for _, test := range tests {
+        err := runner.Run(&local.Connection{ Type: "local" }, test.script, test.arguments, nil, nil)
+        if !errors.Is(err, test.want) {
+            t.Errorf("%s: error %v does not match %v", test.name, err, test.want)
+        }
+    }
+}
+
+func TestNewInvalidType(t *testing.T) {
+    _, err := runner.New(map[string]string{ "Type": "unknown" }, testScript, nil)
+    if !errors.Is(err, runner.ErrConnection) {
+        t.Fatalf("error %v does not match %v", err, runner.ErrConnection)
+    }
+}
+
+func TestNewInvalidConnection(t *testing.T) {
+    tests := []struct {
+        name       string
+        connection interface{}
+    }{
+        { "nil",          nil },
+        { "string",       "local" },
+        { "int keys",     map[int]string{ 0: "local" } },
+        { "missing type", map[string]string{ "Host": "localhost" } },
+        { "ssh port",     map[string]interface{}{ "Type": "ssh", "Host": "localhost", "Port": "ssh" } },
+        { "ssh host",     map[string]interface{}{ "Type": "ssh", "Port": 22 } },
+    }
+
+    for _, test := range tests {
+        _, err := runner.New(test.connection, testScript, testArguments{})
+        if !errors.Is(err, runner.ErrConnection) {
+            t.Errorf("%s: error %v does not match %v", test.name, err, runner.ErrConnection)
+        }
+    }
+}
+
+func TestRunLocalTaggedConnection(t *testing.T) {
+    skipIfNoBash(t)
+
+    type target struct {
+        Kind string `exec:"type"`
+    }
+    type myConnection struct {
+        target
+        Name string `exec:"-"`
+    }
+
+    var stdout bytes.Buffer
+    err := runner.Run(&myConnection{ target: target{ Kind: "local" }, Name: "ignored" }, testScript, testArguments{
+        Message: "tagged",
+    }, &stdout, nil)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    if got := strings.TrimSpace(stdout.String()); got != "stdout: tagged" {
+        t.Errorf("stdout = %q, want %q", got, "stdout: tagged")
+    }
+}
+
+func TestRunDryRun(t *testing.T) {
+    var stdout, stderr bytes.Buffer
+    err := runner.Run(map[string]string{ "Type": "dryrun" }, testScript, testArguments{
+        Message: "hello",
+        ExitCode: 3,
+    }, &stdout, &stderr)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    code, _ := testScript.Render(testArguments{ Message: "hello", ExitCode: 3 })
+    want := "command: bash -\nstdin:\n" + code
+    if stdout.String() != want {
+        t.Errorf("stdout = %q, want %q", stdout.String(), want)
+    }
+    if stderr.Len() != 0 {
+        t.Errorf("stderr = %q, want \"\"", stderr.String())
+    }
+}
+
+func TestNewDryRunPipe(t *testing.T) {
+    r, err := runner.New(map[string]string{ "Type": "dryrun" }, testScript, testArguments{ Message: "pipe" })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    defer r.Close()
+
+    stdout, _ := r.StdoutPipe()
+    stderr, _ := r.StderrPipe()
+    if err := r.Start(); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    var output, errput bytes.Buffer
+    _, _ = output.ReadFrom(stdout)
+    _, _ = errput.ReadFrom(stderr)
+    if err := r.Wait(); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    command := r.(interface{ Command() string }).Command()
+    if r.ExitCode() != 0 || command != "bash -" {
+        t.Errorf("exitcode = %d, command = %q, want 0, %q", r.ExitCode(), command, "bash -")
+    }
+    if !strings.Contains(output.String(), `echo "stdout: pipe"`) || errput.Len() != 0 {
+        t.Errorf("stdout = %q, stderr = %q", output.String(), errput.String())
+    }
+}
+
+func TestNewDryRunErrors(t *testing.T) {
+    _, err := runner.New(map[string]string{ "Type": "dryrun" }, testScript, struct{ Other string }{})
+    if !errors.Is(err, runner.ErrRender) {
+        t.Errorf("error %v does not match %v", err, runner.ErrRender)
+    }
+
+    _, err = runner.New(map[string]string{ "Type": "dryrun" }, script.New("parse", "bash", `{{.Message`), nil)
+    if !errors.Is(err, runner.ErrParse) {
+        t.Errorf("error %v does not match %v", err, runner.ErrParse)
+    }
+}
+
+func TestRunLocalEnvArguments(t *testing.T) {
+    skipIfNoBash(t)
+
+    envScript := script.New("env", "bash", `printf '[%s]' "$ARG_MESSAGE" "$ARG_EXIT_CODE"`, script.WithEnvArguments())
+    message := "it's \"quoted\" $(touch injected) `id`\nnext line"
+
+    var stdout bytes.Buffer
+    err := runner.Run(&local.Connection{ Type: "local" }, envScript, testArguments{ Message: message, ExitCode: 3 }, &stdout, nil)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    want := "[" + message + "][3]"
+    if stdout.String() != want {
+        t.Errorf("stdout = %q, want %q", stdout.String(), want)
+    }
+}
+
+func TestRunLocalDirEnv(t *testing.T) {
+    skipIfNoBash(t)
+
+    dir, err := ioutil.TempDir("", "runner")
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    defer os.RemoveAll(dir)
+    dir, _ = filepath.EvalSymlinks(dir)
+
+    os.Setenv("TEST_RUNNER_INHERITED", "inherited")
+    defer os.Unsetenv("TEST_RUNNER_INHERITED")
+
+    envScript := script.New("env", "bash", `printf '[%s]' "$PWD" "$TEST_RUNNER_INHERITED" "$TEST_RUNNER_EXTRA"`)
+
+    var stdout bytes.Buffer
+    err = runner.Run(&local.Connection{ Type: "local" }, envScript, nil, &stdout, nil, runner.WithDir(dir), runner.WithEnv("TEST_RUNNER_EXTRA=it's extra"))
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if want := "[" + dir + "][inherited][it's extra]"; stdout.String() != want {
+        t.Errorf("stdout = %q, want %q", stdout.String(), want)
+    }
+
+    stdout.Reset()
+    err = runner.Run(&local.Connection{ Type: "local" }, envScript, nil, &stdout, nil, runner.WithDir(dir), runner.WithEnv("TEST_RUNNER_EXTRA=extra"), runner.WithCleanEnv())
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if want := "[" + dir + "][][extra]"; stdout.String() != want {
+        t.Errorf("stdout = %q, want %q", stdout.String(), want)
+    }
+
+    err = runner.Run(&local.Connection{ Type: "local" }, envScript, nil, nil, nil, runner.WithEnv("TEST_RUNNER_EXTRA"))
+    if !errors.Is(err, runner.ErrStart) || !strings.Contains(err.Error(), "must be \"NAME=value\"") {
+        t.Errorf("error %v is not an invalid environment error", err)
+    }
+
+    err = runner.Run(&local.Connection{ Type: "local" }, envScript, nil, nil, nil, runner.WithDir(filepath.Join(dir, "missing")))
+    if !errors.Is(err, runner.ErrStart) {
+        t.Errorf("error %v does not match %v", err, runner.ErrStart)
+    }
+}
+
+func TestRunDryRunDirEnv(t *testing.T) {
+    envScript := script.New("env", "bash", `echo {{.Path}}`, script.WithEnvArguments())
+
+    var stdout bytes.Buffer
+    err := runner.Run(map[string]string{ "Type": "dryrun" }, envScript, map[string]string{ "Path": "/tmp" }, &stdout, nil, runner.WithDir("/srv"), runner.WithEnv("EXTRA=1"), runner.WithCleanEnv())
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    want := "command: bash -\ndir: /srv\nenv (clean):\n    \"ARG_PATH=/tmp\"\n    \"EXTRA=1\"\nstdin:\necho /tmp\n"
+    if stdout.String() != want {
+        t.Errorf("stdout = %q, want %q", stdout.String(), want)
+    }
+}
+
+//------------------------------------------------------------------------------
+
+// fake sudo, accepting password "secret" unless FAKE_SUDO_NOPASSWD is set, logging its arguments to FAKE_SUDO_LOG
+const fakeSudo = `#!/bin/sh
+echo "$*" >> "$FAKE_SUDO_LOG"
+user=root; nonint=no
+while [ $# -gt 0 ]; do
+    case "$1" in
+    -S|-k) shift ;;
+    -n) nonint=yes; shift ;;
+    -p) shift 2 ;;
+    -u) user=$2; shift 2 ;;
+    --) shift; break ;;
+    *) break ;;
+    esac
+done
+if [ -z "$FAKE_SUDO_NOPASSWD" ]; then
+    [ $nonint = yes ] && { echo "sudo: a password is required" >&2; exit 1; }
+    IFS= read -r password
+    [ "$password" = secret ] || { echo "Sorry, try again." >&2; exit 1; }
+fi
+FAKE_SUDO_USER=$user exec "$@"
+`
+
+func TestRunLocalBecome(t *testing.T) {
+    skipIfNoBash(t)
+
+    dir, err := ioutil.TempDir("", "runner")
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    defer os.RemoveAll(dir)
+
+    err = ioutil.WriteFile(filepath.Join(dir, "sudo"), []byte(fakeSudo), 0755)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    log := filepath.Join(dir, "sudo.log")
+
+    defer os.Setenv("PATH", os.Getenv("PATH"))
+    os.Setenv("PATH", dir + string(os.PathListSeparator) + os.Getenv("PATH"))
+    os.Setenv("FAKE_SUDO_LOG", log)
+    defer os.Unsetenv("FAKE_SUDO_LOG")
+
+    becomeScript := script.New("become", "bash", "read -r line <<< 'from the script'\nprintf '[%s]' \"$FAKE_SUDO_USER\" \"$TEST_RUNNER_EXTRA\" \"$line\"\n")
+
+    tests := []struct {
+        name     string
+        nopasswd bool
+        user     string
+        password string
+        want     string
+    }{
+        { "password", false, "deploy", "secret", "[deploy][extra][from the script]" },
+        { "password not asked", true, "", "secret", "[root][extra][from the script]" },
+        { "no password", true, "", "", "[root][extra][from the script]" },
+    }
+
+    for _, test := range tests {
+        if test.nopasswd {
+            os.Setenv("FAKE_SUDO_NOPASSWD", "1")
+        } else {
+            os.Unsetenv("FAKE_SUDO_NOPASSWD")
+        }
+
+        var stdout bytes.Buffer
+        err := runner.Run(&local.Connection{ Type: "local" }, becomeScript, nil, &stdout, nil, runner.WithBecome("sudo", test.user, test.password), runner.WithEnv("TEST_RUNNER_EXTRA=extra"))
+        if err != nil {
+            t.Errorf("%s: unexpected error: %v", test.name, err)
+            continue
+        }
+        if stdout.String() != test.want {
+            t.Errorf("%s: stdout = %q, want %q", test.name, stdout.String(), test.want)
+        }
+    }
+    os.Unsetenv("FAKE_SUDO_NOPASSWD")
+
+    // the password is sent on stdin, never as an argument
+    b, _ := ioutil.ReadFile(log)
+    if len(b) == 0 || strings.Contains(string(b), "secret") {
+        t.Errorf("sudo arguments = %q, want arguments without password", b)
+    }
+
+    var stdout bytes.Buffer
+    r, err := runner.New(&local.Connection{ Type: "local" }, becomeScript, nil)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    defer r.Close()
+
+    err = runner.Apply(r, runner.WithBecome("sudo", "", "wrong"))
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    r.SetStdoutWriter(&stdout)
+    err = r.Run()
+    if !errors.Is(err, runner.ErrBecome) || r.ExitCode() != -1 {
+        t.Errorf("error = %v, exitcode = %d, want ErrBecome, -1", err, r.ExitCode())
+    }
+    if stdout.Len() != 0 {
+        t.Errorf("stdout = %q, want no output from the script", stdout.String())
+    }
+
+    err = runner.Run(&local.Connection{ Type: "local" }, becomeScript, nil, nil, nil, runner.WithBecome("", "", ""))
+    if !errors.Is(err, runner.ErrBecome) {
+        t.Errorf("error %v does not match %v", err, runner.ErrBecome)
+    }
+
+    err = runner.Run(&local.Connection{ Type: "local" }, becomeScript, nil, nil, nil, runner.WithBecome("su", "", "secret"))
+    if !errors.Is(err, runner.ErrStart) || !strings.Contains(err.Error(), "cannot read a password from stdin") {
+        t.Errorf("error %v is not a become method error", err)
+    }
+
+    // also with a terminal, stdin carries the script
+    err = runner.Run(&local.Connection{ Type: "local" }, becomeScript, nil, nil, nil, runner.WithBecome("su", "", "secret"), runner.WithPty("", 0, 0))
+    if !errors.Is(err, runner.ErrStart) || !strings.Contains(err.Error(), "cannot read a password from stdin") {
+        t.Errorf("pty: error %v is not a become method error", err)
+    }
+}
+
+//------------------------------------------------------------------------------
+
+func TestRunLocalPty(t *testing.T) {
+    skipIfNoBash(t)
+
+    ptyScript := script.New("pty", "bash", `
+        [ -t 1 ] && [ -t 2 ] && echo "terminal $TERM $(stty size </dev/tty)"
+        echo "stderr: {{.Message}}" >&2
+        exit {{.ExitCode}}
+    `)
+
+    var stdout, stderr bytes.Buffer
+    err := runner.Run(&local.Connection{ Type: "local" }, ptyScript, testArguments{ Message: "merged", ExitCode: 3 }, &stdout, &stderr, runner.WithPty("vt100", 100, 30))
+    if !errors.Is(err, runner.ErrExit) {
+        t.Errorf("error %v does not match %v", err, runner.ErrExit)
+    }
+
+    // the terminal translates newlines, and merges stderr into stdout
+    want := "terminal vt100 30 100\r\nstderr: merged\r\n"
+    if stdout.String() != want || stderr.Len() != 0 {
+        t.Errorf("stdout = %q, stderr = %q, want %q, \"\"", stdout.String(), stderr.String(), want)
+    }
+
+    r, err := runner.New(&local.Connection{ Type: "local" }, ptyScript, testArguments{ Message: "piped" })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    defer r.Close()
+
+    err = runner.Apply(r, runner.WithPty("", 0, 0))
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    stdoutPipe, _ := r.StdoutPipe()
+    stderrPipe, _ := r.StderrPipe()
+    err = r.Start()
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    output, _ := ioutil.ReadAll(stdoutPipe)
+    errput, _ := ioutil.ReadAll(stderrPipe)
+    err = r.Wait()
+    if err != nil {
+        t.Errorf("unexpected error: %v", err)
+    }
+
+    want = "terminal xterm 24 80\r\nstderr: piped\r\n"
+    if string(output) != want || len(errput) != 0 {
+        t.Errorf("stdout = %q, stderr = %q, want %q, \"\"", output, errput, want)
+    }
+}
+
+//------------------------------------------------------------------------------
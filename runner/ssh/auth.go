@@ -0,0 +1,197 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package ssh
+
+import (
+    "fmt"
+    "github.com/mitchellh/go-homedir"
+    "io/ioutil"
+    "net"
+    "os"
+    "golang.org/x/crypto/ssh/agent"
+    "golang.org/x/crypto/ssh"
+    "strings"
+)
+
+//------------------------------------------------------------------------------
+
+const defaultAuthMethods = "agent,publickey,keyboard-interactive,password"
+
+//------------------------------------------------------------------------------
+
+func newAuthMethods(c *Connection) ([]ssh.AuthMethod, func(), error) {
+    // returns the auth methods in the order specified by 'c.AuthMethods', and a function to release the resources used by these methods
+    // an auth method is only returned when it is configured in the connection
+    //
+    // remark that the ssh client doesn't retry an auth method that failed
+    // hence the signers from the agent and from the private key are combined into a single "publickey" auth method
+    var methods []ssh.AuthMethod
+    var signers []ssh.Signer
+    var closers []func()
+    cleanup := func() {
+        for _, release := range closers {
+            release()
+        }
+    }
+
+    order := c.AuthMethods
+    if order == "" {
+        order = defaultAuthMethods
+    }
+
+    publicKeyIndex := -1
+    for _, name := range strings.Split(order, ",") {
+        switch strings.ToLower(strings.TrimSpace(name)) {
+        case "agent":
+            if !c.Agent {
+                continue
+            }
+
+            agentSigners, release, err := newAgentSigners()
+            if err != nil {
+                cleanup()
+                return nil, nil, err
+            }
+            closers = append(closers, release)
+            signers = append(signers, agentSigners...)
+        case "publickey":
+            if c.PrivateKey == "" && c.PrivateKeyFile == "" {
+                continue
+            }
+
+            keySigners, err := newKeySigners(c)
+            if err != nil {
+                cleanup()
+                return nil, nil, err
+            }
+            signers = append(signers, keySigners...)
+        case "keyboard-interactive":
+            if !c.KeyboardInteractive {
+                continue
+            }
+
+            password := c.Password
+            methods = append(methods, ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+                answers := make([]string, len(questions))
+                for i := range questions {
+                    answers[i] = password
+                }
+                return answers, nil
+            }))
+            continue
+        case "password":
+            if c.Password == "" {
+                continue
+            }
+
+            methods = append(methods, ssh.Password(c.Password))
+            continue
+        case "":
+            continue
+        default:
+            cleanup()
+            return nil, nil, fmt.Errorf("[golang-exec/runner/ssh/newAuthMethods()] invalid auth method %q in 'AuthMethods'\n", name)
+        }
+
+        // "agent" and "publickey" share a single auth method, at the position of the first one
+        if publicKeyIndex < 0 {
+            publicKeyIndex = len(methods)
+            methods = append(methods, nil)
+        }
+    }
+
+    if publicKeyIndex >= 0 {
+        methods[publicKeyIndex] = ssh.PublicKeys(signers...)
+    }
+
+    return methods, cleanup, nil
+}
+
+func newAgentSigners() ([]ssh.Signer, func(), error) {
+    socket := os.Getenv("SSH_AUTH_SOCK")
+    if socket == "" {
+        return nil, nil, fmt.Errorf("[golang-exec/runner/ssh/newAgentSigners()] cannot find ssh-agent, 'SSH_AUTH_SOCK' is not set\n")
+    }
+
+    conn, err := net.Dial("unix", socket)
+    if err != nil {
+        return nil, nil, fmt.Errorf("[golang-exec/runner/ssh/newAgentSigners()] cannot connect to ssh-agent: %w\n", err)
+    }
+
+    signers, err := agent.NewClient(conn).Signers()
+    if err != nil {
+        conn.Close()
+        return nil, nil, fmt.Errorf("[golang-exec/runner/ssh/newAgentSigners()] cannot get keys from ssh-agent: %w\n", err)
+    }
+
+    return signers, func() { conn.Close() }, nil
+}
+
+func newKeySigners(c *Connection) ([]ssh.Signer, error) {
+    // returns a certificate signer followed by the plain key signer when a certificate is configured, the plain key signer otherwise
+    pemBytes := []byte(c.PrivateKey)
+    if c.PrivateKeyFile != "" {
+        b, err := readFile(c.PrivateKeyFile)
+        if err != nil {
+            return nil, fmt.Errorf("[golang-exec/runner/ssh/newKeySigners()] cannot read private key file: %w\n", err)
+        }
+        pemBytes = b
+    }
+
+    var signer ssh.Signer
+    var err error
+    if c.Passphrase != "" {
+        signer, err = ssh.ParsePrivateKeyWithPassphrase(pemBytes, []byte(c.Passphrase))
+    } else {
+        signer, err = ssh.ParsePrivateKey(pemBytes)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("[golang-exec/runner/ssh/newKeySigners()] cannot parse private key: %w\n", err)
+    }
+
+    if c.Certificate == "" && c.CertificateFile == "" {
+        return []ssh.Signer{ signer }, nil
+    }
+
+    certBytes := []byte(c.Certificate)
+    if c.CertificateFile != "" {
+        b, err := readFile(c.CertificateFile)
+        if err != nil {
+            return nil, fmt.Errorf("[golang-exec/runner/ssh/newKeySigners()] cannot read certificate file: %w\n", err)
+        }
+        certBytes = b
+    }
+
+    pub, _, _, _, err := ssh.ParseAuthorizedKey(certBytes)
+    if err != nil {
+        return nil, fmt.Errorf("[golang-exec/runner/ssh/newKeySigners()] cannot parse certificate: %w\n", err)
+    }
+
+    cert, ok := pub.(*ssh.Certificate)
+    if !ok {
+        return nil, fmt.Errorf("[golang-exec/runner/ssh/newKeySigners()] cannot parse certificate: not an OpenSSH certificate\n")
+    }
+
+    certSigner, err := ssh.NewCertSigner(cert, signer)
+    if err != nil {
+        return nil, fmt.Errorf("[golang-exec/runner/ssh/newKeySigners()] certificate doesn't match private key: %w\n", err)
+    }
+
+    return []ssh.Signer{ certSigner, signer }, nil
+}
+
+func readFile(path string) ([]byte, error) {
+    // reads a file, expanding a leading "~" to the home directory of the current user
+    f, err := homedir.Expand(path)
+    if err != nil {
+        return nil, err
+    }
+
+    return ioutil.ReadFile(f)
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,198 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package ssh
+
+import (
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/x509"
+    "encoding/pem"
+    "io/ioutil"
+    "net"
+    "os"
+    "path/filepath"
+    "golang.org/x/crypto/ssh/agent"
+    "golang.org/x/crypto/ssh"
+    "testing"
+)
+
+//------------------------------------------------------------------------------
+
+func newTestKey(t *testing.T, passphrase string) (*rsa.PrivateKey, string) {
+    t.Helper()
+
+    key, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        t.Fatalf("cannot generate key: %v", err)
+    }
+
+    block := &pem.Block{ Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key) }
+    if passphrase != "" {
+        block, err = x509.EncryptPEMBlock(rand.Reader, block.Type, block.Bytes, []byte(passphrase), x509.PEMCipherAES256)
+        if err != nil {
+            t.Fatalf("cannot encrypt key: %v", err)
+        }
+    }
+
+    return key, string(pem.EncodeToMemory(block))
+}
+
+//------------------------------------------------------------------------------
+
+func TestNewAuthMethods(t *testing.T) {
+    _, pemKey := newTestKey(t, "")
+
+    tests := []struct {
+        name       string
+        connection Connection
+        want       int
+    }{
+        { "none",     Connection{}, 0 },
+        { "password", Connection{ Password: "secret" }, 1 },
+        { "key",      Connection{ PrivateKey: pemKey }, 1 },
+        { "all",      Connection{ Password: "secret", PrivateKey: pemKey, KeyboardInteractive: true }, 3 },
+        { "order",    Connection{ Password: "secret", PrivateKey: pemKey, AuthMethods: "password" }, 1 },
+    }
+
+    for _, test := range tests {
+        methods, cleanup, err := newAuthMethods(&test.connection)
+        if err != nil {
+            t.Errorf("%s: unexpected error: %v", test.name, err)
+            continue
+        }
+        cleanup()
+
+        if len(methods) != test.want {
+            t.Errorf("%s: got %d auth methods, want %d", test.name, len(methods), test.want)
+        }
+    }
+}
+
+func TestNewAuthMethodsInvalid(t *testing.T) {
+    _, _, err := newAuthMethods(&Connection{ AuthMethods: "password,gssapi" })
+    if err == nil {
+        t.Error("expected an error for an unknown auth method")
+    }
+
+    _, _, err = newAuthMethods(&Connection{ PrivateKey: "not a key" })
+    if err == nil {
+        t.Error("expected an error for an invalid private key")
+    }
+}
+
+func TestNewAgentSigners(t *testing.T) {
+    key, _ := newTestKey(t, "")
+
+    keyring := agent.NewKeyring()
+    if err := keyring.Add(agent.AddedKey{ PrivateKey: key }); err != nil {
+        t.Fatalf("cannot add key to agent: %v", err)
+    }
+
+    dir, err := ioutil.TempDir("", "golang-exec-agent")
+    if err != nil {
+        t.Fatalf("cannot create temp dir: %v", err)
+    }
+    defer os.RemoveAll(dir)
+
+    socket := filepath.Join(dir, "agent.sock")
+    listener, err := net.Listen("unix", socket)
+    if err != nil {
+        t.Skipf("cannot listen on unix socket: %v", err)
+    }
+    defer listener.Close()
+
+    go func() {
+        for {
+            conn, err := listener.Accept()
+            if err != nil {
+                return
+            }
+            go agent.ServeAgent(keyring, conn)
+        }
+    }()
+
+    defer os.Setenv("SSH_AUTH_SOCK", os.Getenv("SSH_AUTH_SOCK"))
+    os.Setenv("SSH_AUTH_SOCK", socket)
+
+    signers, release, err := newAgentSigners()
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    defer release()
+
+    if len(signers) != 1 {
+        t.Errorf("got %d signers, want 1", len(signers))
+    }
+
+    methods, cleanup, err := newAuthMethods(&Connection{ Agent: true, Password: "secret" })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    cleanup()
+    if len(methods) != 2 {
+        t.Errorf("got %d auth methods, want 2", len(methods))
+    }
+}
+
+func TestNewKeySignersPassphrase(t *testing.T) {
+    _, pemKey := newTestKey(t, "my-passphrase")
+
+    _, err := newKeySigners(&Connection{ PrivateKey: pemKey })
+    if err == nil {
+        t.Error("expected an error for an encrypted key without passphrase")
+    }
+
+    signers, err := newKeySigners(&Connection{ PrivateKey: pemKey, Passphrase: "my-passphrase" })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if len(signers) != 1 {
+        t.Errorf("got %d signers, want 1", len(signers))
+    }
+}
+
+func TestNewKeySignersCertificate(t *testing.T) {
+    key, pemKey := newTestKey(t, "")
+    caKey, _ := newTestKey(t, "")
+
+    pub, err := ssh.NewPublicKey(&key.PublicKey)
+    if err != nil {
+        t.Fatalf("cannot create public key: %v", err)
+    }
+    caSigner, err := ssh.NewSignerFromKey(caKey)
+    if err != nil {
+        t.Fatalf("cannot create CA signer: %v", err)
+    }
+
+    cert := &ssh.Certificate{
+        Key: pub,
+        CertType: ssh.UserCert,
+        ValidPrincipals: []string{ "me" },
+        ValidBefore: ssh.CertTimeInfinity,
+    }
+    if err := cert.SignCert(rand.Reader, caSigner); err != nil {
+        t.Fatalf("cannot sign certificate: %v", err)
+    }
+
+    signers, err := newKeySigners(&Connection{ PrivateKey: pemKey, Certificate: string(ssh.MarshalAuthorizedKey(cert)) })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if len(signers) != 2 {
+        t.Fatalf("got %d signers, want 2", len(signers))
+    }
+    if _, ok := signers[0].PublicKey().(*ssh.Certificate); !ok {
+        t.Errorf("first signer doesn't use the certificate")
+    }
+
+    _, err = newKeySigners(&Connection{ PrivateKey: pemKey, Certificate: string(ssh.MarshalAuthorizedKey(pub)) })
+    if err == nil {
+        t.Error("expected an error for a public key that isn't a certificate")
+    }
+}
+
+//------------------------------------------------------------------------------
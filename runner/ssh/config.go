@@ -0,0 +1,394 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package ssh
+
+import (
+    "bufio"
+    "fmt"
+    "github.com/mitchellh/go-homedir"
+    "os"
+    "os/user"
+    "path/filepath"
+    "strconv"
+    "strings"
+)
+
+//------------------------------------------------------------------------------
+
+const defaultConfigFiles = "~/.ssh/config,/etc/ssh/ssh_config"
+
+//------------------------------------------------------------------------------
+
+// an OpenSSH client config, supporting the keywords used by the ssh runner
+//
+// like OpenSSH, the first obtained value for a keyword is used,
+// except for "IdentityFile" and "UserKnownHostsFile" where all values are accumulated
+type sshConfig struct {
+    blocks []configBlock
+}
+
+type configBlock struct {
+    patterns []string   // patterns from the "Host" line, nil for lines before the first "Host" line, ["!*"] for "Match" blocks
+    params   []configParam
+}
+
+type configParam struct {
+    keyword string   // lowercase
+    value   string
+}
+
+//------------------------------------------------------------------------------
+
+func applyConfig(c *Connection) error {
+    // resolves the host alias in 'c.Host' using the OpenSSH client config files
+    // explicit fields in the connection take precedence over the values in the config files
+    if !c.UseConfig && c.ConfigFiles == "" {
+        return nil
+    }
+
+    files := c.ConfigFiles
+    if files == "" {
+        files = defaultConfigFiles
+    }
+
+    cfg := new(sshConfig)
+    for _, f := range strings.Split(files, ",") {
+        f = strings.TrimSpace(f)
+        if f == "" {
+            continue
+        }
+
+        path, err := homedir.Expand(f)
+        if err != nil {
+            return fmt.Errorf("[golang-exec/runner/ssh/applyConfig()] cannot find home directory of current user: %w\n", err)
+        }
+
+        err = cfg.readFile(path, nil, 0)
+        if err != nil && !os.IsNotExist(err) {
+            return fmt.Errorf("[golang-exec/runner/ssh/applyConfig()] cannot read ssh config file: %w\n", err)
+        }
+    }
+
+    return cfg.apply(c, 0)
+}
+
+func (cfg *sshConfig) apply(c *Connection, depth int) error {
+    alias := c.Host
+
+    if hostname := cfg.get(alias, "hostname"); hostname != "" {
+        c.Host = strings.Replace(hostname, "%h", alias, -1)
+    }
+
+    if c.Port == 0 {
+        if port := cfg.get(alias, "port"); port != "" {
+            p, err := strconv.ParseUint(port, 10, 16)
+            if err != nil {
+                return fmt.Errorf("[golang-exec/runner/ssh/applyConfig()] invalid 'Port' for host %q in ssh config: %w\n", alias, err)
+            }
+            c.Port = uint16(p)
+        }
+    }
+
+    if c.User == "" {
+        c.User = cfg.get(alias, "user")
+    }
+
+    tokens := newTokenReplacer(alias, c)
+
+    if c.PrivateKey == "" && c.PrivateKeyFile == "" {
+        // like OpenSSH, a certificate is loaded from "<identity-file>-cert.pub" when it exists
+        for _, f := range cfg.getAll(alias, "identityfile") {
+            path, err := homedir.Expand(tokens.Replace(f))
+            if err != nil {
+                continue
+            }
+            if _, err := os.Stat(path); err != nil {
+                continue
+            }
+
+            c.PrivateKeyFile = path
+            if c.Certificate == "" && c.CertificateFile == "" {
+                if _, err := os.Stat(path + "-cert.pub"); err == nil {
+                    c.CertificateFile = path + "-cert.pub"
+                }
+            }
+            break
+        }
+    }
+
+    if c.KnownHosts == "" {
+        var files []string
+        for _, value := range cfg.getAll(alias, "userknownhostsfile") {
+            for _, f := range strings.Fields(value) {
+                if strings.ToLower(f) != "none" {
+                    files = append(files, tokens.Replace(f))
+                }
+            }
+        }
+        c.KnownHosts = strings.Join(files, ",")
+    }
+
+    if !c.Insecure && !c.TrustOnFirstUse && c.HostKeyFingerprint == "" {
+        // "no" only disables host key verification when the connection allows it, otherwise it is treated as "accept-new"
+        switch strings.ToLower(cfg.get(alias, "stricthostkeychecking")) {
+        case "accept-new":
+            c.TrustOnFirstUse = true
+        case "no", "off":
+            if c.AllowConfigInsecure {
+                c.Insecure = true
+            } else {
+                c.TrustOnFirstUse = true
+            }
+        }
+    }
+
+    jumpHosts := c.JumpHosts
+    if len(jumpHosts) == 0 {
+        proxyJump := cfg.get(alias, "proxyjump")
+        if proxyJump != "" && strings.ToLower(proxyJump) != "none" {
+            for _, address := range strings.Split(proxyJump, ",") {
+                // jump hosts from 'ProxyJump' use the same ssh-agent
+                user, host, port := splitAddress(strings.TrimSpace(address))
+                jump := Connection{ Host: host, User: user, Agent: c.Agent, AllowConfigInsecure: c.AllowConfigInsecure }
+                if port != "" {
+                    p, err := strconv.ParseUint(port, 10, 16)
+                    if err != nil {
+                        return fmt.Errorf("[golang-exec/runner/ssh/applyConfig()] invalid 'ProxyJump' for host %q in ssh config: %w\n", alias, err)
+                    }
+                    jump.Port = uint16(p)
+                }
+                jumpHosts = append(jumpHosts, jump)
+            }
+        }
+    }
+
+    // explicit jump hosts and jump hosts from 'ProxyJump' are resolved using the same config
+    // the jump hosts of a jump host are dialed before the jump host, so they are added to the chain before it
+    // a new slice is used, so the jump hosts of the caller's connection are not changed
+    c.JumpHosts = nil
+    for _, jump := range jumpHosts {
+        if depth >= 10 {
+            return fmt.Errorf("[golang-exec/runner/ssh/applyConfig()] too many nested 'ProxyJump' hosts for host %q in ssh config\n", alias)
+        }
+
+        err := cfg.apply(&jump, depth + 1)
+        if err != nil {
+            return err
+        }
+        c.JumpHosts = append(c.JumpHosts, jump.JumpHosts...)
+        jump.JumpHosts = nil
+        c.JumpHosts = append(c.JumpHosts, jump)
+    }
+
+    return nil
+}
+
+func newTokenReplacer(alias string, c *Connection) *strings.Replacer {
+    // replaces the tokens supported by OpenSSH in "IdentityFile" and "UserKnownHostsFile"
+    home, _ := homedir.Dir()
+    port := c.Port
+    if port == 0 {
+        port = 22
+    }
+    localUser := localUsername()
+    remoteUser := c.User
+    if remoteUser == "" {
+        remoteUser = localUser
+    }
+
+    return strings.NewReplacer(
+        "%%", "%",
+        "%d", home,
+        "%h", c.Host,
+        "%n", alias,
+        "%p", strconv.Itoa(int(port)),
+        "%r", remoteUser,
+        "%u", localUser,
+    )
+}
+
+func localUsername() string {
+    // like OpenSSH, the local user is used for hosts without a user
+    u, err := user.Current()
+    if err != nil {
+        return ""
+    }
+
+    // on windows, the username includes the domain
+    name := u.Username
+    if i := strings.LastIndex(name, "\\"); i >= 0 {
+        name = name[i+1:]
+    }
+    return name
+}
+
+//------------------------------------------------------------------------------
+
+func (cfg *sshConfig) readFile(path string, patterns []string, depth int) error {
+    // 'patterns' are the patterns of the "Host" block with the "Include" directive, the included lines before the first "Host" line are part of this block
+    if depth > 16 {
+        return fmt.Errorf("[golang-exec/runner/ssh/readFile()] too many nested 'Include' directives in ssh config file %q\n", path)
+    }
+
+    f, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+
+    block := configBlock{ patterns: patterns }
+    scanner := bufio.NewScanner(f)
+    for scanner.Scan() {
+        keyword, value := splitConfigLine(scanner.Text())
+        switch keyword {
+        case "":
+            continue
+        case "host":
+            cfg.blocks = append(cfg.blocks, block)
+            block = configBlock{ patterns: strings.Fields(value) }
+        case "match":
+            // "Match" criteria are not supported, the block never matches
+            cfg.blocks = append(cfg.blocks, block)
+            block = configBlock{ patterns: []string{ "!*" } }
+        case "include":
+            // included files are inserted at the position of the "Include" directive
+            cfg.blocks = append(cfg.blocks, block)
+            block = configBlock{ patterns: block.patterns }
+            for _, pattern := range strings.Fields(value) {
+                pattern, err = homedir.Expand(pattern)
+                if err != nil {
+                    return err
+                }
+                if !filepath.IsAbs(pattern) {
+                    pattern = filepath.Join(filepath.Dir(path), pattern)
+                }
+
+                matches, err := filepath.Glob(pattern)
+                if err != nil {
+                    return err
+                }
+                for _, m := range matches {
+                    err = cfg.readFile(m, block.patterns, depth + 1)
+                    if err != nil {
+                        return err
+                    }
+                }
+            }
+        default:
+            block.params = append(block.params, configParam{ keyword: keyword, value: value })
+        }
+    }
+    cfg.blocks = append(cfg.blocks, block)
+
+    return scanner.Err()
+}
+
+func splitConfigLine(line string) (string, string) {
+    // splits "Keyword value" or "Keyword=value", returns a lowercase keyword and an unquoted value
+    line = strings.TrimSpace(line)
+    if line == "" || strings.HasPrefix(line, "#") {
+        return "", ""
+    }
+
+    i := strings.IndexAny(line, " \t=")
+    if i < 0 {
+        return strings.ToLower(line), ""
+    }
+
+    keyword := strings.ToLower(line[:i])
+    value := strings.TrimSpace(line[i:])
+    value = strings.TrimSpace(strings.TrimPrefix(value, "="))
+    if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+        value = value[1:len(value)-1]
+    }
+
+    return keyword, value
+}
+
+//------------------------------------------------------------------------------
+
+func (cfg *sshConfig) get(alias string, keyword string) string {
+    for _, b := range cfg.blocks {
+        if !b.matches(alias) {
+            continue
+        }
+        for _, p := range b.params {
+            if p.keyword == keyword {
+                return p.value
+            }
+        }
+    }
+
+    return ""
+}
+
+func (cfg *sshConfig) getAll(alias string, keyword string) []string {
+    var values []string
+    for _, b := range cfg.blocks {
+        if !b.matches(alias) {
+            continue
+        }
+        for _, p := range b.params {
+            if p.keyword == keyword {
+                values = append(values, p.value)
+            }
+        }
+    }
+
+    return values
+}
+
+func (b *configBlock) matches(alias string) bool {
+    if b.patterns == nil {
+        return true   // lines before the first "Host" line apply to all hosts
+    }
+
+    matched := false
+    for _, pattern := range b.patterns {
+        if strings.HasPrefix(pattern, "!") {
+            if matchPattern(pattern[1:], alias) {
+                return false
+            }
+        } else if matchPattern(pattern, alias) {
+            matched = true
+        }
+    }
+
+    return matched
+}
+
+func matchPattern(pattern string, s string) bool {
+    // matches "*" and "?" wildcards, case-insensitive like OpenSSH
+    pattern = strings.ToLower(pattern)
+    s = strings.ToLower(s)
+
+    for len(pattern) > 0 {
+        switch pattern[0] {
+        case '*':
+            for i := 0; i <= len(s); i++ {
+                if matchPattern(pattern[1:], s[i:]) {
+                    return true
+                }
+            }
+            return false
+        case '?':
+            if len(s) == 0 {
+                return false
+            }
+        default:
+            if len(s) == 0 || s[0] != pattern[0] {
+                return false
+            }
+        }
+        pattern = pattern[1:]
+        s = s[1:]
+    }
+
+    return len(s) == 0
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,231 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package ssh
+
+import (
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+)
+
+//------------------------------------------------------------------------------
+
+func writeTestFile(t *testing.T, path string, content string) {
+    t.Helper()
+
+    if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+        t.Fatalf("cannot write %s: %v", path, err)
+    }
+}
+
+//------------------------------------------------------------------------------
+
+func TestApplyConfig(t *testing.T) {
+    dir, err := ioutil.TempDir("", "golang-exec-config")
+    if err != nil {
+        t.Fatalf("cannot create temp dir: %v", err)
+    }
+    defer os.RemoveAll(dir)
+
+    identity := filepath.Join(dir, "id_prod")
+    writeTestFile(t, identity, "key")
+    writeTestFile(t, identity + "-cert.pub", "cert")
+    writeTestFile(t, filepath.Join(dir, "bastion.conf"), `
+Host bastion
+    HostName bastion.example.com
+    User jump
+`)
+
+    config := filepath.Join(dir, "config")
+    writeTestFile(t, config, `
+# comment
+Include bastion.conf
+
+Host prod-* !prod-legacy
+    HostName %h.internal
+    Port 2222
+    User deploy
+    IdentityFile ` + filepath.Join(dir, "id_missing") + `
+    IdentityFile ` + identity + `
+    ProxyJump bastion
+    UserKnownHostsFile "` + filepath.Join(dir, "known_hosts_%h") + `"
+    StrictHostKeyChecking accept-new
+
+Host *
+    User=default
+    Port 22
+    StrictHostKeyChecking no
+`)
+
+    c := &Connection{ Host: "prod-db", ConfigFiles: config, Agent: true }
+    if err := applyConfig(c); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    want := &Connection{
+        Host: "prod-db.internal",
+        Port: 2222,
+        User: "deploy",
+        Agent: true,
+        PrivateKeyFile: identity,
+        CertificateFile: identity + "-cert.pub",
+        KnownHosts: filepath.Join(dir, "known_hosts_prod-db.internal"),
+        TrustOnFirstUse: true,
+        ConfigFiles: config,
+        JumpHosts: []Connection{
+            { Host: "bastion.example.com", Port: 22, User: "jump", Agent: true, TrustOnFirstUse: true },
+        },
+    }
+    if !reflect.DeepEqual(c, want) {
+        t.Errorf("connection = %+v\nwant %+v", c, want)
+    }
+
+    // explicit fields take precedence
+    c = &Connection{ Host: "prod-db", Port: 22, User: "me", KnownHosts: "my_known_hosts", Insecure: true, ConfigFiles: config }
+    if err := applyConfig(c); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if c.Port != 22 || c.User != "me" || c.KnownHosts != "my_known_hosts" || !c.Insecure || c.TrustOnFirstUse {
+        t.Errorf("explicit fields are overridden: %+v", c)
+    }
+
+    // negated pattern
+    c = &Connection{ Host: "prod-legacy", ConfigFiles: config }
+    if err := applyConfig(c); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if c.Host != "prod-legacy" || c.User != "default" || len(c.JumpHosts) != 0 {
+        t.Errorf("connection = %+v, negated pattern doesn't work", c)
+    }
+
+    // "StrictHostKeyChecking no" only disables host key verification when allowed
+    if c.Insecure || !c.TrustOnFirstUse {
+        t.Errorf("connection = %+v, want \"StrictHostKeyChecking no\" treated as \"accept-new\"", c)
+    }
+    c = &Connection{ Host: "prod-legacy", ConfigFiles: config, AllowConfigInsecure: true }
+    if err := applyConfig(c); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if !c.Insecure || c.TrustOnFirstUse {
+        t.Errorf("connection = %+v, want \"StrictHostKeyChecking no\" mapped to 'Insecure'", c)
+    }
+}
+
+func TestApplyConfigLocalUser(t *testing.T) {
+    dir, err := ioutil.TempDir("", "golang-exec-config")
+    if err != nil {
+        t.Fatalf("cannot create temp dir: %v", err)
+    }
+    defer os.RemoveAll(dir)
+
+    config := filepath.Join(dir, "config")
+    writeTestFile(t, config, `
+Host app
+    ProxyJump admin@gw1,gw2:2200
+    UserKnownHostsFile ` + filepath.Join(dir, "known_hosts_%r") + `
+`)
+
+    c := &Connection{ Host: "app", ConfigFiles: config }
+    if err := applyConfig(c); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    // the user is left empty and filled in when dialing, but the tokens use the local user
+    local := localUsername()
+    if c.KnownHosts != filepath.Join(dir, "known_hosts_" + local) {
+        t.Errorf("KnownHosts = %q, want the local user %q", c.KnownHosts, local)
+    }
+    if len(c.JumpHosts) != 2 || c.JumpHosts[0].User != "admin" || c.JumpHosts[1].User != "" || c.JumpHosts[1].Port != 2200 {
+        t.Errorf("JumpHosts = %+v", c.JumpHosts)
+    }
+}
+
+func TestApplyConfigJumpHosts(t *testing.T) {
+    dir, err := ioutil.TempDir("", "golang-exec-config")
+    if err != nil {
+        t.Fatalf("cannot create temp dir: %v", err)
+    }
+    defer os.RemoveAll(dir)
+
+    identity := filepath.Join(dir, "id_bastion")
+    writeTestFile(t, identity, "key")
+
+    config := filepath.Join(dir, "config")
+    writeTestFile(t, config, `
+Host bastion
+    HostName bastion.example.com
+    Port 2222
+    User jump
+    IdentityFile ` + identity + `
+
+Host inner
+    HostName inner.internal
+    ProxyJump gw
+
+Host gw
+    HostName gw.example.com
+`)
+
+    // explicit jump hosts are resolved using the config, explicit fields take precedence
+    jumps := []Connection{ { Host: "bastion", User: "me" }, { Host: "inner" } }
+    c := &Connection{ Host: "app", UseConfig: true, ConfigFiles: config, JumpHosts: jumps }
+    if err := applyConfig(c); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    // the jump hosts of a jump host are added to the chain before it
+    want := []Connection{
+        { Host: "bastion.example.com", Port: 2222, User: "me", PrivateKeyFile: identity },
+        { Host: "gw.example.com" },
+        { Host: "inner.internal" },
+    }
+    if !reflect.DeepEqual(c.JumpHosts, want) {
+        t.Errorf("JumpHosts = %+v\nwant %+v", c.JumpHosts, want)
+    }
+
+    // the jump hosts of the caller are not changed
+    if jumps[0].Host != "bastion" || jumps[1].Host != "inner" || len(jumps[1].JumpHosts) != 0 {
+        t.Errorf("jump hosts of the caller are changed: %+v", jumps)
+    }
+}
+
+func TestApplyConfigNotUsed(t *testing.T) {
+    c := &Connection{ Host: "prod-db" }
+    if err := applyConfig(c); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if !reflect.DeepEqual(c, &Connection{ Host: "prod-db" }) {
+        t.Errorf("connection is changed without using config files: %+v", c)
+    }
+}
+
+func TestMatchPattern(t *testing.T) {
+    tests := []struct {
+        pattern string
+        s       string
+        want    bool
+    }{
+        { "*", "anything", true },
+        { "prod-*", "prod-db", true },
+        { "prod-*", "PROD-DB", true },
+        { "prod-*", "dev-db", false },
+        { "db?", "db1", true },
+        { "db?", "db12", false },
+        { "*.example.com", "host.example.com", true },
+        { "*.example.com", "example.com", false },
+    }
+
+    for _, test := range tests {
+        if got := matchPattern(test.pattern, test.s); got != test.want {
+            t.Errorf("matchPattern(%q, %q) = %v, want %v", test.pattern, test.s, got, test.want)
+        }
+    }
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,134 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package ssh
+
+import (
+    "fmt"
+    "golang.org/x/crypto/ssh"
+    "strings"
+    "sync"
+
+    "github.com/stefaanc/golang-exec/runner/internal/errs"
+)
+
+//------------------------------------------------------------------------------
+
+func dial(c *Connection) (*ssh.Client, error) {
+    // dials the host, tunnelling through the jump hosts in 'c.JumpHosts' (if any)
+    // closing the returned client also closes the clients for the jump hosts
+    var jumps []*ssh.Client
+    closeJumps := func() {
+        for i := len(jumps) - 1; i >= 0; i-- {
+            jumps[i].Close()
+        }
+    }
+
+    var client *ssh.Client
+    for i := range c.JumpHosts {
+        jump, err := dialHop(&c.JumpHosts[i], client)
+        if err != nil {
+            closeJumps()
+            return nil, fmt.Errorf("[golang-exec/runner/ssh/dial()] cannot connect to jump host %d: %w\n", i + 1, err)
+        }
+        jumps = append(jumps, jump)
+        client = jump
+    }
+
+    client, err := dialHop(c, client)
+    if err != nil {
+        closeJumps()
+        return nil, err
+    }
+
+    if len(jumps) > 0 {
+        go func() {
+            _ = client.Wait()
+            closeJumps()
+        }()
+    }
+
+    return client, nil
+}
+
+func dialHop(c *Connection, via *ssh.Client) (*ssh.Client, error) {
+    // dials a single host, directly when 'via' is nil, otherwise tunnelling through 'via'
+    port := c.Port
+    if port == 0 {
+        port = 22
+    }
+    address := fmt.Sprintf("%s:%d", c.Host, port)
+    user := c.User
+    if user == "" {
+        user = localUsername()
+    }
+
+    auth, cleanup, err := newAuthMethods(c)
+    if err != nil {
+        return nil, fmt.Errorf("[golang-exec/runner/ssh/dial()] cannot configure authentication: %w\n", errs.Wrap(errs.ErrAuth, err))
+    }
+    defer cleanup()
+
+    hostKey, err := newHostKeyChecker(c)
+    if err != nil {
+        return nil, fmt.Errorf("[golang-exec/runner/ssh/dial()] cannot configure host key verification: %w\n", errs.Wrap(errs.ErrHostKey, err))
+    }
+
+    config := &ssh.ClientConfig{
+        User: user,
+        Auth: auth,
+        HostKeyCallback: hostKey.Check,
+    }
+
+    var client *ssh.Client
+    if via == nil {
+        client, err = ssh.Dial("tcp", address, config)
+    } else {
+        conn, dialErr := via.Dial("tcp", address)
+        if dialErr != nil {
+            return nil, fmt.Errorf("[golang-exec/runner/ssh/dial()] cannot dial host through jump host: %w\n", errs.Wrap(errs.ErrDial, dialErr))
+        }
+
+        clientConn, chans, reqs, handshakeErr := ssh.NewClientConn(conn, address, config)
+        if handshakeErr != nil {
+            conn.Close()
+            err = handshakeErr
+        } else {
+            client = ssh.NewClient(clientConn, chans, reqs)
+        }
+    }
+    if err != nil {
+        if hostKeyErr := hostKey.Err(); hostKeyErr != nil {
+            return nil, fmt.Errorf("[golang-exec/runner/ssh/dial()] host key rejected: %w\n", errs.Wrap(errs.ErrHostKey, hostKeyErr))
+        }
+        if strings.Contains(err.Error(), "unable to authenticate") {
+            // the ssh client doesn't return a typed error when authentication fails
+            return nil, fmt.Errorf("[golang-exec/runner/ssh/dial()] cannot authenticate: %w\n", errs.Wrap(errs.ErrAuth, err))
+        }
+        return nil, fmt.Errorf("[golang-exec/runner/ssh/dial()] cannot dial host: %w\n", errs.Wrap(errs.ErrDial, err))
+    }
+
+    return client, nil
+}
+
+func newSession(c *Connection) (*ssh.Session, func(), error) {
+    // returns a session on a new client, and a function to close the client when the session is no longer used
+    client, err := dial(c)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    session, err := client.NewSession()
+    if err != nil {
+        client.Close()
+        return nil, nil, fmt.Errorf("[golang-exec/runner/ssh/newSession()] cannot open session: %w\n", errs.Wrap(errs.ErrSession, err))
+    }
+
+    var once sync.Once
+    return session, func() { once.Do(func() { client.Close() }) }, nil
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,621 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+
+//go:build !windows
+// +build !windows
+
+package ssh
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "io/ioutil"
+    "net"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+
+    "golang.org/x/crypto/ssh"
+
+    "github.com/stefaanc/golang-exec/runner/internal/errs"
+    "github.com/stefaanc/golang-exec/runner/ssh/sshtest"
+    "github.com/stefaanc/golang-exec/script"
+)
+
+//------------------------------------------------------------------------------
+
+var testScript = script.New("test", "bash", `
+    echo "stdout: {{.Message}}"
+    echo "stderr: {{.Message}}" >&2
+    exit {{.ExitCode}}
+`)
+
+type testArguments struct {
+    Message  string
+    ExitCode int
+}
+
+func newTestServer(t *testing.T, configure ...func(*sshtest.Server)) (*sshtest.Server, *Connection) {
+    t.Helper()
+
+    if _, err := exec.LookPath("bash"); err != nil {
+        t.Skip("bash not found")
+    }
+
+    s := sshtest.NewUnstartedServer()
+    s.Shell = "bash"   // like sh, but reports the signal that terminates the script
+    s.Passwords["me"] = "my-password"
+    for _, f := range configure {
+        f(s)
+    }
+    s.Start()
+
+    c := &Connection{
+        Type: "ssh",
+        Host: s.Host,
+        Port: s.Port,
+        User: "me",
+        Password: "my-password",
+        HostKeyFingerprint: s.HostKeyFingerprint(),
+    }
+
+    return s, c
+}
+
+func runTestScript(c *Connection, arguments testArguments) (*Runner, string, string, error) {
+    return runPooledTestScript(nil, c, arguments)
+}
+
+func runPooledTestScript(p *Pool, c *Connection, arguments testArguments) (*Runner, string, string, error) {
+    var r *Runner
+    var err error
+    if p != nil {
+        r, err = p.New(c, testScript, arguments)
+    } else {
+        r, err = New(c, testScript, arguments)
+    }
+    if err != nil {
+        return nil, "", "", err
+    }
+    defer r.Close()
+
+    var stdout, stderr bytes.Buffer
+    r.SetStdoutWriter(&stdout)
+    r.SetStderrWriter(&stderr)
+    err = r.Run()
+
+    return r, strings.TrimSpace(stdout.String()), strings.TrimSpace(stderr.String()), err
+}
+
+//------------------------------------------------------------------------------
+
+func TestRunPassword(t *testing.T) {
+    s, c := newTestServer(t)
+    defer s.Close()
+
+    r, stdout, stderr, err := runTestScript(c, testArguments{ Message: "hello" })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    if stdout != "stdout: hello" || stderr != "stderr: hello" || r.ExitCode() != 0 {
+        t.Errorf("stdout = %q, stderr = %q, exitcode = %d", stdout, stderr, r.ExitCode())
+    }
+    if commands := s.Commands(); len(commands) != 1 || commands[0] != "bash -" {
+        t.Errorf("commands = %q, want [\"bash -\"]", commands)
+    }
+}
+
+func TestRunKeyboardInteractive(t *testing.T) {
+    s, c := newTestServer(t)
+    defer s.Close()
+
+    c.KeyboardInteractive = true
+    c.AuthMethods = "keyboard-interactive"
+    _, stdout, _, err := runTestScript(c, testArguments{ Message: "interactive" })
+    if err != nil || stdout != "stdout: interactive" {
+        t.Errorf("stdout = %q, error = %v", stdout, err)
+    }
+}
+
+func TestRunPublicKey(t *testing.T) {
+    key, pemKey := newTestKey(t, "")
+    pub, _ := ssh.NewPublicKey(&key.PublicKey)
+
+    s, c := newTestServer(t, func(s *sshtest.Server) {
+        s.AuthorizedKeys["me"] = []ssh.PublicKey{ pub }
+    })
+    defer s.Close()
+
+    c.Password = ""
+    c.PrivateKey = pemKey
+    _, stdout, _, err := runTestScript(c, testArguments{ Message: "key" })
+    if err != nil || stdout != "stdout: key" {
+        t.Errorf("stdout = %q, error = %v", stdout, err)
+    }
+}
+
+func TestRunExitCode(t *testing.T) {
+    s, c := newTestServer(t)
+    defer s.Close()
+
+    r, stdout, _, err := runTestScript(c, testArguments{ Message: "failing", ExitCode: 3 })
+    if !errors.Is(err, errs.ErrExit) {
+        t.Errorf("error %v does not match %v", err, errs.ErrExit)
+    }
+    if stdout != "stdout: failing" || r.ExitCode() != 3 {
+        t.Errorf("stdout = %q, exitcode = %d, want exitcode 3", stdout, r.ExitCode())
+    }
+}
+
+func TestRunExitSignal(t *testing.T) {
+    s, c := newTestServer(t)
+    defer s.Close()
+
+    r, err := New(c, script.New("signal", "bash", `kill -TERM $$`), nil)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    defer r.Close()
+
+    err = r.Run()
+    if !errors.Is(err, errs.ErrExit) || r.Signal() != "TERM" {
+        t.Errorf("error = %v, signal = %q, want ErrExit and \"TERM\"", err, r.Signal())
+    }
+}
+
+func TestRunContextCancel(t *testing.T) {
+    s, c := newTestServer(t)
+    defer s.Close()
+
+    r, err := New(c, script.New("sleep", "bash", `sleep 30`), nil)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    defer r.Close()
+
+    ctx, cancel := context.WithTimeout(context.Background(), 200 * time.Millisecond)
+    defer cancel()
+
+    start := time.Now()
+    err = r.RunContext(ctx)
+    if !errors.Is(err, errs.ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+        t.Errorf("error %v does not match %v", err, errs.ErrTimeout)
+    }
+    if elapsed := time.Since(start); elapsed > 10 * time.Second {
+        t.Errorf("cancelled after %s", elapsed)
+    }
+}
+
+func TestNewErrors(t *testing.T) {
+    s, c := newTestServer(t)
+    defer s.Close()
+
+    wrongPassword := *c
+    wrongPassword.Password = "wrong"
+
+    wrongHostKey := *c
+    wrongHostKey.HostKeyFingerprint = ssh.FingerprintSHA256(sshtest.NewSigner().PublicKey())
+
+    listener, _ := net.Listen("tcp", "127.0.0.1:0")
+    closedPort := *c
+    closedPort.Port = uint16(listener.Addr().(*net.TCPAddr).Port)
+    listener.Close()
+
+    tests := []struct {
+        name       string
+        connection *Connection
+        want       error
+    }{
+        { "auth",     &wrongPassword, errs.ErrAuth },
+        { "host key", &wrongHostKey,  errs.ErrHostKey },
+        { "dial",     &closedPort,    errs.ErrDial },
+    }
+
+    for _, test := range tests {
+        _, err := New(test.connection, testScript, testArguments{})
+        if !errors.Is(err, test.want) {
+            t.Errorf("%s: error %v does not match %v", test.name, err, test.want)
+        }
+    }
+
+    var hostKeyErr *HostKeyError
+    _, err := New(&wrongHostKey, testScript, testArguments{})
+    if !errors.As(err, &hostKeyErr) || hostKeyErr.Fingerprint != s.HostKeyFingerprint() {
+        t.Errorf("error %v doesn't report the fingerprint of the host key", err)
+    }
+}
+
+func TestPoolReusesClient(t *testing.T) {
+    s, c := newTestServer(t)
+    defer s.Close()
+
+    p := NewPool(2, time.Minute)
+    defer p.Close()
+
+    for i := 0; i < 3; i++ {
+        _, stdout, _, err := runPooledTestScript(p, c, testArguments{ Message: "pooled" })
+        if err != nil || stdout != "stdout: pooled" {
+            t.Errorf("run %d: stdout = %q, error = %v", i, stdout, err)
+        }
+    }
+
+    if n := s.Connections(); n != 1 {
+        t.Errorf("connections = %d, want 1", n)
+    }
+    if n := p.Len(); n != 1 {
+        t.Errorf("pooled clients = %d, want 1", n)
+    }
+}
+
+func TestPoolReconnects(t *testing.T) {
+    s, c := newTestServer(t)
+    defer s.Close()
+
+    p := NewPool(2, time.Minute)
+    defer p.Close()
+
+    _, _, _, err := runPooledTestScript(p, c, testArguments{ Message: "first" })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    // break the pooled client, the next runner dials a new one
+    s.CloseConnections()
+    time.Sleep(100 * time.Millisecond)
+
+    _, stdout, _, err := runPooledTestScript(p, c, testArguments{ Message: "second" })
+    if err != nil || stdout != "stdout: second" {
+        t.Errorf("stdout = %q, error = %v", stdout, err)
+    }
+    if n := s.Connections(); n != 2 {
+        t.Errorf("connections = %d, want 2", n)
+    }
+}
+
+func TestPoolRefusedSession(t *testing.T) {
+    s, c := newTestServer(t, func(s *sshtest.Server) { s.MaxSessions = 1 })
+    defer s.Close()
+
+    p := NewPool(0, time.Minute)
+    defer p.Close()
+
+    // the server refuses the second session on the first client, the first client must keep working
+    first, err := p.New(c, testScript, testArguments{ Message: "first" })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    defer first.Close()
+
+    _, stdout, _, err := runPooledTestScript(p, c, testArguments{ Message: "second" })
+    if err != nil || stdout != "stdout: second" {
+        t.Errorf("second: stdout = %q, error = %v", stdout, err)
+    }
+
+    var buffer bytes.Buffer
+    first.SetStdoutWriter(&buffer)
+    err = first.Run()
+    if stdout := strings.TrimSpace(buffer.String()); err != nil || stdout != "stdout: first" {
+        t.Errorf("first: stdout = %q, error = %v", stdout, err)
+    }
+
+    if n := s.Connections(); n != 2 {
+        t.Errorf("connections = %d, want 2", n)
+    }
+}
+
+func TestPoolSeparatesCredentials(t *testing.T) {
+    s, c := newTestServer(t)
+    defer s.Close()
+
+    p := NewPool(2, time.Minute)
+    defer p.Close()
+
+    _, _, _, err := runPooledTestScript(p, c, testArguments{ Message: "first" })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    // same host, port and user, but the wrong password must not reuse the authenticated client
+    wrongPassword := *c
+    wrongPassword.Password = "wrong-password"
+    _, _, _, err = runPooledTestScript(p, &wrongPassword, testArguments{ Message: "second" })
+    if !errors.Is(err, errs.ErrAuth) {
+        t.Errorf("error %v does not match %v", err, errs.ErrAuth)
+    }
+    if n := p.Len(); n != 1 {
+        t.Errorf("pooled clients = %d, want 1", n)
+    }
+}
+
+func TestRunJumpHost(t *testing.T) {
+    s, c := newTestServer(t)
+    defer s.Close()
+
+    jump, jc := newTestServer(t)
+    defer jump.Close()
+
+    c.JumpHosts = []Connection{ *jc }
+    _, stdout, _, err := runTestScript(c, testArguments{ Message: "tunnelled" })
+    if err != nil || stdout != "stdout: tunnelled" {
+        t.Errorf("stdout = %q, error = %v", stdout, err)
+    }
+
+    if len(jump.Commands()) != 0 || len(s.Commands()) != 1 {
+        t.Errorf("commands = %q on jump host, %q on target, want the command on the target only", jump.Commands(), s.Commands())
+    }
+}
+
+func TestRunLocalUser(t *testing.T) {
+    // like OpenSSH, the host and the jump hosts without a user use the local user
+    local := localUsername()
+    s, c := newTestServer(t, func(s *sshtest.Server) { s.Passwords[local] = "my-password" })
+    defer s.Close()
+
+    jump, jc := newTestServer(t, func(s *sshtest.Server) { s.Passwords[local] = "my-password" })
+    defer jump.Close()
+
+    c.User = ""
+    jc.User = ""
+    c.JumpHosts = []Connection{ *jc }
+    _, stdout, _, err := runTestScript(c, testArguments{ Message: "local user" })
+    if err != nil || stdout != "stdout: local user" {
+        t.Errorf("stdout = %q, error = %v", stdout, err)
+    }
+}
+
+func TestRunEnvArguments(t *testing.T) {
+    envScript := script.New("env", "bash", `printf '[%s]' "$ARG_MESSAGE" "$ARG_EXIT_CODE"`, script.WithEnvArguments())
+    message := "it's \"quoted\" $(touch injected) `id`\nnext line"
+
+    for _, reject := range []bool{ false, true } {
+        s, c := newTestServer(t, func(s *sshtest.Server) {
+            s.RejectEnv = reject
+        })
+
+        r, err := New(c, envScript, testArguments{ Message: message, ExitCode: 3 })
+        if err != nil {
+            t.Fatalf("unexpected error: %v", err)
+        }
+
+        var stdout bytes.Buffer
+        r.SetStdoutWriter(&stdout)
+        err = r.Run()
+        r.Close()
+        s.Close()
+        if err != nil {
+            t.Fatalf("reject %t: unexpected error: %v", reject, err)
+        }
+
+        want := "[" + message + "][3]"
+        if stdout.String() != want {
+            t.Errorf("reject %t: stdout = %q, want %q", reject, stdout.String(), want)
+        }
+    }
+}
+
+func TestRunDirEnv(t *testing.T) {
+    dir, err := ioutil.TempDir("", "ssh")
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    defer os.RemoveAll(dir)
+    dir, _ = filepath.EvalSymlinks(dir)
+
+    envScript := script.New("env", "bash", `printf '[%s]' "$PWD" "$TEST_SSH_INHERITED" "$TEST_SSH_EXTRA"`)
+    tests := []struct {
+        reject bool
+        clean  bool
+        want   string
+    }{
+        { false, false, "[" + dir + "][inherited][it's extra]" },
+        { true,  false, "[" + dir + "][inherited][it's extra]" },
+        { false, true,  "[" + dir + "][][it's extra]" },
+    }
+
+    for _, test := range tests {
+        s, c := newTestServer(t, func(s *sshtest.Server) {
+            s.Env = []string{ "TEST_SSH_INHERITED=inherited" }
+            s.RejectEnv = test.reject
+        })
+
+        r, err := New(c, envScript, nil)
+        if err != nil {
+            t.Fatalf("unexpected error: %v", err)
+        }
+
+        var stdout bytes.Buffer
+        r.SetStdoutWriter(&stdout)
+        r.SetDir(dir)
+        r.SetEnv([]string{ "TEST_SSH_EXTRA=it's extra" })
+        r.SetCleanEnv(test.clean)
+        err = r.Run()
+        r.Close()
+        s.Close()
+        if err != nil {
+            t.Fatalf("reject %t, clean %t: unexpected error: %v", test.reject, test.clean, err)
+        }
+
+        if stdout.String() != test.want {
+            t.Errorf("reject %t, clean %t: stdout = %q, want %q", test.reject, test.clean, stdout.String(), test.want)
+        }
+        if test.clean && r.Command() != "env -i bash -" {
+            t.Errorf("command = %q, want %q", r.Command(), "env -i bash -")
+        }
+    }
+}
+
+func TestRunDirMissing(t *testing.T) {
+    s, c := newTestServer(t)
+    defer s.Close()
+
+    r, err := New(c, testScript, testArguments{ Message: "hello" })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    defer r.Close()
+
+    var stdout bytes.Buffer
+    r.SetStdoutWriter(&stdout)
+    r.SetDir("/no/such/dir")
+    err = r.Run()
+    if !errors.Is(err, errs.ErrExit) || r.ExitCode() != 1 {
+        t.Errorf("error = %v, exitcode = %d, want an exit error with exitcode 1", err, r.ExitCode())
+    }
+    if stdout.Len() != 0 {
+        t.Errorf("stdout = %q, the script must not run", stdout.String())
+    }
+}
+
+//------------------------------------------------------------------------------
+
+// fake sudo, accepting password "secret", logging its arguments to FAKE_SUDO_LOG
+const fakeSudo = `#!/bin/sh
+echo "$*" >> "$FAKE_SUDO_LOG"
+user=root
+while [ $# -gt 0 ]; do
+    case "$1" in
+    -S|-k|-n) shift ;;
+    -p) shift 2 ;;
+    -u) user=$2; shift 2 ;;
+    --) shift; break ;;
+    *) break ;;
+    esac
+done
+IFS= read -r password
+[ "$password" = secret ] || { echo "Sorry, try again." >&2; exit 1; }
+FAKE_SUDO_USER=$user exec "$@"
+`
+
+func TestRunBecome(t *testing.T) {
+    dir, err := ioutil.TempDir("", "ssh")
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    defer os.RemoveAll(dir)
+
+    err = ioutil.WriteFile(filepath.Join(dir, "sudo"), []byte(fakeSudo), 0755)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    log := filepath.Join(dir, "sudo.log")
+
+    s, c := newTestServer(t, func(s *sshtest.Server) {
+        s.Env = []string{ "PATH=" + dir + string(os.PathListSeparator) + os.Getenv("PATH"), "FAKE_SUDO_LOG=" + log }
+    })
+    defer s.Close()
+
+    becomeScript := script.New("become", "bash", `printf '[%s]' "$FAKE_SUDO_USER" "$TEST_SSH_EXTRA" "$PWD"`)
+
+    r, err := New(c, becomeScript, nil)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    var stdout bytes.Buffer
+    r.SetStdoutWriter(&stdout)
+    r.SetDir(dir)
+    r.SetEnv([]string{ "TEST_SSH_EXTRA=extra" })
+    r.SetBecome("sudo", "deploy", "secret")
+    err = r.Run()
+    r.Close()
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    dir, _ = filepath.EvalSymlinks(dir)
+    if want := "[deploy][extra][" + dir + "]"; stdout.String() != want {
+        t.Errorf("stdout = %q, want %q", stdout.String(), want)
+    }
+    if !strings.HasPrefix(r.Command(), "sh -c ") {
+        t.Errorf("command = %q, want a command starting with \"sh -c \"", r.Command())
+    }
+
+    // the password is sent on stdin, never as an argument
+    b, _ := ioutil.ReadFile(log)
+    if len(b) == 0 || strings.Contains(string(b), "secret") || strings.Contains(r.Command(), "secret") {
+        t.Errorf("sudo arguments = %q, want arguments without password", b)
+    }
+
+    r, err = New(c, becomeScript, nil)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    defer r.Close()
+
+    r.SetBecome("sudo", "", "wrong")
+    stderr, _ := r.StderrPipe()
+    err = r.Start()
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    _, _ = ioutil.ReadAll(stderr)
+
+    err = r.Wait()
+    if !errors.Is(err, errs.ErrBecome) || errors.Is(err, errs.ErrSession) || r.ExitCode() != -1 {
+        t.Errorf("error = %v, exitcode = %d, want ErrBecome, -1", err, r.ExitCode())
+    }
+
+    // a terminal merges stderr into stdout
+    r, err = New(c, becomeScript, nil)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    defer r.Close()
+
+    r.SetBecome("sudo", "", "wrong")
+    r.SetPty("", 0, 0)
+    err = r.Run()
+    if !errors.Is(err, errs.ErrBecome) || r.ExitCode() != -1 {
+        t.Errorf("pty: error = %v, exitcode = %d, want ErrBecome, -1", err, r.ExitCode())
+    }
+}
+
+//------------------------------------------------------------------------------
+
+func TestRunPty(t *testing.T) {
+    s, c := newTestServer(t)
+    defer s.Close()
+
+    // a long line and control characters reach the shell unchanged, and aren't echoed
+    long := strings.Repeat("x", 5000)
+    ptyScript := script.New("pty", "bash", `
+        line='{{.Message}}'
+        [ -t 1 ] && [ -t 2 ] && echo "terminal $TERM $(stty size </dev/tty) ${#line}"
+        echo "stderr" >&2
+        exit {{.ExitCode}}
+    `)
+
+    r, err := New(c, ptyScript, testArguments{ Message: long + "\x03\x04\x1a", ExitCode: 3 })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    defer r.Close()
+
+    var stdout, stderr bytes.Buffer
+    r.SetStdoutWriter(&stdout)
+    r.SetStderrWriter(&stderr)
+    r.SetPty("vt100", 100, 30)
+    err = r.Run()
+    if !errors.Is(err, errs.ErrExit) || r.ExitCode() != 3 {
+        t.Errorf("error = %v, exitcode = %d, want an exit error with exitcode 3", err, r.ExitCode())
+    }
+    if !strings.HasPrefix(r.Command(), "head -c ") {
+        t.Errorf("command = %q, want a command starting with \"head -c \"", r.Command())
+    }
+
+    want := "terminal vt100 30 100 5003\r\nstderr\r\n"
+    if stdout.String() != want || stderr.Len() != 0 {
+        t.Errorf("stdout = %q, stderr = %q, want %q, \"\"", stdout.String(), stderr.String(), want)
+    }
+}
+
+//------------------------------------------------------------------------------
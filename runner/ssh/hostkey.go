@@ -0,0 +1,191 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package ssh
+
+import (
+    "errors"
+    "fmt"
+    "github.com/mitchellh/go-homedir"
+    "net"
+    "os"
+    "golang.org/x/crypto/ssh/knownhosts"
+    "path/filepath"
+    "golang.org/x/crypto/ssh"
+    "strings"
+    "sync"
+)
+
+//------------------------------------------------------------------------------
+
+const defaultKnownHosts = "~/.ssh/known_hosts"
+
+//------------------------------------------------------------------------------
+
+type HostKeyError struct {
+    Host        string     // host as dialed, "host:port"
+    Fingerprint string     // SHA256 fingerprint of the key presented by the host
+    Want        []string   // SHA256 fingerprints of the expected keys, empty when the host is unknown
+    Revoked     bool       // the key presented by the host is revoked in a known_hosts-file
+}
+
+func (e *HostKeyError) Error() string {
+    switch {
+    case e.Revoked:
+        return fmt.Sprintf("host key for %s is revoked: %s", e.Host, e.Fingerprint)
+    case len(e.Want) == 0:
+        return fmt.Sprintf("host %s is unknown, host key: %s", e.Host, e.Fingerprint)
+    default:
+        return fmt.Sprintf("host key mismatch for %s: got %s, want %s", e.Host, e.Fingerprint, strings.Join(e.Want, " or "))
+    }
+}
+
+//------------------------------------------------------------------------------
+
+type hostKeyChecker struct {
+    callback        ssh.HostKeyCallback
+    fingerprint     string   // pinned fingerprint
+    trustOnFirstUse bool
+    file            string   // known_hosts-file where unknown hosts are added when 'trustOnFirstUse'
+
+    mu  sync.Mutex
+    err *HostKeyError   // the ssh client doesn't preserve the type of errors from the callback, so we keep the last one here
+}
+
+func newHostKeyChecker(c *Connection) (*hostKeyChecker, error) {
+    h := new(hostKeyChecker)
+
+    if c.Insecure {
+        h.callback = ssh.InsecureIgnoreHostKey()
+        return h, nil
+    }
+
+    if c.HostKeyFingerprint != "" {
+        h.fingerprint = c.HostKeyFingerprint
+        if !strings.HasPrefix(h.fingerprint, "SHA256:") {
+            h.fingerprint = "SHA256:" + h.fingerprint
+        }
+        return h, nil
+    }
+
+    knownHosts := c.KnownHosts
+    if knownHosts == "" {
+        knownHosts = defaultKnownHosts
+    }
+
+    var files []string
+    for _, f := range strings.Split(knownHosts, ",") {
+        f = strings.TrimSpace(f)
+        if f == "" {
+            continue
+        }
+
+        path, err := homedir.Expand(f)
+        if err != nil {
+            return nil, fmt.Errorf("[golang-exec/runner/ssh/newHostKeyChecker()] cannot find home directory of current user: %w\n", err)
+        }
+        files = append(files, path)
+    }
+
+    if c.TrustOnFirstUse && len(files) > 0 {
+        // make sure the file exists, knownhosts.New() fails on a missing file
+        h.trustOnFirstUse = true
+        h.file = files[0]
+        err := os.MkdirAll(filepath.Dir(h.file), 0700)
+        if err == nil {
+            var f *os.File
+            f, err = os.OpenFile(h.file, os.O_CREATE | os.O_WRONLY, 0600)
+            if err == nil {
+                err = f.Close()
+            }
+        }
+        if err != nil {
+            return nil, fmt.Errorf("[golang-exec/runner/ssh/newHostKeyChecker()] cannot create 'known_hosts'-file: %w\n", err)
+        }
+    }
+
+    callback, err := knownhosts.New(files...)
+    if err != nil {
+        return nil, fmt.Errorf("[golang-exec/runner/ssh/newHostKeyChecker()] cannot access 'known_hosts'-file: %w\n", err)
+    }
+    h.callback = callback
+
+    return h, nil
+}
+
+func (h *hostKeyChecker) Check(hostname string, remote net.Addr, key ssh.PublicKey) error {
+    fingerprint := ssh.FingerprintSHA256(key)
+
+    if h.callback == nil {
+        // pinned fingerprint
+        if fingerprint != h.fingerprint {
+            return h.reject(&HostKeyError{ Host: hostname, Fingerprint: fingerprint, Want: []string{ h.fingerprint } })
+        }
+        return nil
+    }
+
+    err := h.callback(hostname, remote, key)
+    if err == nil {
+        return nil
+    }
+
+    var revokedErr *knownhosts.RevokedError
+    if errors.As(err, &revokedErr) {
+        return h.reject(&HostKeyError{ Host: hostname, Fingerprint: fingerprint, Revoked: true })
+    }
+
+    var keyErr *knownhosts.KeyError
+    if errors.As(err, &keyErr) {
+        if len(keyErr.Want) == 0 && h.trustOnFirstUse {
+            return h.trust(hostname, key)
+        }
+
+        want := make([]string, len(keyErr.Want))
+        for i, k := range keyErr.Want {
+            want[i] = ssh.FingerprintSHA256(k.Key)
+        }
+        return h.reject(&HostKeyError{ Host: hostname, Fingerprint: fingerprint, Want: want })
+    }
+
+    return err
+}
+
+func (h *hostKeyChecker) Err() *HostKeyError {
+    // returns the error for the last rejected host key, nil when no host key was rejected
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    return h.err
+}
+
+func (h *hostKeyChecker) reject(err *HostKeyError) error {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    h.err = err
+    return err
+}
+
+func (h *hostKeyChecker) trust(hostname string, key ssh.PublicKey) error {
+    // adds an unknown host to the known_hosts-file
+    h.mu.Lock()
+    defer h.mu.Unlock()
+
+    f, err := os.OpenFile(h.file, os.O_APPEND | os.O_WRONLY, 0600)
+    if err != nil {
+        return fmt.Errorf("[golang-exec/runner/ssh/trust()] cannot open 'known_hosts'-file: %w\n", err)
+    }
+    defer f.Close()
+
+    _, err = f.WriteString(knownhosts.Line([]string{ knownhosts.Normalize(hostname) }, key) + "\n")
+    if err != nil {
+        return fmt.Errorf("[golang-exec/runner/ssh/trust()] cannot write 'known_hosts'-file: %w\n", err)
+    }
+
+    return nil
+}
+
+//------------------------------------------------------------------------------
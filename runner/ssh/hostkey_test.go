@@ -0,0 +1,122 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package ssh
+
+import (
+    "errors"
+    "io/ioutil"
+    "net"
+    "os"
+    "path/filepath"
+    "golang.org/x/crypto/ssh"
+    "strings"
+    "testing"
+)
+
+//------------------------------------------------------------------------------
+
+func newTestHostKey(t *testing.T) ssh.PublicKey {
+    t.Helper()
+
+    key, _ := newTestKey(t, "")
+    pub, err := ssh.NewPublicKey(&key.PublicKey)
+    if err != nil {
+        t.Fatalf("cannot create public key: %v", err)
+    }
+
+    return pub
+}
+
+var testRemote = &net.TCPAddr{ IP: net.IPv4(127, 0, 0, 1), Port: 2222 }
+
+//------------------------------------------------------------------------------
+
+func TestHostKeyFingerprint(t *testing.T) {
+    key := newTestHostKey(t)
+    other := newTestHostKey(t)
+
+    fingerprint := ssh.FingerprintSHA256(key)
+    h, err := newHostKeyChecker(&Connection{ HostKeyFingerprint: strings.TrimPrefix(fingerprint, "SHA256:") })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    if err := h.Check("127.0.0.1:2222", testRemote, key); err != nil {
+        t.Errorf("unexpected error: %v", err)
+    }
+
+    err = h.Check("127.0.0.1:2222", testRemote, other)
+    var hostKeyErr *HostKeyError
+    if !errors.As(err, &hostKeyErr) {
+        t.Fatalf("error %v is not a HostKeyError", err)
+    }
+    if hostKeyErr.Fingerprint != ssh.FingerprintSHA256(other) {
+        t.Errorf("fingerprint = %q, want %q", hostKeyErr.Fingerprint, ssh.FingerprintSHA256(other))
+    }
+    if h.Err() != hostKeyErr {
+        t.Errorf("rejected host key is not recorded")
+    }
+}
+
+func TestHostKeyTrustOnFirstUse(t *testing.T) {
+    key := newTestHostKey(t)
+    other := newTestHostKey(t)
+
+    dir, err := ioutil.TempDir("", "golang-exec-knownhosts")
+    if err != nil {
+        t.Fatalf("cannot create temp dir: %v", err)
+    }
+    defer os.RemoveAll(dir)
+    file := filepath.Join(dir, "ssh", "known_hosts")
+
+    // unknown host is rejected without trust-on-first-use
+    _, err = newHostKeyChecker(&Connection{ KnownHosts: file })
+    if err == nil {
+        t.Errorf("expected an error for a missing known_hosts-file")
+    }
+
+    h, err := newHostKeyChecker(&Connection{ KnownHosts: file, TrustOnFirstUse: true })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if err := h.Check("127.0.0.1:2222", testRemote, key); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    content, err := ioutil.ReadFile(file)
+    if err != nil {
+        t.Fatalf("cannot read known_hosts-file: %v", err)
+    }
+    if !strings.HasPrefix(string(content), "[127.0.0.1]:2222 ") {
+        t.Errorf("known_hosts-file = %q, host is not added", string(content))
+    }
+
+    // known host is accepted, changed host key is rejected
+    h, err = newHostKeyChecker(&Connection{ KnownHosts: file })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if err := h.Check("127.0.0.1:2222", testRemote, key); err != nil {
+        t.Errorf("unexpected error: %v", err)
+    }
+
+    err = h.Check("127.0.0.1:2222", testRemote, other)
+    var hostKeyErr *HostKeyError
+    if !errors.As(err, &hostKeyErr) {
+        t.Fatalf("error %v is not a HostKeyError", err)
+    }
+    if len(hostKeyErr.Want) != 1 || hostKeyErr.Want[0] != ssh.FingerprintSHA256(key) {
+        t.Errorf("want = %v, want [%s]", hostKeyErr.Want, ssh.FingerprintSHA256(key))
+    }
+
+    err = h.Check("127.0.0.1:2223", testRemote, other)
+    if !errors.As(err, &hostKeyErr) || len(hostKeyErr.Want) != 0 {
+        t.Errorf("error %v is not a HostKeyError for an unknown host", err)
+    }
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,246 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package ssh
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "golang.org/x/crypto/ssh"
+    "sync"
+    "time"
+
+    "github.com/stefaanc/golang-exec/runner/internal/errs"
+    "github.com/stefaanc/golang-exec/script"
+)
+
+//------------------------------------------------------------------------------
+
+// a pool shares ssh clients between runners with the same connection: host, port, user, credentials, host key checks and jump hosts
+// each runner opens its own session on a shared client
+type Pool struct {
+    MaxSessions int             // maximum number of concurrent sessions per client, a new client is dialed when all clients are busy, 0 when unlimited
+    IdleTimeout time.Duration   // a client without sessions is closed after this duration, 0 when never
+
+    mu      sync.Mutex
+    clients map[string][]*pooledClient
+}
+
+type pooledClient struct {
+    key       string
+    client    *ssh.Client
+    sessions  int
+    full      bool   // the server refused a session while the client was alive, no new sessions until a session is released
+    idleTimer *time.Timer
+}
+
+// pool used by runners for connections with 'Pooled' set
+// the default maximum number of sessions matches the default 'MaxSessions' of OpenSSH's sshd
+var DefaultPool = NewPool(10, 5 * time.Minute)
+
+//------------------------------------------------------------------------------
+
+func NewPool(maxSessions int, idleTimeout time.Duration) *Pool {
+    return &Pool{
+        MaxSessions: maxSessions,
+        IdleTimeout: idleTimeout,
+    }
+}
+
+func (p *Pool) New(connection interface{}, s *script.Script, arguments interface{}) (*Runner, error) {
+    // creates a runner that opens its session on a client from this pool, also when 'Pooled' isn't set in the connection
+    c, err := toConnection(connection)
+    if err != nil {
+        return nil, &Error{
+            script: s,
+            exitCode: -1,
+            err: fmt.Errorf("[golang-exec/runner/ssh/New()] invalid 'connection' parameter: %w\n", err),
+        }
+    }
+
+    return newRunner(c, s, arguments, p)
+}
+
+func (p *Pool) Close() error {
+    // closes all clients in the pool, including the clients with sessions in use
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    for _, clients := range p.clients {
+        for _, pc := range clients {
+            if pc.idleTimer != nil {
+                pc.idleTimer.Stop()
+            }
+            pc.client.Close()
+        }
+    }
+    p.clients = nil
+
+    return nil
+}
+
+func (p *Pool) Len() int {
+    // returns the number of clients in the pool
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    n := 0
+    for _, clients := range p.clients {
+        n += len(clients)
+    }
+    return n
+}
+
+//------------------------------------------------------------------------------
+
+func (p *Pool) newSession(c *Connection) (*ssh.Session, func(), error) {
+    // returns a session on a pooled client, and a function to release the client when the session is no longer used
+    key := poolKey(c)
+
+    var err error
+    for attempt := 0; attempt < 2; attempt++ {
+        var pc *pooledClient
+        pc, err = p.acquire(key, c)
+        if err != nil {
+            return nil, nil, err
+        }
+
+        var session *ssh.Session
+        session, err = pc.client.NewSession()
+        if err != nil {
+            err = fmt.Errorf("[golang-exec/runner/ssh/newSession()] cannot open session: %w\n", errs.Wrap(errs.ErrSession, err))
+            if isAlive(pc.client) {
+                // the server refused the session, for instance because of its "MaxSessions"
+                // other runners are still using the client, retry on another client
+                p.refuse(pc)
+            } else {
+                // the connection is broken, discard the client and retry on a new client
+                p.discard(pc)
+            }
+            continue
+        }
+
+        var once sync.Once
+        return session, func() { once.Do(func() { p.release(pc) }) }, nil
+    }
+
+    return nil, nil, err
+}
+
+func (p *Pool) acquire(key string, c *Connection) (*pooledClient, error) {
+    p.mu.Lock()
+    for _, pc := range p.clients[key] {
+        if !pc.full && (p.MaxSessions <= 0 || pc.sessions < p.MaxSessions) {
+            pc.sessions++
+            if pc.idleTimer != nil {
+                pc.idleTimer.Stop()
+                pc.idleTimer = nil
+            }
+            p.mu.Unlock()
+            return pc, nil
+        }
+    }
+    p.mu.Unlock()
+
+    // dial without holding the lock, dialing can take a while
+    client, err := dial(c)
+    if err != nil {
+        return nil, err
+    }
+    pc := &pooledClient{ key: key, client: client, sessions: 1 }
+
+    p.mu.Lock()
+    if p.clients == nil {
+        p.clients = make(map[string][]*pooledClient)
+    }
+    p.clients[key] = append(p.clients[key], pc)
+    p.mu.Unlock()
+
+    // remove the client from the pool when the connection breaks
+    go func() {
+        _ = client.Wait()
+        p.discard(pc)
+    }()
+
+    return pc, nil
+}
+
+func (p *Pool) release(pc *pooledClient) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    pc.sessions--
+    pc.full = false
+    if pc.sessions > 0 || p.IdleTimeout <= 0 {
+        return
+    }
+
+    pc.idleTimer = time.AfterFunc(p.IdleTimeout, func() {
+        p.mu.Lock()
+        idle := pc.sessions == 0
+        if idle {
+            p.remove(pc)
+        }
+        p.mu.Unlock()
+
+        if idle {
+            pc.client.Close()
+        }
+    })
+}
+
+func (p *Pool) refuse(pc *pooledClient) {
+    // releases a client that refused a session, the client isn't used for new sessions until one of its sessions is released
+    p.release(pc)
+
+    p.mu.Lock()
+    pc.full = pc.sessions > 0
+    p.mu.Unlock()
+}
+
+func (p *Pool) discard(pc *pooledClient) {
+    p.mu.Lock()
+    p.remove(pc)
+    p.mu.Unlock()
+
+    pc.client.Close()
+}
+
+func (p *Pool) remove(pc *pooledClient) {
+    // must be called while holding the lock
+    clients := p.clients[pc.key]
+    for i, other := range clients {
+        if other == pc {
+            clients = append(clients[:i], clients[i+1:]...)
+            break
+        }
+    }
+
+    if len(clients) == 0 {
+        delete(p.clients, pc.key)
+    } else {
+        p.clients[pc.key] = clients
+    }
+}
+
+
+func poolKey(c *Connection) string {
+    // clients are only shared between runners with the same connection, after applying the ssh config and the defaults
+    // the connection is hashed, so the key doesn't keep the secrets in memory
+    normalized := *c
+    normalized.Pooled = false
+    sum := sha256.Sum256([]byte(fmt.Sprintf("%#v", normalized)))
+    return hex.EncodeToString(sum[:])
+}
+
+func isAlive(client *ssh.Client) bool {
+    // a server replies to a keepalive request, also when it doesn't support it
+    _, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+    return err == nil
+}
+
+//------------------------------------------------------------------------------
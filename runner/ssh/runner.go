@@ -7,16 +7,22 @@
 package ssh
 
 import (
+    "bytes"
+    "context"
     "errors"
     "fmt"
-    "github.com/mitchellh/go-homedir"
     "io"
-    "golang.org/x/crypto/ssh/knownhosts"
-    "reflect"
+    "io/ioutil"
+    "net"
     "golang.org/x/crypto/ssh"
     "strconv"
     "strings"
+    "time"
 
+    "github.com/stefaanc/golang-exec/runner/internal/become"
+    "github.com/stefaanc/golang-exec/runner/internal/decode"
+    "github.com/stefaanc/golang-exec/runner/internal/errs"
+    "github.com/stefaanc/golang-exec/runner/internal/watchdog"
     "github.com/stefaanc/golang-exec/script"
 )
 
@@ -24,11 +30,32 @@ import (
 
 type Connection struct {
     Type     string   // must be "ssh"
-    Host     string
-    Port     uint16
+    Host     string   `exec:",required"`
+    Port     uint16   `exec:",default=22"`
     User     string
-    Password string
+    Password string   `exec:",secret"`
     Insecure bool
+
+    PrivateKey          string   `exec:",secret"`   // PEM-encoded private key
+    PrivateKeyFile      string                     // path to a PEM-encoded private key file
+    Passphrase          string   `exec:",secret"`   // passphrase to decrypt 'PrivateKey' or 'PrivateKeyFile'
+    Certificate         string   // OpenSSH user certificate for the private key, in the format of a "-cert.pub" file
+    CertificateFile     string   // path to an OpenSSH user certificate file
+    Agent               bool     // use the ssh-agent listening on 'SSH_AUTH_SOCK'
+    KeyboardInteractive bool     // answer all keyboard-interactive questions with 'Password'
+    AuthMethods         string   // comma-separated order in which auth methods are tried, default "agent,publickey,keyboard-interactive,password"
+
+    KnownHosts          string   // comma-separated list of known_hosts-files, default "~/.ssh/known_hosts"
+    HostKeyFingerprint  string   // expected SHA256 fingerprint of the host key, replaces the known_hosts-files
+    TrustOnFirstUse     bool     // add unknown hosts to the first known_hosts-file instead of rejecting them
+
+    Pooled              bool     // share the ssh client with other runners for the same connection, using 'DefaultPool'
+
+    JumpHosts           []Connection   // chain of jump hosts to tunnel through, the first one is dialed directly
+
+    UseConfig           bool     // resolve 'Host' and the jump hosts as aliases using the OpenSSH client config files
+    ConfigFiles         string   // comma-separated list of OpenSSH client config files, default "~/.ssh/config,/etc/ssh/ssh_config"
+    AllowConfigInsecure bool     // allow "StrictHostKeyChecking no" in the config files to disable host key verification, otherwise it is treated as "accept-new"
 }
 
 type Error struct {
@@ -41,11 +68,29 @@ type Error struct {
 type Runner struct {
     script  *script.Script
     command string
-    client  *ssh.Client
     session *ssh.Session
+    release func()   // closes or releases the client when the session is no longer used
+    stdin   io.Reader
     running bool
 
+    env      []string   // from the arguments, when using script.WithEnvArguments()
+    extraEnv []string
+    cleanEnv bool
+    dir      string
+    become   *become.Become
+    detector become.Detector   // detects when the become password or user is rejected
+
+    pty     bool
+    term    string
+    columns int
+    rows    int
+
+    watchdog   watchdog.Watchdog
+    stdoutPipe bool
+    stderrPipe bool
+
     exitCode int
+    signal   string
 }
 
 //------------------------------------------------------------------------------
@@ -59,123 +104,165 @@ func (e *Error) Unwrap()   error          { return e.err }
 //------------------------------------------------------------------------------
 
 func New(connection interface{}, s *script.Script, arguments interface{}) (*Runner, error) {
+    c, err := toConnection(connection)
+    if err != nil {
+        return nil, &Error{
+            script: s,
+            exitCode: -1,
+            err: fmt.Errorf("[golang-exec/runner/ssh/New()] invalid 'connection' parameter: %w\n", err),
+        }
+    }
+
+    if c.Pooled {
+        return newRunner(c, s, arguments, DefaultPool)
+    }
+
+    return newRunner(c, s, arguments, nil)
+}
+
+func newRunner(c *Connection, s *script.Script, arguments interface{}, pool *Pool) (*Runner, error) {
     if s.Error != nil {
         return nil, &Error{
             script: s,
             exitCode: -1,
-            err: fmt.Errorf("[golang-exec/runner/ssh/New()] script failed to parse: %#w\n", s.Error),
+            err: fmt.Errorf("[golang-exec/runner/ssh/New()] script failed to parse: %w\n", errs.Wrap(errs.ErrParse, s.Error)),
         }
     }
 
-    c := toConnection(connection)
     r := new(Runner)
     r.script = s
     r.command = s.Command()
+    r.watchdog.Timeout = s.Timeout   // from the front-matter of the script, can be overridden using SetTimeout()
 
     stdin, err := s.NewReader(arguments)
     if err != nil {
         return nil, &Error{
             script: s,
             exitCode: -1,
-            err: fmt.Errorf("[golang-exec/runner/ssh/New()] cannot create stdin reader: %#w\n", err),
+            err: fmt.Errorf("[golang-exec/runner/ssh/New()] cannot create stdin reader: %w\n", errs.Wrap(errs.ErrRender, err)),
         }
     }
 
-    address := fmt.Sprintf("%s:%d", c.Host, c.Port)
-
-    config := &ssh.ClientConfig{
-        User: c.User,
-        Auth: []ssh.AuthMethod{
-            ssh.Password(c.Password),
-        },
-    }
-    if c.Insecure {
-        config.HostKeyCallback = ssh.InsecureIgnoreHostKey()
-    } else {
-        f, err := homedir.Expand("~/.ssh/known_hosts")
-        if err != nil {
-            return nil, &Error{
-                script: s,
-                exitCode: -1,
-                err: fmt.Errorf("[golang-exec/runner/ssh/New()] cannot find home directory of current user: %#w\n", err),
-            }
+    env, err := s.Environment(arguments)
+    if err != nil {
+        return nil, &Error{
+            script: s,
+            exitCode: -1,
+            err: fmt.Errorf("[golang-exec/runner/ssh/New()] cannot create environment: %w\n", errs.Wrap(errs.ErrRender, err)),
         }
+    }
 
-        hostKeyCallback, err := knownhosts.New(f)
-        if err != nil {
-            return nil, &Error{
-                script: s,
-                exitCode: -1,
-                err: fmt.Errorf("[golang-exec/runner/ssh/New()] cannot access 'known_hosts'-file: %#w\n", err),
-            }
+    err = applyConfig(c)
+    if err != nil {
+        return nil, &Error{
+            script: s,
+            exitCode: -1,
+            err: fmt.Errorf("[golang-exec/runner/ssh/New()] cannot apply ssh config: %w\n", err),
         }
-        config.HostKeyCallback = hostKeyCallback
     }
 
-    client, err := ssh.Dial("tcp", address, config)
+    err = decode.Validate(c)
     if err != nil {
         return nil, &Error{
             script: s,
             exitCode: -1,
-            err: fmt.Errorf("[golang-exec/runner/ssh/New()] cannot dial host: %#w\n", err),
+            err: fmt.Errorf("[golang-exec/runner/ssh/New()] invalid 'connection' parameter: %w\n", err),
         }
     }
-    r.client = client
 
-    session, err := client.NewSession()
+    var session *ssh.Session
+    var release func()
+    if pool != nil {
+        session, release, err = pool.newSession(c)
+    } else {
+        session, release, err = newSession(c)
+    }
     if err != nil {
         return nil, &Error{
             script: s,
             exitCode: -1,
-            err: fmt.Errorf("[golang-exec/runner/ssh/New()] cannot open session: %#w\n", err),
+            err: fmt.Errorf("[golang-exec/runner/ssh/New()] cannot open session: %w\n", err),
         }
     }
+
     r.session = session
-    r.session.Stdin  = stdin
+    r.release = release
+    r.stdin = stdin
+    r.env = env
 
     return r, nil
 }
 
-func toConnection(connection interface{}) *Connection {
+func toConnection(connection interface{}) (*Connection, error) {
+    // defaults are applied and required fields are checked after applying the ssh config
     c := new(Connection)
+    err := decode.DecodeFields(connection, c)
+    if err != nil {
+        return nil, err
+    }
 
-    v := reflect.Indirect(reflect.ValueOf(connection))
-    if v.Kind() == reflect.Struct {
-        c.Type     = v.FieldByName("Type").String()
-        c.Host     = v.FieldByName("Host").String()
-        c.Port     = uint16( v.FieldByName("Port").Uint() )
-        c.User     = v.FieldByName("User").String()
-        c.Password = v.FieldByName("Password").String()
-        c.Insecure = v.FieldByName("Insecure").Bool()
-    } else if v.Kind() == reflect.Map {
-        iter := v.MapRange()
-        for iter.Next() {
-            switch iter.Key().String() {
-            case "Type":
-                c.Type     = iter.Value().String()
-            case "Host":
-                c.Host     = iter.Value().String()
-            case "Port":
-                p, err := strconv.ParseUint(iter.Value().String(), 10, 16)
-                if err != nil {
-                    p = 0
-                }
-                c.Port     = uint16(p)
-            case "User":
-                c.User     = iter.Value().String()
-            case "Password":
-                c.Password = iter.Value().String()
-            case "Insecure":
-                b, err := strconv.ParseBool(strings.ToLower(iter.Value().String()))
-                if err != nil {
-                    b = false
-                }
-                c.Insecure = b
-            }
+    return c, nil
+}
+
+func ParseConnection(uri string) (*Connection, error) {
+    // parses "ssh://<user>:<password>@<host>:<port>?<field>=<value>&...", for instance "ssh://me@my-host:2222?known_hosts=~/.ssh/my_known_hosts"
+    // field names can be written in snake case, and are matched ignoring case
+    c := new(Connection)
+    err := decode.DecodeURI(uri, c)
+    if err != nil {
+        return nil, fmt.Errorf("[golang-exec/runner/ssh/ParseConnection()] invalid connection uri: %w\n", err)
+    }
+    if strings.ToLower(c.Type) != "ssh" {
+        return nil, errs.Wrap(errs.ErrConnection, fmt.Errorf("[golang-exec/runner/ssh/ParseConnection()] invalid connection uri, scheme must be \"ssh\"\n"))
+    }
+    if c.Host == "" {
+        return nil, errs.Wrap(errs.ErrConnection, fmt.Errorf("[golang-exec/runner/ssh/ParseConnection()] invalid connection uri, missing host\n"))
+    }
+
+    return c, nil
+}
+
+func (c Connection) String() string {
+    // returns the connection as a uri that can be parsed with ParseConnection(), with the secrets redacted
+    if c.Type == "" {
+        c.Type = "ssh"
+    }
+    return decode.EncodeURI(c)
+}
+
+func (c *Connection) UnmarshalText(text []byte) error {
+    // decodes "user@host:port", user and port are optional
+    // used for jump hosts specified as "JumpHosts": "user@host:port,..."
+    user, host, port := splitAddress(strings.TrimSpace(string(text)))
+    if host == "" {
+        return fmt.Errorf("[golang-exec/runner/ssh/UnmarshalText()] missing host in %q\n", string(text))
+    }
+
+    c.User = user
+    c.Host = host
+    if port != "" {
+        p, err := strconv.ParseUint(port, 10, 16)
+        if err != nil {
+            return fmt.Errorf("[golang-exec/runner/ssh/UnmarshalText()] invalid port in %q: %w\n", string(text), err)
         }
+        c.Port = uint16(p)
+    }
+
+    return nil
+}
+
+func splitAddress(address string) (user string, host string, port string) {
+    // splits "user@host:port", user and port are optional
+    if i := strings.LastIndex(address, "@"); i >= 0 {
+        user = address[:i]
+        address = address[i+1:]
     }
 
-    return c
+    h, p, err := net.SplitHostPort(address)
+    if err != nil {
+        return user, strings.Trim(address, "[]"), ""
+    }
+    return user, h, p
 }
 
 //------------------------------------------------------------------------------
@@ -188,6 +275,45 @@ func (r *Runner) SetStderrWriter(stderr io.Writer) {
     r.session.Stderr = stderr
 }
 
+func (r *Runner) SetTimeout(timeout time.Duration) {
+    r.watchdog.Timeout = timeout
+}
+
+func (r *Runner) SetIdleTimeout(timeout time.Duration) {
+    r.watchdog.IdleTimeout = timeout
+}
+
+func (r *Runner) SetDir(dir string) {
+    // the script is prepended with code that changes the directory
+    r.dir = dir
+}
+
+func (r *Runner) SetEnv(env []string) {
+    r.extraEnv = env
+}
+
+func (r *Runner) SetCleanEnv(clean bool) {
+    // the environment of a session cannot be cleared, so the shell is started using "env -i"
+    r.cleanEnv = clean
+    r.command = r.script.Command()
+    if clean {
+        r.command = "env -i " + r.command
+    }
+}
+
+func (r *Runner) SetBecome(method string, user string, password string) {
+    // the command is wrapped when starting the script, the password is sent on the first line of stdin
+    r.become = &become.Become{ Method: method, User: user, Password: password }
+}
+
+func (r *Runner) SetPty(term string, columns int, rows int) {
+    // the terminal is requested when starting the script, the script is sent to the terminal
+    r.pty = true
+    r.term = term
+    r.columns = columns
+    r.rows = rows
+}
+
 func (r *Runner) StdoutPipe() (io.Reader, error) {
     reader, err := r.session.StdoutPipe()
     if err != nil {
@@ -195,11 +321,12 @@ func (r *Runner) StdoutPipe() (io.Reader, error) {
         return nil, &Error{
             script: r.script,
             exitCode: r.exitCode,
-            err: fmt.Errorf("[golang-exec/runner/ssh/StdoutPipe()] cannot create stdout reader: %#w\n", err),
+            err: fmt.Errorf("[golang-exec/runner/ssh/StdoutPipe()] cannot create stdout reader: %w\n", errs.Wrap(errs.ErrStart, err)),
         }
     }
+    r.stdoutPipe = true
 
-    return reader, nil
+    return r.watchdog.Reader(r.detector.Reader(reader)), nil
 }
 
 func (r *Runner) StderrPipe() (io.Reader, error) {
@@ -209,16 +336,50 @@ func (r *Runner) StderrPipe() (io.Reader, error) {
         return nil, &Error{
             script: r.script,
             exitCode: r.exitCode,
-            err: fmt.Errorf("[golang-exec/runner/ssh/StderrPipe()] cannot create stderr reader: %#w\n", err),
+            err: fmt.Errorf("[golang-exec/runner/ssh/StderrPipe()] cannot create stderr reader: %w\n", errs.Wrap(errs.ErrStart, err)),
         }
     }
+    r.stderrPipe = true
 
-    return reader, nil
+    return r.watchdog.Reader(r.detector.Reader(reader)), nil
 }
 
 func (r *Runner) Run() error {
-    err := r.session.Run(r.command)
+    return r.RunContext(context.Background())
+}
+
+func (r *Runner) RunContext(ctx context.Context) error {
+    err := r.start(ctx)
     if err != nil {
+        r.exitCode = -1
+        if ctx.Err() != nil {
+            return &Error{
+                script: r.script,
+                command: r.command,
+                exitCode: r.exitCode,
+                err: fmt.Errorf("[golang-exec/runner/ssh/Run()] runner cancelled: %w\n", errs.FromContext(ctx.Err())),
+            }
+        }
+        return &Error{
+            script: r.script,
+            command: r.command,
+            exitCode: r.exitCode,
+            err: fmt.Errorf("[golang-exec/runner/ssh/Run()] cannot execute runner: %w\n", errs.Wrap(errs.ErrStart, err)),
+        }
+    }
+
+    err = r.wait()
+    if err != nil {
+        if cause := r.watchdog.Err(); cause != nil {
+            r.exitCode = -1
+            return &Error{
+                script: r.script,
+                command: r.command,
+                exitCode: r.exitCode,
+                err: fmt.Errorf("[golang-exec/runner/ssh/Run()] runner cancelled: %w\n", cause),
+            }
+        }
+
         var exitErr *ssh.ExitError
         if errors.As(err, &exitErr) {
             r.exitCode = exitErr.Waitmsg.ExitStatus()
@@ -226,15 +387,18 @@ func (r *Runner) Run() error {
                 script: r.script,
                 command: r.command,
                 exitCode: r.exitCode,
-                err: fmt.Errorf("[golang-exec/runner/ssh/Run()] runner failed: %#w\n", err),
+                err: fmt.Errorf("[golang-exec/runner/ssh/Run()] runner failed: %w\n", errs.Wrap(errs.ErrExit, err)),
             }
         } else {
             r.exitCode = -1
+            if !errors.Is(err, errs.ErrBecome) {
+                err = errs.Wrap(errs.ErrSession, err)
+            }
             return &Error{
                 script: r.script,
                 command: r.command,
                 exitCode: r.exitCode,
-                err: fmt.Errorf("[golang-exec/runner/ssh/Run()] cannot execute runner: %#w\n", err),
+                err: fmt.Errorf("[golang-exec/runner/ssh/Run()] cannot execute runner: %w\n", err),
             }
         }
     }
@@ -244,36 +408,60 @@ func (r *Runner) Run() error {
 }
 
 func (r *Runner) Start() error {
-    err := r.session.Start(r.command)
+    return r.StartContext(context.Background())
+}
+
+func (r *Runner) StartContext(ctx context.Context) error {
+    err := r.start(ctx)
     if err != nil {
         r.exitCode = -1
+        if ctx.Err() != nil {
+            return &Error{
+                script: r.script,
+                command: r.command,
+                exitCode: r.exitCode,
+                err: fmt.Errorf("[golang-exec/runner/ssh/Start()] runner cancelled: %w\n", errs.FromContext(ctx.Err())),
+            }
+        }
         return &Error{
             script: r.script,
             command: r.command,
             exitCode: r.exitCode,
-            err: fmt.Errorf("[golang-exec/runner/ssh/Start()] cannot start runner: %#w\n", err),
+            err: fmt.Errorf("[golang-exec/runner/ssh/Start()] cannot start runner: %w\n", errs.Wrap(errs.ErrStart, err)),
         }
     }
-    r.running = true
 
     return nil
 }
 
 func (r *Runner) Wait() error {
-    err := r.session.Wait()
-    r.running = false
+    err := r.wait()
     if err != nil {
+        if cause := r.watchdog.Err(); cause != nil {
+            r.exitCode = -1
+            return &Error{
+                script: r.script,
+                command: r.command,
+                exitCode: r.exitCode,
+                err: fmt.Errorf("[golang-exec/runner/ssh/Wait()] runner cancelled: %w\n", cause),
+            }
+        }
+
         var exitErr *ssh.ExitError
         if errors.As(err, &exitErr) {
             r.exitCode = exitErr.Waitmsg.ExitStatus()
+            err = errs.Wrap(errs.ErrExit, err)
         } else {
             r.exitCode = -1
+            if !errors.Is(err, errs.ErrBecome) {
+                err = errs.Wrap(errs.ErrSession, err)
+            }
         }
         return &Error{
             script: r.script,
             command: r.command,
             exitCode: r.exitCode,
-            err: fmt.Errorf("[golang-exec/runner/ssh/Wait()] runner failed: %#w\n", err),
+            err: fmt.Errorf("[golang-exec/runner/ssh/Wait()] runner failed: %w\n", err),
         }
     }
 
@@ -290,8 +478,8 @@ func (r *Runner) Close() error {
         _ = r.session.Close()
     }
 
-    if r.client != nil {
-        r.client.Close()
+    if r.release != nil {
+        r.release()
     }
 
     return nil
@@ -301,4 +489,213 @@ func (r *Runner) ExitCode() int {
     return r.exitCode
 }
 
+func (r *Runner) Signal() string {
+    return r.signal
+}
+
+func (r *Runner) Command() string {
+    return r.command
+}
+
+//------------------------------------------------------------------------------
+
+func (r *Runner) start(ctx context.Context) error {
+    if ctx.Err() != nil {
+        return ctx.Err()
+    }
+
+    stdin, err := r.prepareStdin()
+    if err != nil {
+        return err
+    }
+    r.session.Stdin = stdin
+
+    if r.become != nil {
+        r.command, err = r.become.Command(r.command)
+        if err != nil {
+            return err
+        }
+
+        // detect when the password or the user is rejected, also when the caller doesn't capture stderr
+        // a terminal merges stderr into stdout
+        if !r.stderrPipe {
+            if r.session.Stderr == nil {
+                r.session.Stderr = ioutil.Discard
+            }
+            r.session.Stderr = r.detector.Writer(r.session.Stderr)
+        }
+        if r.pty && !r.stdoutPipe {
+            if r.session.Stdout == nil {
+                r.session.Stdout = ioutil.Discard
+            }
+            r.session.Stdout = r.detector.Writer(r.session.Stdout)
+        }
+    }
+
+    if r.pty {
+        r.session.Stdin, err = r.requestPty(stdin)
+        if err != nil {
+            return err
+        }
+    }
+
+    if r.watchdog.IdleTimeout > 0 {
+        // register output from the script, also when the caller doesn't capture it
+        if !r.stdoutPipe {
+            if r.session.Stdout == nil {
+                r.session.Stdout = ioutil.Discard
+            }
+            r.session.Stdout = r.watchdog.Writer(r.session.Stdout)
+        }
+        if !r.stderrPipe {
+            if r.session.Stderr == nil {
+                r.session.Stderr = ioutil.Discard
+            }
+            r.session.Stderr = r.watchdog.Writer(r.session.Stderr)
+        }
+    }
+
+    err = r.session.Start(r.command)
+    if err != nil {
+        return err
+    }
+    r.running = true
+
+    // signal and close the session when 'ctx' is done, or when the script times out
+    r.watchdog.Start(ctx, func() {
+        _ = r.session.Signal(ssh.SIGTERM)
+        _ = r.session.Close()
+    })
+
+    return nil
+}
+
+func (r *Runner) wait() error {
+    err := r.session.Wait()
+    r.watchdog.Stop()
+    r.running = false
+
+    var exitErr *ssh.ExitError
+    if errors.As(err, &exitErr) {
+        r.signal = exitErr.Waitmsg.Signal()
+    }
+
+    if err != nil && r.become != nil && r.detector.Failed() {
+        return r.become.Err()
+    }
+
+    return err
+}
+
+func (r *Runner) prepareStdin() (io.Reader, error) {
+    // sets the environment of the session, and prepends code to change the working directory to the script
+    // when using become, the password is sent on the first line
+    env := append(append([]string{}, r.env...), r.extraEnv...)
+    stdin := r.stdin
+
+    if r.cleanEnv || r.become != nil {
+        switch r.script.Shell {
+        case "cmd", "powershell", "pwsh":
+            if r.become != nil {
+                return nil, fmt.Errorf("become is not supported for shell %q", r.script.Shell)
+            }
+            return nil, fmt.Errorf("a clean environment is not supported for shell %q", r.script.Shell)
+        }
+
+        // "env -i" also clears the variables set on the session, sudo and su reset them
+        prologue, err := r.script.EnvPrologue(env)
+        if err != nil {
+            return nil, err
+        }
+        stdin = io.MultiReader(strings.NewReader(prologue), stdin)
+    } else if len(env) > 0 {
+        var err error
+        stdin, err = setenv(r.session, r.script, env, stdin)
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    if r.dir != "" {
+        prologue, err := r.script.DirPrologue(r.dir)
+        if err != nil {
+            return nil, err
+        }
+        stdin = io.MultiReader(strings.NewReader(prologue), stdin)
+    }
+
+    if r.become != nil {
+        stdin = r.become.Stdin(stdin)
+    }
+
+    return stdin, nil
+}
+
+func (r *Runner) requestPty(stdin io.Reader) (io.Reader, error) {
+    // requests a pseudo-terminal for the session, in raw mode so the script isn't echoed or interpreted by the terminal
+    // "head" reads the script from the terminal and sends it to the shell using a pipe, so the shell still gets end-of-file after the script
+    switch r.script.Shell {
+    case "cmd", "powershell", "pwsh":
+        return nil, fmt.Errorf("a pseudo-terminal is not supported for shell %q", r.script.Shell)
+    }
+
+    code, err := ioutil.ReadAll(stdin)
+    if err != nil {
+        return nil, err
+    }
+
+    term, columns, rows := r.term, r.columns, r.rows
+    if term == "" {
+        term = "xterm"
+    }
+    if columns <= 0 {
+        columns = 80
+    }
+    if rows <= 0 {
+        rows = 24
+    }
+
+    modes := ssh.TerminalModes{
+        ssh.ECHO:   0,
+        ssh.ICANON: 0,
+        ssh.ISIG:   0,
+        ssh.IEXTEN: 0,
+        ssh.ICRNL:  0,
+        ssh.INLCR:  0,
+        ssh.IGNCR:  0,
+        ssh.IXON:   0,
+        ssh.IXOFF:  0,
+    }
+    err = r.session.RequestPty(term, rows, columns, modes)
+    if err != nil {
+        return nil, err
+    }
+
+    r.command = fmt.Sprintf("head -c %d | %s", len(code), r.command)
+    return bytes.NewReader(code), nil
+}
+
+func setenv(session *ssh.Session, s *script.Script, env []string, stdin io.Reader) (io.Reader, error) {
+    // sets the environment of the session
+    // servers only accept the variables listed in "AcceptEnv" of their sshd_config,
+    // when a variable is rejected, code that sets the environment is prepended to the script instead
+    for _, entry := range env {
+        i := strings.Index(entry, "=")
+        if i <= 0 {
+            return nil, fmt.Errorf("invalid environment variable %q, must be \"NAME=value\"", entry)
+        }
+
+        err := session.Setenv(entry[:i], entry[i+1:])
+        if err != nil {
+            prologue, err := s.EnvPrologue(env)
+            if err != nil {
+                return nil, err
+            }
+            return io.MultiReader(strings.NewReader(prologue), stdin), nil
+        }
+    }
+
+    return stdin, nil
+}
+
 //------------------------------------------------------------------------------
@@ -0,0 +1,125 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package ssh
+
+import (
+    "errors"
+    "reflect"
+    "testing"
+
+    "github.com/stefaanc/golang-exec/runner/internal/decode"
+    "github.com/stefaanc/golang-exec/runner/internal/errs"
+)
+
+//------------------------------------------------------------------------------
+
+func TestToConnectionJumpHostsStruct(t *testing.T) {
+    type myConnection struct {
+        Type      string
+        Host      string
+        Port      uint16
+        User      string
+        Password  string
+        Insecure  bool
+        JumpHosts []*Connection
+    }
+
+    c, err := toConnection(myConnection{
+        Type: "ssh",
+        Host: "target",
+        Port: 22,
+        User: "me",
+        JumpHosts: []*Connection{
+            { Host: "bastion1", Port: 2222, User: "jump1", Password: "secret1" },
+            { Host: "bastion2", Port: 22, User: "jump2", Insecure: true },
+        },
+    })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    want := []Connection{
+        { Host: "bastion1", Port: 2222, User: "jump1", Password: "secret1" },
+        { Host: "bastion2", Port: 22, User: "jump2", Insecure: true },
+    }
+    if !reflect.DeepEqual(c.JumpHosts, want) {
+        t.Errorf("jump hosts = %+v, want %+v", c.JumpHosts, want)
+    }
+}
+
+func TestToConnectionJumpHostsMap(t *testing.T) {
+    c, err := toConnection(map[string]string{
+        "Type": "ssh",
+        "Host": "target",
+        "JumpHosts": "jump1@bastion1:2222, bastion2",
+        "JumpHosts[1].User": "jump2",
+        "JumpHosts[1].Port": "22",
+        "JumpHosts[1].Insecure": "true",
+        "JumpHosts[0].Password": "secret1",
+        "JumpHosts[0].Host": "bastion1.example.com",
+    })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    want := []Connection{
+        { Host: "bastion1.example.com", Port: 2222, User: "jump1", Password: "secret1" },
+        { Host: "bastion2", Port: 22, User: "jump2", Insecure: true },
+    }
+    if !reflect.DeepEqual(c.JumpHosts, want) {
+        t.Errorf("jump hosts = %+v, want %+v", c.JumpHosts, want)
+    }
+}
+
+func TestToConnectionInvalid(t *testing.T) {
+    tests := []struct {
+        name       string
+        connection interface{}
+    }{
+        { "port", map[string]string{ "Type": "ssh", "Host": "target", "Port": "twentytwo" } },
+        { "port overflow", map[string]interface{}{ "Type": "ssh", "Host": "target", "Port": 65536 } },
+        { "insecure", map[string]string{ "Type": "ssh", "Host": "target", "Insecure": "maybe" } },
+        { "jump host port", map[string]string{ "Type": "ssh", "Host": "target", "JumpHosts": "bastion:ssh" } },
+        { "not a connection", "ssh://target" },
+        { "nil", nil },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            _, err := toConnection(tt.connection)
+            if !errors.Is(err, errs.ErrConnection) {
+                t.Errorf("error = %v, want ErrConnection", err)
+            }
+        })
+    }
+}
+
+func TestConnectionDefaults(t *testing.T) {
+    c, err := toConnection(map[string]string{
+        "Type": "ssh",
+        "Host": "target",
+        "JumpHosts": "bastion",
+    })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    err = decode.Validate(c)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if c.Port != 22 || c.JumpHosts[0].Port != 22 {
+        t.Errorf("ports = %d, %d, want 22, 22", c.Port, c.JumpHosts[0].Port)
+    }
+
+    err = decode.Validate(&Connection{ Type: "ssh", Port: 22 })
+    if !errors.Is(err, errs.ErrConnection) {
+        t.Errorf("error = %v, want ErrConnection for missing 'Host'", err)
+    }
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,659 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+
+//go:build !windows
+// +build !windows
+
+package sshtest
+
+import (
+    "bytes"
+    "crypto/ed25519"
+    "crypto/rand"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "os"
+    "os/exec"
+    "strconv"
+    "sync"
+    "syscall"
+
+    "github.com/creack/pty"
+    "golang.org/x/crypto/ssh"
+)
+
+//------------------------------------------------------------------------------
+
+// an in-process ssh server for tests, executing "exec" requests with the local shell, on a pseudo-terminal after a "pty-req" request
+// similar to net/http/httptest, use NewServer(), or NewUnstartedServer() to configure the server before calling Start()
+// the configuration must not be changed after calling Start()
+type Server struct {
+    Host string   // set by Start()
+    Port uint16   // set by Start()
+
+    HostKey ssh.Signer   // generated by Start() when nil
+
+    Passwords      map[string]string            // user to password, for password and keyboard-interactive authentication
+    AuthorizedKeys map[string][]ssh.PublicKey   // user to public keys, for publickey authentication
+    UserCAKeys     []ssh.PublicKey              // certificate authorities for user certificates, for any user in the certificate's principals
+    NoClientAuth   bool                         // accept clients without authentication
+
+    Shell     string   // shell that executes the commands, as in "<shell> -c <command>", default "sh"
+    Env       []string // environment of the commands, in addition to the environment of the test process and the "env" requests
+    RejectEnv bool     // reject "env" requests, like a server without "AcceptEnv"
+
+    MaxSessions int   // maximum number of open sessions per connection, like "MaxSessions" of sshd, 0 when unlimited
+
+    listener net.Listener
+    wg       sync.WaitGroup
+
+    mu          sync.Mutex
+    conns       map[net.Conn]bool
+    connections int
+    commands    []string
+}
+
+// a command received in an "exec" request, with the environment from the "env" requests and the terminal from the "pty-req" request
+type session struct {
+    env     []string
+    pty     *ptyRequest
+    cmd     *exec.Cmd
+    started bool
+    exited  bool
+
+    ptmx   *os.File        // master side of the pseudo-terminal
+    output chan struct{}   // closed when the output from the pseudo-terminal is copied to the channel
+}
+
+// payloads of the ssh requests and channels, RFC 4254
+type envRequest struct {
+    Name  string
+    Value string
+}
+
+type ptyRequest struct {
+    Term    string
+    Columns uint32
+    Rows    uint32
+    Width   uint32
+    Height  uint32
+    Modes   string
+}
+
+type execRequest struct {
+    Command string
+}
+
+type signalRequest struct {
+    Signal string
+}
+
+type exitStatus struct {
+    Status uint32
+}
+
+type exitSignal struct {
+    Signal     string
+    CoreDumped bool
+    Error      string
+    Lang       string
+}
+
+type directTCPIP struct {
+    Host       string
+    Port       uint32
+    OriginHost string
+    OriginPort uint32
+}
+
+var signals = map[string]syscall.Signal{
+    "ABRT": syscall.SIGABRT,
+    "ALRM": syscall.SIGALRM,
+    "FPE":  syscall.SIGFPE,
+    "HUP":  syscall.SIGHUP,
+    "ILL":  syscall.SIGILL,
+    "INT":  syscall.SIGINT,
+    "KILL": syscall.SIGKILL,
+    "PIPE": syscall.SIGPIPE,
+    "QUIT": syscall.SIGQUIT,
+    "SEGV": syscall.SIGSEGV,
+    "TERM": syscall.SIGTERM,
+    "USR1": syscall.SIGUSR1,
+    "USR2": syscall.SIGUSR2,
+}
+
+// terminal modes that are applied using "stty", RFC 4254 section 8
+var terminalModes = map[byte]string{
+    34: "igncr",
+    35: "inlcr",
+    36: "icrnl",
+    38: "ixon",
+    40: "ixoff",
+    50: "isig",
+    51: "icanon",
+    53: "echo",
+    59: "iexten",
+    70: "opost",
+    72: "onlcr",
+}
+
+//------------------------------------------------------------------------------
+
+func NewServer() *Server {
+    // starts a server that accepts any client, use NewUnstartedServer() to configure authentication
+    s := NewUnstartedServer()
+    s.NoClientAuth = true
+    s.Start()
+    return s
+}
+
+func NewUnstartedServer() *Server {
+    return &Server{
+        Passwords: make(map[string]string),
+        AuthorizedKeys: make(map[string][]ssh.PublicKey),
+    }
+}
+
+func (s *Server) Start() {
+    // starts listening on a random port of the loopback interface, panics when failing
+    if s.listener != nil {
+        panic("[golang-exec/runner/ssh/sshtest/Start()] server already started")
+    }
+
+    if s.HostKey == nil {
+        s.HostKey = NewSigner()
+    }
+
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        panic(fmt.Sprintf("[golang-exec/runner/ssh/sshtest/Start()] cannot listen: %v", err))
+    }
+    s.listener = listener
+    s.conns = make(map[net.Conn]bool)
+
+    addr := listener.Addr().(*net.TCPAddr)
+    s.Host = addr.IP.String()
+    s.Port = uint16(addr.Port)
+
+    config := s.serverConfig()
+    s.wg.Add(1)
+    go func() {
+        defer s.wg.Done()
+        for {
+            conn, err := listener.Accept()
+            if err != nil {
+                return
+            }
+
+            s.mu.Lock()
+            s.conns[conn] = true
+            s.connections++
+            s.mu.Unlock()
+
+            s.wg.Add(1)
+            go func() {
+                defer s.wg.Done()
+                s.serveConn(conn, config)
+
+                s.mu.Lock()
+                delete(s.conns, conn)
+                s.mu.Unlock()
+            }()
+        }
+    }()
+}
+
+func (s *Server) Close() {
+    // stops the server, closing all connections, and waits for running commands to be terminated
+    if s.listener == nil {
+        return
+    }
+    _ = s.listener.Close()
+
+    s.mu.Lock()
+    for conn := range s.conns {
+        _ = conn.Close()
+    }
+    s.mu.Unlock()
+
+    s.wg.Wait()
+}
+
+func (s *Server) CloseConnections() {
+    // closes the client connections, but keeps listening for new connections, to test reconnecting
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for conn := range s.conns {
+        _ = conn.Close()
+    }
+}
+
+func (s *Server) Addr() string {
+    return net.JoinHostPort(s.Host, strconv.Itoa(int(s.Port)))
+}
+
+func (s *Server) HostKeyFingerprint() string {
+    // returns the SHA256 fingerprint of the host key, as used for 'HostKeyFingerprint' in an ssh connection
+    return ssh.FingerprintSHA256(s.HostKey.PublicKey())
+}
+
+func (s *Server) Connections() int {
+    // returns the number of accepted tcp connections, to test reuse of ssh clients
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    return s.connections
+}
+
+func (s *Server) Commands() []string {
+    // returns the commands received in "exec" requests, in the order they were received
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    commands := make([]string, len(s.commands))
+    copy(commands, s.commands)
+    return commands
+}
+
+//------------------------------------------------------------------------------
+
+func NewSigner() ssh.Signer {
+    // returns a new ed25519 key, to use as a host key or as a client key, panics when failing
+    _, key, err := ed25519.GenerateKey(rand.Reader)
+    if err != nil {
+        panic(fmt.Sprintf("[golang-exec/runner/ssh/sshtest/NewSigner()] cannot generate key: %v", err))
+    }
+
+    signer, err := ssh.NewSignerFromKey(key)
+    if err != nil {
+        panic(fmt.Sprintf("[golang-exec/runner/ssh/sshtest/NewSigner()] cannot create signer: %v", err))
+    }
+
+    return signer
+}
+
+//------------------------------------------------------------------------------
+
+func (s *Server) serverConfig() *ssh.ServerConfig {
+    config := &ssh.ServerConfig{
+        NoClientAuth: s.NoClientAuth,
+    }
+    config.AddHostKey(s.HostKey)
+
+    if len(s.Passwords) > 0 {
+        config.PasswordCallback = func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+            if want, ok := s.Passwords[conn.User()]; ok && want == string(password) {
+                return nil, nil
+            }
+            return nil, fmt.Errorf("invalid password for user %q", conn.User())
+        }
+
+        config.KeyboardInteractiveCallback = func(conn ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+            answers, err := challenge(conn.User(), "", []string{ "Password: " }, []bool{ false })
+            if err != nil {
+                return nil, err
+            }
+            if want, ok := s.Passwords[conn.User()]; ok && len(answers) == 1 && want == answers[0] {
+                return nil, nil
+            }
+            return nil, fmt.Errorf("invalid password for user %q", conn.User())
+        }
+    }
+
+    if len(s.AuthorizedKeys) > 0 || len(s.UserCAKeys) > 0 {
+        checker := &ssh.CertChecker{
+            IsUserAuthority: func(key ssh.PublicKey) bool {
+                for _, ca := range s.UserCAKeys {
+                    if bytes.Equal(ca.Marshal(), key.Marshal()) {
+                        return true
+                    }
+                }
+                return false
+            },
+            UserKeyFallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+                for _, authorized := range s.AuthorizedKeys[conn.User()] {
+                    if bytes.Equal(authorized.Marshal(), key.Marshal()) {
+                        return nil, nil
+                    }
+                }
+                return nil, fmt.Errorf("unknown public key for user %q", conn.User())
+            },
+        }
+        config.PublicKeyCallback = checker.Authenticate
+    }
+
+    return config
+}
+
+func (s *Server) serveConn(conn net.Conn, config *ssh.ServerConfig) {
+    defer conn.Close()
+
+    sshConn, channels, requests, err := ssh.NewServerConn(conn, config)
+    if err != nil {
+        return
+    }
+    defer sshConn.Close()
+    go ssh.DiscardRequests(requests)
+
+    var wg sync.WaitGroup
+    defer wg.Wait()
+
+    var mu sync.Mutex
+    sessions := 0
+    for newChannel := range channels {
+        switch newChannel.ChannelType() {
+        case "session":
+            mu.Lock()
+            full := s.MaxSessions > 0 && sessions >= s.MaxSessions
+            if !full {
+                sessions++
+            }
+            mu.Unlock()
+            if full {
+                _ = newChannel.Reject(ssh.ResourceShortage, "too many sessions")
+                continue
+            }
+
+            channel, requests, err := newChannel.Accept()
+            if err != nil {
+                mu.Lock()
+                sessions--
+                mu.Unlock()
+                continue
+            }
+            wg.Add(1)
+            go func() {
+                defer wg.Done()
+                s.serveSession(channel, requests)
+
+                mu.Lock()
+                sessions--
+                mu.Unlock()
+            }()
+        case "direct-tcpip":
+            // used by clients tunnelling through this server as a jump host
+            var payload directTCPIP
+            err := ssh.Unmarshal(newChannel.ExtraData(), &payload)
+            if err != nil {
+                _ = newChannel.Reject(ssh.ConnectionFailed, "invalid payload")
+                continue
+            }
+
+            target, err := net.Dial("tcp", net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port))))
+            if err != nil {
+                _ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+                continue
+            }
+
+            channel, requests, err := newChannel.Accept()
+            if err != nil {
+                _ = target.Close()
+                continue
+            }
+            go ssh.DiscardRequests(requests)
+
+            wg.Add(1)
+            go func() {
+                defer wg.Done()
+                go func() {
+                    _, _ = io.Copy(target, channel)
+                    _ = target.Close()
+                }()
+                _, _ = io.Copy(channel, target)
+                _ = channel.Close()
+            }()
+        default:
+            _ = newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+        }
+    }
+}
+
+func (s *Server) serveSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+    defer channel.Close()
+
+    var mu sync.Mutex
+    sess := new(session)
+    done := make(chan struct{})
+    defer func() {
+        // terminate the command when the client closes the session before it completes
+        mu.Lock()
+        if sess.started && !sess.exited {
+            _ = syscall.Kill(-sess.cmd.Process.Pid, syscall.SIGKILL)
+        }
+        mu.Unlock()
+    }()
+
+    for {
+        var req *ssh.Request
+        select {
+        case req = <-requests:
+        case <-done:
+            return
+        }
+        if req == nil {
+            return
+        }
+
+        switch req.Type {
+        case "env":
+            var payload envRequest
+            if s.RejectEnv || ssh.Unmarshal(req.Payload, &payload) != nil {
+                _ = req.Reply(false, nil)
+                continue
+            }
+            mu.Lock()
+            sess.env = append(sess.env, payload.Name + "=" + payload.Value)
+            mu.Unlock()
+            _ = req.Reply(true, nil)
+        case "pty-req":
+            payload := new(ptyRequest)
+            mu.Lock()
+            started := sess.started
+            mu.Unlock()
+            if started || ssh.Unmarshal(req.Payload, payload) != nil {
+                _ = req.Reply(false, nil)
+                continue
+            }
+            mu.Lock()
+            sess.pty = payload
+            mu.Unlock()
+            _ = req.Reply(true, nil)
+        case "exec":
+            var payload execRequest
+            mu.Lock()
+            started := sess.started
+            mu.Unlock()
+            if started || ssh.Unmarshal(req.Payload, &payload) != nil {
+                _ = req.Reply(false, nil)
+                continue
+            }
+
+            s.mu.Lock()
+            s.commands = append(s.commands, payload.Command)
+            s.mu.Unlock()
+
+            err := s.start(sess, &mu, channel, payload.Command)
+            if err != nil {
+                _ = req.Reply(false, nil)
+                continue
+            }
+            _ = req.Reply(true, nil)
+
+            go func() {
+                s.wait(sess, &mu, channel)
+                close(done)
+            }()
+        case "signal":
+            var payload signalRequest
+            if ssh.Unmarshal(req.Payload, &payload) != nil {
+                continue
+            }
+            mu.Lock()
+            if sig, ok := signals[payload.Signal]; ok && sess.started && !sess.exited {
+                _ = syscall.Kill(-sess.cmd.Process.Pid, sig)
+            }
+            mu.Unlock()
+        default:
+            if req.WantReply {
+                _ = req.Reply(false, nil)
+            }
+        }
+    }
+}
+
+func (s *Server) start(sess *session, mu *sync.Mutex, channel ssh.Channel, command string) error {
+    shell := s.Shell
+    if shell == "" {
+        shell = "sh"
+    }
+
+    cmd := exec.Command(shell, "-c", command)
+    cmd.SysProcAttr = &syscall.SysProcAttr{ Setpgid: true }
+    cmd.Env = append(append(os.Environ(), s.Env...), sess.env...)
+    cmd.Stdout = channel
+    cmd.Stderr = channel.Stderr()
+
+    mu.Lock()
+    defer mu.Unlock()
+
+    if sess.pty != nil {
+        return s.startPty(sess, channel, cmd)
+    }
+
+    stdin, err := cmd.StdinPipe()
+    if err != nil {
+        return err
+    }
+
+    err = cmd.Start()
+    if err != nil {
+        return err
+    }
+    sess.cmd = cmd
+    sess.started = true
+
+    // not waited for by cmd.Wait(), the client may never close its stdin
+    go func() {
+        _, _ = io.Copy(stdin, channel)
+        _ = stdin.Close()
+    }()
+
+    return nil
+}
+
+func (s *Server) startPty(sess *session, channel ssh.Channel, cmd *exec.Cmd) error {
+    // starts the command on a pseudo-terminal, stdout and stderr are merged like with sshd
+    ptmx, tty, err := pty.Open()
+    if err != nil {
+        return err
+    }
+    defer tty.Close()   // the command has its own copy
+
+    err = pty.Setsize(ptmx, &pty.Winsize{ Cols: uint16(sess.pty.Columns), Rows: uint16(sess.pty.Rows) })
+    if err != nil {
+        _ = ptmx.Close()
+        return err
+    }
+
+    err = setModes(tty, sess.pty.Modes)
+    if err != nil {
+        _ = ptmx.Close()
+        return err
+    }
+
+    cmd.Env = append(cmd.Env, "TERM=" + sess.pty.Term)
+    cmd.Stdin = tty
+    cmd.Stdout = tty
+    cmd.Stderr = tty
+    cmd.SysProcAttr = &syscall.SysProcAttr{ Setsid: true, Setctty: true }
+
+    err = cmd.Start()
+    if err != nil {
+        _ = ptmx.Close()
+        return err
+    }
+    sess.cmd = cmd
+    sess.started = true
+    sess.ptmx = ptmx
+    sess.output = make(chan struct{})
+
+    go func() {
+        _, _ = io.Copy(ptmx, channel)
+    }()
+    go func() {
+        // reading fails when the command and its children closed the terminal
+        _, _ = io.Copy(channel, ptmx)
+        close(sess.output)
+    }()
+
+    return nil
+}
+
+func setModes(tty *os.File, modes string) error {
+    // applies the encoded terminal modes of a "pty-req" request, ignoring the modes that are not in 'terminalModes'
+    var args []string
+    b := []byte(modes)
+    for len(b) >= 5 && b[0] != 0 && b[0] < 160 {
+        value := uint32(b[1]) << 24 | uint32(b[2]) << 16 | uint32(b[3]) << 8 | uint32(b[4])
+        if name, ok := terminalModes[b[0]]; ok {
+            if value == 0 {
+                name = "-" + name
+            }
+            args = append(args, name)
+        }
+        b = b[5:]
+    }
+    if len(args) == 0 {
+        return nil
+    }
+
+    stty := exec.Command("stty", args...)
+    stty.Stdin = tty
+    output, err := stty.CombinedOutput()
+    if err != nil {
+        return fmt.Errorf("cannot set terminal modes: %v: %s", err, output)
+    }
+
+    return nil
+}
+
+func (s *Server) wait(sess *session, mu *sync.Mutex, channel ssh.Channel) {
+    err := sess.cmd.Wait()
+    if sess.output != nil {
+        <-sess.output
+        _ = sess.ptmx.Close()
+    }
+
+    mu.Lock()
+    sess.exited = true
+    mu.Unlock()
+
+    var exitErr *exec.ExitError
+    if err != nil && !errors.As(err, &exitErr) {
+        _, _ = channel.SendRequest("exit-status", false, ssh.Marshal(exitStatus{ Status: 255 }))
+        return
+    }
+
+    state := sess.cmd.ProcessState
+    if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+        name := strconv.Itoa(int(status.Signal()))
+        for n, sig := range signals {
+            if sig == status.Signal() {
+                name = n
+            }
+        }
+        _, _ = channel.SendRequest("exit-signal", false, ssh.Marshal(exitSignal{ Signal: name, CoreDumped: status.CoreDump() }))
+        return
+    }
+
+    _, _ = channel.SendRequest("exit-status", false, ssh.Marshal(exitStatus{ Status: uint32(state.ExitCode()) }))
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,184 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+
+//go:build !windows
+// +build !windows
+
+package sshtest
+
+import (
+    "crypto/rand"
+    "errors"
+    "strings"
+    "testing"
+    "time"
+
+    "golang.org/x/crypto/ssh"
+)
+
+//------------------------------------------------------------------------------
+
+func dialTestServer(t *testing.T, s *Server, user string, auth ...ssh.AuthMethod) *ssh.Client {
+    t.Helper()
+
+    client, err := ssh.Dial("tcp", s.Addr(), &ssh.ClientConfig{
+        User: user,
+        Auth: auth,
+        HostKeyCallback: ssh.FixedHostKey(s.HostKey.PublicKey()),
+    })
+    if err != nil {
+        t.Fatalf("cannot dial: %v", err)
+    }
+
+    return client
+}
+
+//------------------------------------------------------------------------------
+
+func TestServerExec(t *testing.T) {
+    s := NewServer()
+    defer s.Close()
+
+    client := dialTestServer(t, s, "me")
+    defer client.Close()
+
+    session, _ := client.NewSession()
+    defer session.Close()
+
+    session.Stdin = strings.NewReader("hello")
+    output, err := session.CombinedOutput("cat; exit 3")
+
+    var exitErr *ssh.ExitError
+    if !errors.As(err, &exitErr) || exitErr.ExitStatus() != 3 {
+        t.Errorf("error = %v, want exit status 3", err)
+    }
+    if string(output) != "hello" {
+        t.Errorf("output = %q, want %q", output, "hello")
+    }
+}
+
+func TestServerEnv(t *testing.T) {
+    for _, reject := range []bool{ false, true } {
+        s := NewUnstartedServer()
+        s.NoClientAuth = true
+        s.Env = []string{ "SERVER_VAR=server" }
+        s.RejectEnv = reject
+        s.Start()
+
+        client := dialTestServer(t, s, "me")
+        session, _ := client.NewSession()
+
+        err := session.Setenv("CLIENT_VAR", "client")
+        if (err != nil) != reject {
+            t.Errorf("reject = %t: setenv error = %v", reject, err)
+        }
+
+        output, _ := session.Output(`echo "$SERVER_VAR $CLIENT_VAR"`)
+        want := "server client"
+        if reject {
+            want = "server"
+        }
+        if got := strings.TrimSpace(string(output)); got != want {
+            t.Errorf("reject = %t: output = %q, want %q", reject, got, want)
+        }
+
+        session.Close()
+        client.Close()
+        s.Close()
+    }
+}
+
+func TestServerPty(t *testing.T) {
+    s := NewUnstartedServer()
+    s.NoClientAuth = true
+    s.Start()
+    defer s.Close()
+
+    client := dialTestServer(t, s, "me")
+    defer client.Close()
+
+    session, _ := client.NewSession()
+    defer session.Close()
+
+    err := session.RequestPty("vt100", 30, 100, ssh.TerminalModes{ ssh.ECHO: 0, ssh.ICANON: 0 })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    session.Stdin = strings.NewReader("hello")
+    output, err := session.Output(`echo "$TERM $(stty size)"; stty -a | grep -o -- "-echo " ; head -c 5; echo "stderr" >&2`)
+    if err != nil {
+        t.Errorf("unexpected error: %v", err)
+    }
+    if want := "vt100 30 100\r\n-echo \r\nhellostderr\r\n"; string(output) != want {
+        t.Errorf("output = %q, want %q", output, want)
+    }
+}
+
+func TestServerSignal(t *testing.T) {
+    s := NewServer()
+    defer s.Close()
+
+    client := dialTestServer(t, s, "me")
+    defer client.Close()
+
+    session, _ := client.NewSession()
+    defer session.Close()
+
+    err := session.Start("exec sleep 30")
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    time.Sleep(100 * time.Millisecond)
+    _ = session.Signal(ssh.SIGINT)
+
+    err = session.Wait()
+    var exitErr *ssh.ExitError
+    if !errors.As(err, &exitErr) || exitErr.Signal() != "INT" {
+        t.Errorf("error = %v, want exit signal INT", err)
+    }
+}
+
+func TestServerAuth(t *testing.T) {
+    key := NewSigner()
+    ca := NewSigner()
+
+    certKey := NewSigner()
+    cert := &ssh.Certificate{
+        Key: certKey.PublicKey(),
+        CertType: ssh.UserCert,
+        ValidPrincipals: []string{ "me" },
+        ValidBefore: ssh.CertTimeInfinity,
+    }
+    err := cert.SignCert(rand.Reader, ca)
+    if err != nil {
+        t.Fatalf("cannot sign certificate: %v", err)
+    }
+    certSigner, _ := ssh.NewCertSigner(cert, certKey)
+
+    s := NewUnstartedServer()
+    s.Passwords["me"] = "my-password"
+    s.AuthorizedKeys["me"] = []ssh.PublicKey{ key.PublicKey() }
+    s.UserCAKeys = []ssh.PublicKey{ ca.PublicKey() }
+    s.Start()
+    defer s.Close()
+
+    dialTestServer(t, s, "me", ssh.Password("my-password")).Close()
+    dialTestServer(t, s, "me", ssh.PublicKeys(key)).Close()
+    dialTestServer(t, s, "me", ssh.PublicKeys(certSigner)).Close()
+
+    _, err = ssh.Dial("tcp", s.Addr(), &ssh.ClientConfig{
+        User: "other",
+        Auth: []ssh.AuthMethod{ ssh.Password("my-password"), ssh.PublicKeys(key) },
+        HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+    })
+    if err == nil {
+        t.Error("expected an error for an unknown user")
+    }
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,229 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package script
+
+import (
+    "fmt"
+    "reflect"
+    "text/template"
+    "text/template/parse"
+)
+
+//------------------------------------------------------------------------------
+
+func WithArgumentType(arguments interface{}) Option {
+    // checks when parsing the script that every field in the script, like "{{.Path}}", exists in the type of 'arguments'
+    // and checks when rendering the script that the arguments have this type
+    // use a value or a nil pointer, for instance "WithArgumentType((*lsArguments)(nil))"
+    return func(s *Script) {
+        s.argumentType = indirectType(reflect.TypeOf(arguments))
+    }
+}
+
+//------------------------------------------------------------------------------
+
+type checker struct {
+    root    *template.Template
+    checked map[string]bool   // templates already checked for a type
+}
+
+func checkTemplate(t *template.Template, argumentType reflect.Type) error {
+    // checks the fields of the main template, and of the templates it includes
+    c := &checker{ root: t, checked: make(map[string]bool) }
+    return c.checkTemplate(t.Name(), argumentType)
+}
+
+func (c *checker) checkTemplate(name string, dot reflect.Type) error {
+    key := fmt.Sprintf("%s|%v", name, dot)
+    if c.checked[key] {
+        return nil
+    }
+    c.checked[key] = true
+
+    t := c.root.Lookup(name)
+    if t == nil || t.Tree == nil {
+        // rendering fails for undefined templates
+        return nil
+    }
+    return c.checkList(t.Tree, t.Tree.Root, dot, dot)
+}
+
+func (c *checker) checkList(tree *parse.Tree, list *parse.ListNode, dot reflect.Type, root reflect.Type) error {
+    if list == nil {
+        return nil
+    }
+
+    for _, node := range list.Nodes {
+        var err error
+        switch n := node.(type) {
+        case *parse.ActionNode:
+            _, err = c.checkPipe(tree, n.Pipe, dot, root)
+        case *parse.IfNode:
+            err = c.checkBranch(tree, &n.BranchNode, dot, root, false)
+        case *parse.RangeNode:
+            err = c.checkBranch(tree, &n.BranchNode, dot, root, true)
+        case *parse.WithNode:
+            err = c.checkBranch(tree, &n.BranchNode, dot, root, false)
+        case *parse.TemplateNode:
+            var pipeType reflect.Type
+            if n.Pipe != nil {
+                pipeType, err = c.checkPipe(tree, n.Pipe, dot, root)
+            }
+            if err == nil && pipeType != nil {
+                err = c.checkTemplate(n.Name, pipeType)
+            }
+        }
+        if err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+func (c *checker) checkBranch(tree *parse.Tree, n *parse.BranchNode, dot reflect.Type, root reflect.Type, isRange bool) error {
+    pipeType, err := c.checkPipe(tree, n.Pipe, dot, root)
+    if err != nil {
+        return err
+    }
+
+    inner := dot
+    switch {
+    case n.NodeType == parse.NodeWith:
+        inner = pipeType
+    case isRange:
+        inner = nil
+        if pipeType != nil {
+            switch pipeType.Kind() {
+            case reflect.Array, reflect.Slice, reflect.Map, reflect.Chan:
+                inner = indirectType(pipeType.Elem())
+            }
+        }
+    }
+
+    err = c.checkList(tree, n.List, inner, root)
+    if err != nil {
+        return err
+    }
+    return c.checkList(tree, n.ElseList, dot, root)
+}
+
+func (c *checker) checkPipe(tree *parse.Tree, pipe *parse.PipeNode, dot reflect.Type, root reflect.Type) (reflect.Type, error) {
+    // returns the type of the pipe, or nil when unknown
+    var pipeType reflect.Type
+    for _, cmd := range pipe.Cmds {
+        pipeType = nil
+        for _, arg := range cmd.Args {
+            argType, err := c.checkArg(tree, arg, dot, root)
+            if err != nil {
+                return nil, err
+            }
+            if len(cmd.Args) == 1 {
+                pipeType = argType
+            }
+        }
+    }
+    return pipeType, nil
+}
+
+func (c *checker) checkArg(tree *parse.Tree, arg parse.Node, dot reflect.Type, root reflect.Type) (reflect.Type, error) {
+    switch n := arg.(type) {
+    case *parse.DotNode:
+        return dot, nil
+    case *parse.FieldNode:
+        return c.checkFields(tree, n, n.Ident, dot)
+    case *parse.VariableNode:
+        // the type of variables is not tracked, except for "$"
+        if n.Ident[0] == "$" {
+            return c.checkFields(tree, n, n.Ident[1:], root)
+        }
+    case *parse.ChainNode:
+        if pipe, ok := n.Node.(*parse.PipeNode); ok {
+            nodeType, err := c.checkPipe(tree, pipe, dot, root)
+            if err != nil {
+                return nil, err
+            }
+            return c.checkFields(tree, n, n.Field, nodeType)
+        }
+    case *parse.PipeNode:
+        return c.checkPipe(tree, n, dot, root)
+    }
+
+    return nil, nil
+}
+
+func (c *checker) checkFields(tree *parse.Tree, node parse.Node, fields []string, t reflect.Type) (reflect.Type, error) {
+    for _, field := range fields {
+        if t == nil {
+            return nil, nil
+        }
+
+        next, ok := fieldType(t, field)
+        if !ok {
+            location, _ := tree.ErrorContext(node)
+            return nil, fmt.Errorf("template: %s: can't evaluate field %s in type %s", location, field, t)
+        }
+        t = next
+    }
+
+    return t, nil
+}
+
+//------------------------------------------------------------------------------
+
+func fieldType(t reflect.Type, name string) (reflect.Type, bool) {
+    // returns the type of a field or method like text/template evaluates it, nil when unknown
+    if method, ok := reflect.PtrTo(t).MethodByName(name); ok {
+        if method.Type.NumOut() == 0 {
+            return nil, false
+        }
+        return indirectType(method.Type.Out(0)), true
+    }
+
+    switch t.Kind() {
+    case reflect.Struct:
+        field, ok := t.FieldByName(name)
+        if !ok || field.PkgPath != "" {
+            return nil, false
+        }
+        return indirectType(field.Type), true
+    case reflect.Map:
+        if t.Key().Kind() != reflect.String {
+            return nil, false
+        }
+        return indirectType(t.Elem()), true
+    }
+
+    return nil, false
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+    // returns the type that pointers point to, nil for interfaces because their type is only known when rendering
+    for t != nil && t.Kind() == reflect.Ptr {
+        t = t.Elem()
+    }
+    if t != nil && t.Kind() == reflect.Interface {
+        return nil
+    }
+    return t
+}
+
+func checkArgumentType(arguments interface{}, argumentType reflect.Type) error {
+    // the arguments must have the type, or be a pointer to the type
+    t := reflect.TypeOf(arguments)
+    if t == argumentType || (t != nil && t.Kind() == reflect.Ptr && t.Elem() == argumentType) {
+        return nil
+    }
+
+    got := "nil"
+    if t != nil {
+        got = t.String()
+    }
+    return fmt.Errorf("arguments have type %s, want %s", got, argumentType)
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,111 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package script
+
+import (
+    "strings"
+    "testing"
+)
+
+//------------------------------------------------------------------------------
+
+type checkHost struct {
+    Name string
+    Port int
+}
+
+func (h checkHost) Address() string { return h.Name }
+
+type checkArguments struct {
+    Path    string
+    Host    *checkHost
+    Hosts   []checkHost
+    Labels  map[string]string
+    Extra   interface{}
+    private string
+}
+
+//------------------------------------------------------------------------------
+
+func TestWithArgumentType(t *testing.T) {
+    code := `
+        {{.Path}} {{.Host.Name}} {{.Host.Address}} {{.Labels.env}} {{.Extra.Anything}}
+        {{- range .Hosts}} {{.Name}}:{{.Port}} {{$.Path}}{{end}}
+        {{- range $i, $h := .Hosts}} {{.Name}} {{$h.Unknown}}{{end}}
+        {{- with .Host}} {{.Port}}{{else}} {{.Path}}{{end}}
+        {{- if .Path}} {{.Path | printf "%s"}}{{end}}
+        {{- template "host" .Host}}
+        {{- define "host"}} {{.Name}} {{$.Port}}{{end}}
+    `
+
+    for _, arguments := range []interface{}{ checkArguments{}, (*checkArguments)(nil), &checkArguments{} } {
+        s := New("test", "bash", code, WithArgumentType(arguments))
+        if s.Error != nil {
+            t.Errorf("%T: unexpected error: %v", arguments, s.Error)
+        }
+    }
+
+    s := New("test", "bash", code, WithArgumentType(checkArguments{}))
+    got := render(t, s, &checkArguments{ Path: "/tmp", Host: &checkHost{ Name: "web", Port: 22 }, Extra: map[string]int{} })
+    if !strings.Contains(got, "/tmp web web") {
+        t.Errorf("rendered = %q does not contain %q", got, "/tmp web web")
+    }
+}
+
+func TestWithArgumentTypeErrors(t *testing.T) {
+    tests := []struct {
+        code string
+        want string
+    }{
+        { `{{.Missing}}`,                                  `test:1:2: can't evaluate field Missing in type script.checkArguments` },
+        { `{{.private}}`,                                  `can't evaluate field private` },
+        { `{{.Host.Missing}}`,                             `can't evaluate field Missing in type script.checkHost` },
+        { `{{.Path.Length}}`,                              `can't evaluate field Length in type string` },
+        { "\n{{range .Hosts}}{{.Path}}{{end}}",            `test:2:18: can't evaluate field Path in type script.checkHost` },
+        { `{{with .Host}}{{.Path}}{{end}}`,                `can't evaluate field Path in type script.checkHost` },
+        { `{{if .Path}}{{else}}{{.Paths}}{{end}}`,         `can't evaluate field Paths` },
+        { `{{printf "%s" .Paths}}`,                        `can't evaluate field Paths` },
+        { `{{(.Host).Missing}}`,                           `can't evaluate field Missing` },
+        { `{{range .Hosts}}{{$.Hosts.Name}}{{end}}`,       `can't evaluate field Name in type []script.checkHost` },
+        { `{{template "host" .Host}}{{define "host"}}{{.Path}}{{end}}`, `test:1:44: can't evaluate field Path in type script.checkHost` },
+    }
+
+    for _, test := range tests {
+        s := New("test", "bash", test.code, WithArgumentType(checkArguments{}))
+        if s.Error == nil || !strings.Contains(s.Error.Error(), test.want) {
+            t.Errorf("%s: error %v does not contain %q", test.code, s.Error, test.want)
+        }
+    }
+}
+
+func TestWithArgumentTypeRender(t *testing.T) {
+    s := New("test", "bash", `{{.Path}}`, WithArgumentType(checkArguments{}))
+
+    for _, arguments := range []interface{}{ nil, map[string]string{ "Path": "/tmp" }, checkHost{} } {
+        _, err := s.NewReader(arguments)
+        if err == nil || !strings.Contains(err.Error(), "want script.checkArguments") {
+            t.Errorf("%T: error %v is not an argument type error", arguments, err)
+        }
+    }
+}
+
+func TestWithMissingKeyError(t *testing.T) {
+    code := `{{.Path}}{{template "partial" .}}{{define "partial"}}{{.Other}}{{end}}`
+
+    got := render(t, New("test", "bash", code), map[string]string{ "Path": "/tmp" })
+    if got != "/tmp<no value>" {
+        t.Errorf("rendered = %q, want %q", got, "/tmp<no value>")
+    }
+
+    s := New("test", "bash", code, WithMissingKeyError())
+    _, err := s.NewReader(map[string]string{ "Path": "/tmp" })
+    if err == nil || !strings.Contains(err.Error(), `map has no entry for key "Other"`) {
+        t.Errorf("error %v is not a missing key error", err)
+    }
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,273 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package script
+
+import (
+    "encoding"
+    "encoding/json"
+    "fmt"
+    "reflect"
+    "sort"
+    "strings"
+    "unicode"
+)
+
+//------------------------------------------------------------------------------
+
+// prefix of the environment variables for the arguments, "Path" is exported as "ARG_PATH"
+const EnvPrefix = "ARG_"
+
+//------------------------------------------------------------------------------
+
+func WithEnvArguments() Option {
+    // exports the fields of the arguments as environment variables of the script, "Path" as "ARG_PATH"
+    // use "$ARG_PATH", "$env:ARG_PATH" or "%ARG_PATH%" in the script instead of "{{.Path}}" for untrusted values
+    return func(s *Script) {
+        s.envArguments = true
+    }
+}
+
+//------------------------------------------------------------------------------
+
+func (s *Script) Environment(arguments interface{}) ([]string, error) {
+    // returns the environment variables for the arguments as "NAME=value", sorted by name
+    // returns nil when the script doesn't use WithEnvArguments()
+    if !s.envArguments {
+        return nil, nil
+    }
+
+    arguments, err := s.checkArguments(arguments)
+    if err != nil {
+        return nil, fmt.Errorf("[golang-exec/script/Environment()] invalid arguments: %w\n", err)
+    }
+
+    values := make(map[string]string)
+    fields := make(map[string]string)   // the field of every name, to report fields that map to the same name
+    err = visitArguments(reflect.ValueOf(arguments), func(field string, value reflect.Value) error {
+        name := EnvPrefix + envName(field)
+        if other, ok := fields[name]; ok {
+            return fmt.Errorf("arguments %q and %q are both exported as %s", other, field, name)
+        }
+        fields[name] = field
+
+        s, err := envValue(value)
+        if err != nil {
+            return fmt.Errorf("cannot export argument %q: %w", field, err)
+        }
+        values[name] = s
+        return nil
+    })
+    if err != nil {
+        return nil, fmt.Errorf("[golang-exec/script/Environment()] invalid arguments: %w\n", err)
+    }
+
+    env := make([]string, 0, len(values))
+    for name, value := range values {
+        env = append(env, name + "=" + value)
+    }
+    sort.Strings(env)
+
+    return env, nil
+}
+
+func (s *Script) EnvPrologue(env []string) (string, error) {
+    // returns code that sets the environment variables in the script's shell, to prepend to the rendered script
+    // used when the environment of the shell cannot be set, for instance by an ssh server that doesn't accept "env" requests
+    var prologue strings.Builder
+    for _, entry := range env {
+        i := strings.Index(entry, "=")
+        if i <= 0 {
+            return "", fmt.Errorf("[golang-exec/script/EnvPrologue()] invalid environment variable %q, must be \"NAME=value\"\n", entry)
+        }
+        name, value := entry[:i], entry[i+1:]
+        if !isEnvName(name) {
+            return "", fmt.Errorf("[golang-exec/script/EnvPrologue()] invalid environment variable name %q, must match [A-Za-z_][A-Za-z0-9_]*\n", name)
+        }
+
+        switch s.Shell {
+        case "powershell", "pwsh":
+            single, _ := escapePowerShellSingle(value)
+            fmt.Fprintf(&prologue, "$env:%s = '%s'\n", name, single)
+        case "cmd":
+            if strings.ContainsAny(value, "\r\n") {
+                return "", fmt.Errorf("[golang-exec/script/EnvPrologue()] cannot set %s for cmd, the value contains a newline\n", name)
+            }
+            // "!" cannot be escaped reliably, it depends on delayed expansion being enabled or not
+            if strings.Contains(value, "!") {
+                return "", fmt.Errorf("[golang-exec/script/EnvPrologue()] cannot set %s for cmd, the value contains a '!'\n", name)
+            }
+            // the value is not quoted, so a '"' in the value cannot end the quotes and all special characters are escaped
+            escaped, _ := escapeCmd(value)
+            fmt.Fprintf(&prologue, "set %s=%s\n", name, escaped)
+        default:
+            single, _ := escapeShSingle(value)
+            fmt.Fprintf(&prologue, "export %s='%s'\n", name, single)
+        }
+    }
+
+    return prologue.String(), nil
+}
+
+func (s *Script) DirPrologue(dir string) (string, error) {
+    // returns code that changes the working directory in the script's shell, and fails the script when it cannot
+    if strings.ContainsAny(dir, "\r\n") {
+        return "", fmt.Errorf("[golang-exec/script/DirPrologue()] invalid directory %q, contains a newline\n", dir)
+    }
+
+    switch s.Shell {
+    case "powershell", "pwsh":
+        single, _ := escapePowerShellSingle(dir)
+        return fmt.Sprintf("Set-Location -LiteralPath '%s' -ErrorAction Stop\n", single), nil
+    case "cmd":
+        double, _ := escapeCmdDouble(dir)
+        return fmt.Sprintf("cd /D \"%s\" || exit /B 1\n", double), nil
+    default:
+        single, _ := escapeShSingle(dir)
+        return fmt.Sprintf("cd '%s' || exit 1\n", single), nil
+    }
+}
+
+//------------------------------------------------------------------------------
+
+func visitArguments(v reflect.Value, visit func(string, reflect.Value) error) error {
+    // visits the exported fields of a struct, including the fields of embedded structs, or the entries of a map with string keys
+    for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+        if v.IsNil() {
+            return nil
+        }
+        v = v.Elem()
+    }
+
+    switch {
+    case !v.IsValid():
+        return nil
+    case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+        keys := v.MapKeys()
+        sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+        for _, key := range keys {
+            err := visit(key.String(), v.MapIndex(key))
+            if err != nil {
+                return err
+            }
+        }
+        return nil
+    case v.Kind() == reflect.Struct:
+        return visitFields(v, make(map[string]bool), visit)
+    }
+
+    return fmt.Errorf("arguments must be a struct or a map with string keys, not %s", v.Type())
+}
+
+func visitFields(v reflect.Value, visited map[string]bool, visit func(string, reflect.Value) error) error {
+    // fields of embedded structs are visited after the other fields, so they are shadowed like in templates
+    var embedded []reflect.Value
+    for i := 0; i < v.NumField(); i++ {
+        field := v.Type().Field(i)
+        if field.Anonymous && indirectValue(v.Field(i)).Kind() == reflect.Struct {
+            embedded = append(embedded, indirectValue(v.Field(i)))
+            continue
+        }
+        if field.PkgPath != "" || visited[field.Name] {
+            continue
+        }
+        visited[field.Name] = true
+
+        err := visit(field.Name, v.Field(i))
+        if err != nil {
+            return err
+        }
+    }
+
+    for _, e := range embedded {
+        err := visitFields(e, visited, visit)
+        if err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+func indirectValue(v reflect.Value) reflect.Value {
+    for (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && !v.IsNil() {
+        v = v.Elem()
+    }
+    return v
+}
+
+func isEnvName(name string) bool {
+    // [A-Za-z_][A-Za-z0-9_]*
+    for i, r := range name {
+        if !(r == '_' || (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') || (i > 0 && r >= '0' && r <= '9')) {
+            return false
+        }
+    }
+    return name != ""
+}
+
+func envName(field string) string {
+    // "Path" -> "PATH", "FilePath" -> "FILE_PATH", "URLPath" -> "URL_PATH", "file-path" -> "FILE_PATH"
+    runes := []rune(field)
+    var name strings.Builder
+    for i, r := range runes {
+        if !(r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r))) {
+            name.WriteRune('_')
+            continue
+        }
+        if i > 0 && unicode.IsUpper(r) {
+            previous := runes[i-1]
+            nextLower := i + 1 < len(runes) && unicode.IsLower(runes[i+1])
+            if unicode.IsLower(previous) || unicode.IsDigit(previous) || (unicode.IsUpper(previous) && nextLower) {
+                name.WriteRune('_')
+            }
+        }
+        name.WriteRune(unicode.ToUpper(r))
+    }
+
+    return name.String()
+}
+
+func envValue(v reflect.Value) (string, error) {
+    // strings, numbers and booleans are exported as printed by text/template, other values as JSON
+    v = indirectValue(v)
+    if !v.IsValid() || ((v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil()) {
+        return "", nil
+    }
+
+    var s string
+    switch value := v.Interface().(type) {
+    case fmt.Stringer:
+        s = value.String()
+    case encoding.TextMarshaler:
+        b, err := value.MarshalText()
+        if err != nil {
+            return "", err
+        }
+        s = string(b)
+    default:
+        switch v.Kind() {
+        case reflect.String, reflect.Bool,
+             reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+             reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+             reflect.Float32, reflect.Float64:
+            s = fmt.Sprint(value)
+        default:
+            b, err := json.Marshal(value)
+            if err != nil {
+                return "", err
+            }
+            s = string(b)
+        }
+    }
+
+    if strings.ContainsRune(s, 0) {
+        return "", fmt.Errorf("environment variables cannot contain NUL characters")
+    }
+    return s, nil
+}
+
+//------------------------------------------------------------------------------
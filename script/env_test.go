@@ -0,0 +1,243 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package script
+
+import (
+    "os/exec"
+    "reflect"
+    "strings"
+    "testing"
+    "testing/fstest"
+    "time"
+)
+
+//------------------------------------------------------------------------------
+
+type envBase struct {
+    Path string
+    Host string
+}
+
+type envArguments struct {
+    envBase
+    Path     string
+    FilePath string
+    URLPath  *string
+    Retries  int
+    Force    bool
+    Delay    time.Duration
+    Hosts    []string
+    Extra    interface{}
+    private  string
+}
+
+//------------------------------------------------------------------------------
+
+func TestEnvName(t *testing.T) {
+    tests := map[string]string{
+        "Path":      "PATH",
+        "FilePath":  "FILE_PATH",
+        "URLPath":   "URL_PATH",
+        "Port2":     "PORT2",
+        "V2Path":    "V2_PATH",
+        "file-path": "FILE_PATH",
+        "path":      "PATH",
+        "é":         "_",
+    }
+
+    for field, want := range tests {
+        if got := envName(field); got != want {
+            t.Errorf("envName(%q) = %q, want %q", field, got, want)
+        }
+    }
+}
+
+func TestEnvironment(t *testing.T) {
+    s := New("test", "bash", `echo "$ARG_PATH"`, WithEnvArguments())
+
+    url := "/api"
+    env, err := s.Environment(&envArguments{
+        envBase: envBase{ Path: "shadowed", Host: "web" },
+        Path: "/tmp/it's here",
+        FilePath: "a\nb",
+        URLPath: &url,
+        Retries: 3,
+        Delay: time.Minute,
+        Hosts: []string{ "a", "b" },
+    })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    want := []string{
+        "ARG_DELAY=1m0s",
+        "ARG_EXTRA=",
+        "ARG_FILE_PATH=a\nb",
+        "ARG_FORCE=false",
+        "ARG_HOST=web",
+        `ARG_HOSTS=["a","b"]`,
+        "ARG_PATH=/tmp/it's here",
+        "ARG_RETRIES=3",
+        "ARG_URL_PATH=/api",
+    }
+    if !reflect.DeepEqual(env, want) {
+        t.Errorf("env = %q, want %q", env, want)
+    }
+
+    env, err = s.Environment(map[string]interface{}{ "Path": "/tmp", "Labels": map[string]string{ "env": "prod" } })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    want = []string{ `ARG_LABELS={"env":"prod"}`, "ARG_PATH=/tmp" }
+    if !reflect.DeepEqual(env, want) {
+        t.Errorf("env = %q, want %q", env, want)
+    }
+
+    // no environment without the option
+    env, err = New("test", "bash", `echo`).Environment(envArguments{})
+    if env != nil || err != nil {
+        t.Errorf("env = %q, error = %v, want nil", env, err)
+    }
+}
+
+func TestEnvironmentParams(t *testing.T) {
+    fsys := fstest.MapFS{
+        "test.sh": { Data: []byte("# ---\n# params:\n#   Retries: int, default=3\n# ---\necho") },
+    }
+    s, err := NewFromFS(fsys, "test.sh", WithEnvArguments())
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    env, err := s.Environment(map[string]string{})
+    if err != nil || !reflect.DeepEqual(env, []string{ "ARG_RETRIES=3" }) {
+        t.Errorf("env = %q, error = %v, want the default", env, err)
+    }
+
+    _, err = s.Environment(map[string]string{ "Retries": "many" })
+    if err == nil || !strings.Contains(err.Error(), "invalid param \"Retries\"") {
+        t.Errorf("error %v is not an invalid param error", err)
+    }
+}
+
+func TestEnvironmentErrors(t *testing.T) {
+    s := New("test", "bash", `echo`, WithEnvArguments())
+
+    tests := []struct {
+        arguments interface{}
+        want      string
+    }{
+        { map[string]string{ "FilePath": "a", "file_path": "b" }, `are both exported as ARG_FILE_PATH` },
+        { map[string]string{ "Path": "a\x00b" },                 `cannot contain NUL` },
+        { map[string]interface{}{ "Func": func() {} },            `cannot export argument "Func"` },
+        { "path",                                                 `must be a struct or a map` },
+    }
+
+    for _, test := range tests {
+        _, err := s.Environment(test.arguments)
+        if err == nil || !strings.Contains(err.Error(), test.want) {
+            t.Errorf("%#v: error %v does not contain %q", test.arguments, err, test.want)
+        }
+    }
+}
+
+func TestEnvPrologue(t *testing.T) {
+    env := []string{ "ARG_A=it's 100%", "ARG_B=x=y", `ARG_C=a" & calc & "^|<>()` }
+
+    tests := []struct {
+        shell string
+        want  string
+    }{
+        { "powershell", "$env:ARG_A = 'it''s 100%'\n$env:ARG_B = 'x=y'\n$env:ARG_C = 'a\" & calc & \"^|<>()'\n" },
+        { "cmd",        "set ARG_A=it's 100%%\nset ARG_B=x=y\nset ARG_C=a^\" ^& calc ^& ^\"^^^|^<^>^(^)\n" },
+        { "bash",       "export ARG_A='it'\\''s 100%'\nexport ARG_B='x=y'\nexport ARG_C='a\" & calc & \"^|<>()'\n" },
+    }
+
+    for _, test := range tests {
+        got, err := New("test", test.shell, ``).EnvPrologue(env)
+        if err != nil || got != test.want {
+            t.Errorf("%s: prologue = %q, error = %v, want %q", test.shell, got, err, test.want)
+        }
+    }
+
+    _, err := New("test", "cmd", ``).EnvPrologue([]string{ "ARG_A=a\nb" })
+    if err == nil || !strings.Contains(err.Error(), "contains a newline") {
+        t.Errorf("error %v is not a newline error", err)
+    }
+
+    _, err = New("test", "cmd", ``).EnvPrologue([]string{ "ARG_A=hello!" })
+    if err == nil || !strings.Contains(err.Error(), "contains a '!'") {
+        t.Errorf("error %v is not a '!' error", err)
+    }
+
+    _, err = New("test", "bash", ``).EnvPrologue([]string{ "ARG_A" })
+    if err == nil || !strings.Contains(err.Error(), "must be \"NAME=value\"") {
+        t.Errorf("error %v is not an invalid variable error", err)
+    }
+
+    for _, shell := range []string{ "bash", "powershell", "cmd" } {
+        for _, entry := range []string{ "1A=x", "A-B=x", "A;touch x=y", "$(id)=x", "A B=x" } {
+            _, err = New("test", shell, ``).EnvPrologue([]string{ entry })
+            if err == nil || !strings.Contains(err.Error(), "invalid environment variable name") {
+                t.Errorf("%s: %q: error %v is not an invalid name error", shell, entry, err)
+            }
+        }
+    }
+}
+
+func TestEnvPrologueSh(t *testing.T) {
+    if _, err := exec.LookPath("bash"); err != nil {
+        t.Skip("bash not found")
+    }
+
+    s := New("test", "bash", `printf '[%s]' "$ARG_VALUE"`, WithEnvArguments())
+    env, err := s.Environment(map[string]string{ "Value": testValue })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    prologue, err := s.EnvPrologue(env)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    code := prologue + render(t, s, nil)
+    output, err := exec.Command("bash", "-c", code).Output()
+    if err != nil {
+        t.Fatalf("cannot run %q: %v", code, err)
+    }
+
+    want := "[" + testValue + "]"
+    if string(output) != want {
+        t.Errorf("output = %q, want %q\ncode: %s", output, want, code)
+    }
+}
+
+func TestDirPrologue(t *testing.T) {
+    tests := []struct {
+        shell string
+        want  string
+    }{
+        { "powershell", "Set-Location -LiteralPath 'C:\\it''s here' -ErrorAction Stop\n" },
+        { "cmd",        "cd /D \"C:\\it's here\" || exit /B 1\n" },
+        { "bash",       "cd 'C:\\it'\\''s here' || exit 1\n" },
+    }
+
+    for _, test := range tests {
+        got, err := New("test", test.shell, ``).DirPrologue(`C:\it's here`)
+        if err != nil || got != test.want {
+            t.Errorf("%s: prologue = %q, error = %v, want %q", test.shell, got, err, test.want)
+        }
+    }
+
+    _, err := New("test", "bash", ``).DirPrologue("a\nb")
+    if err == nil || !strings.Contains(err.Error(), "contains a newline") {
+        t.Errorf("error %v is not a newline error", err)
+    }
+}
+
+//------------------------------------------------------------------------------
+
@@ -0,0 +1,938 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package script
+
+import (
+    "fmt"
+    "regexp"
+    "strings"
+    "text/template"
+    "text/template/parse"
+)
+
+//------------------------------------------------------------------------------
+
+// a value that isn't escaped when using WithAutoescape(), for instance a trusted snippet of code
+type Raw string
+
+// the quoting context of an action
+type quoting int
+
+const (
+    quotingBare quoting = iota
+    quotingSingle
+    quotingDouble
+    quotingComment             // until the end of the line
+    quotingBlockComment        // powershell's "<# ... #>"
+    quotingAnsiC               // sh's "$'...'", actions are rejected
+    quotingHeredocWord         // the delimiter after sh's "<<", actions are rejected
+    quotingHeredoc             // the body of a sh here-document with an unquoted delimiter, like "..." without the quotes
+    quotingHeredocLiteral      // the body of a sh here-document with a quoted delimiter
+    quotingHereString          // powershell's "@"...\n"@", like "..." without the quotes
+    quotingHereStringLiteral   // powershell's "@'...\n'@"
+)
+
+// the substitution or here-document that contains a context
+type frame int
+
+const (
+    frameTop frame = iota
+    frameSubst         // "$(...)", a command substitution in sh or a subexpression in powershell
+    frameBacktick      // sh's "`...`", the shell removes a level of backslashes before it executes the code
+    frameHeredoc       // the body of a sh here-document, until the line with the delimiter
+    frameUnsupported   // sh's "$((...))", "${...}" and nested "\`...\`", powershell's "${...}", actions are rejected
+)
+
+// a sh here-document
+type heredoc struct {
+    delimiter string
+    quoted    bool   // the delimiter is quoted, the body is literal
+    strip     bool   // "<<-" strips the leading tabs of the lines
+    quote     rune   // the quote that is open while reading the delimiter
+}
+
+// the state of the shell's lexer at an action
+type context struct {
+    quoting quoting
+    escaped bool     // the previous character escapes the next one
+    word    bool     // the previous character is part of a word, a '#' doesn't start a comment
+    dollar  bool     // the previous character is an unescaped '$', an action cannot follow it
+    line    string   // the first characters of the line, to recognize cmd's "rem" and "::" comments and the ends of here-documents
+
+    frame   frame
+    open    rune        // the opening bracket of the frame, counted in 'depth'
+    closing string      // the characters that end the frame when 'depth' is 0
+    depth   int
+    heredoc heredoc     // the here-document of a frameHeredoc, or the here-document whose delimiter is being read
+    pending []heredoc   // here-documents that start on the next line
+    outer   *context    // the context around the frame, nil for frameTop
+}
+
+type dialect int
+
+const (
+    dialectSh dialect = iota
+    dialectPowerShell
+    dialectCmd
+)
+
+type escaper struct {
+    dialect dialect
+    tree    *parse.Tree
+}
+
+// functions added to the template when autoescaping, actions ending with them are not escaped again
+var escapeFuncs = template.FuncMap{
+    "_escape_sh":                        escapeSh,
+    "_escape_sh_single":                 escapeShSingle,
+    "_escape_sh_double":                 escapeShDouble,
+    "_escape_sh_backquote":              escapeShBackquote,
+    "_escape_sh_heredoc":                escapeShHeredoc,
+    "_escape_sh_heredoc_literal":        escapeShHeredocLiteral,
+    "_escape_powershell":                escapePowerShell,
+    "_escape_powershell_single":         escapePowerShellSingle,
+    "_escape_powershell_double":         escapePowerShellDouble,
+    "_escape_powershell_here_literal":   escapePowerShellHereLiteral,
+    "_escape_powershell_block_comment":  escapePowerShellBlockComment,
+    "_escape_cmd":                       escapeCmd,
+    "_escape_cmd_double":                escapeCmdDouble,
+    "_escape_comment":                   escapeComment,
+    "_escape_line":                      escapeLine,
+}
+
+// quoting functions of the scripts, actions ending with them are not escaped again when they are used in a bare word of their dialect
+var quoteFuncs = map[string]dialect{
+    "shquote":  dialectSh,
+    "psquote":  dialectPowerShell,
+    "cmdquote": dialectCmd,
+}
+
+var shSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+//------------------------------------------------------------------------------
+
+func escapeTemplate(t *template.Template, shell string) error {
+    // adds escaping functions to every action that outputs a value, depending on the quoting context of the action
+    var d dialect
+    switch shell {
+    case "sh", "bash", "dash", "ash", "ksh", "zsh":
+        d = dialectSh
+    case "powershell", "pwsh":
+        d = dialectPowerShell
+    case "cmd":
+        d = dialectCmd
+    default:
+        return fmt.Errorf("[golang-exec/script/escapeTemplate()] cannot autoescape for shell %q\n", shell)
+    }
+
+    for _, tt := range t.Templates() {
+        if tt.Tree == nil || tt.Tree.Root == nil {
+            continue
+        }
+
+        e := &escaper{ dialect: d, tree: tt.Tree }
+        c, err := e.escapeList(tt.Tree.Root, context{})
+        if err != nil {
+            return err
+        }
+
+        // the delimiter of a here-document can be the last line, without a newline
+        if c.frame == frameHeredoc && c.line == c.heredoc.delimiter {
+            c.pop()
+        }
+        if (c.quoting != quotingBare && c.quoting != quotingComment) || c.outer != nil || len(c.pending) > 0 {
+            return fmt.Errorf("[golang-exec/script/escapeTemplate()] template %q ends inside a quoted string, comment, substitution or here-document\n", tt.Name())
+        }
+    }
+
+    return nil
+}
+
+func (e *escaper) escapeList(list *parse.ListNode, c context) (context, error) {
+    if list == nil {
+        return c, nil
+    }
+
+    var err error
+    for _, node := range list.Nodes {
+        switch n := node.(type) {
+        case *parse.TextNode:
+            c = e.scan(c, []rune(string(n.Text)))
+        case *parse.ActionNode:
+            if len(n.Pipe.Decl) > 0 {
+                break
+            }
+
+            funcs, funcsErr := e.actionFuncs(c, n.Pipe)
+            if funcsErr != nil {
+                location, _ := e.tree.ErrorContext(n)
+                return c, fmt.Errorf("[golang-exec/script/escapeTemplate()] %s: %w\n", location, funcsErr)
+            }
+            for _, f := range funcs {
+                n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+                    NodeType: parse.NodeCommand,
+                    Args: []parse.Node{ parse.NewIdentifier(f).SetTree(e.tree).SetPos(n.Position()) },
+                })
+            }
+
+            // the value is part of a word
+            c.escaped = false
+            c.dollar = false
+            c.word = true
+            if len(c.line) < 4 {
+                c.line += "_"
+            }
+        case *parse.IfNode:
+            c, err = e.escapeBranch(&n.BranchNode, c, "if")
+        case *parse.RangeNode:
+            c, err = e.escapeBranch(&n.BranchNode, c, "range")
+        case *parse.WithNode:
+            c, err = e.escapeBranch(&n.BranchNode, c, "with")
+        case *parse.TemplateNode:
+            // the template is escaped for a bare word, outside of substitutions that need more escaping
+            if !c.isBare() {
+                location, _ := e.tree.ErrorContext(n)
+                return c, fmt.Errorf("[golang-exec/script/escapeTemplate()] %s: cannot call {{template %q}} inside a quoted string, comment, \"`...`\" or here-document\n", location, n.Name)
+            }
+            c.word = false
+        }
+        if err != nil {
+            return c, err
+        }
+    }
+
+    return c, nil
+}
+
+func (e *escaper) escapeBranch(n *parse.BranchNode, c context, keyword string) (context, error) {
+    // the quoting context after {{if}}, {{range}} and {{with}} must not depend on the branch that is executed
+    c1, err := e.escapeList(n.List, c)
+    if err != nil {
+        return c, err
+    }
+
+    c2 := c
+    if n.ElseList != nil {
+        c2, err = e.escapeList(n.ElseList, c)
+        if err != nil {
+            return c, err
+        }
+    }
+
+    if !c1.same(c2) || (keyword == "range" && !c1.same(c)) {
+        location, _ := e.tree.ErrorContext(n)
+        return c, fmt.Errorf("[golang-exec/script/escapeTemplate()] %s: {{%s}} ends in a different quoting context than it starts\n", location, keyword)
+    }
+
+    return c1, nil
+}
+
+func (e *escaper) actionFuncs(c context, pipe *parse.PipeNode) ([]string, error) {
+    // returns the functions that escape the value of an action, the innermost quoting context first
+    last := lastFunc(pipe)
+    if escapeFuncs[last] != nil {
+        return nil, nil   // escaped already
+    }
+
+    if c.dollar {
+        return nil, fmt.Errorf("cannot use an action right after a '$'")
+    }
+
+    var funcs []string
+    if d, ok := quoteFuncs[last]; !ok || d != e.dialect || c.quoting != quotingBare {
+        f, err := e.escapeFunc(c)
+        if err != nil {
+            return nil, err
+        }
+        funcs = append(funcs, f)
+    }
+
+    // a substitution inside a here-document or here-string cannot have a newline that starts a line with its end
+    line := false
+    for o := &c; o != nil; o = o.outer {
+        switch o.frame {
+        case frameUnsupported:
+            return nil, fmt.Errorf("cannot use an action inside \"$((...))\", \"${...}\" or a nested \"\\`...\\`\"")
+        case frameBacktick:
+            funcs = append(funcs, "_escape_sh_backquote")
+        case frameHeredoc:
+            if o != &c {
+                start := c.line
+                if o.heredoc.strip {
+                    start = strings.TrimLeft(start, "\t")
+                }
+                if strings.HasPrefix(o.heredoc.delimiter, start) {
+                    return nil, fmt.Errorf("cannot use an action at the start of a line in a here-document")
+                }
+                line = true
+            }
+        }
+        if o != &c && o.quoting == quotingHereString {
+            line = true
+        }
+    }
+    if line {
+        funcs = append(funcs, "_escape_line")
+    }
+
+    return funcs, nil
+}
+
+func (e *escaper) escapeFunc(c context) (string, error) {
+    switch c.quoting {
+    case quotingComment:
+        return "_escape_comment", nil
+    case quotingBlockComment:
+        return "_escape_powershell_block_comment", nil
+    case quotingAnsiC:
+        return "", fmt.Errorf("cannot use an action inside \"$'...'\"")
+    case quotingHeredocWord:
+        return "", fmt.Errorf("cannot use an action in the delimiter of a here-document")
+    case quotingHeredoc, quotingHeredocLiteral:
+        // the line cannot become the delimiter when it starts with text that isn't the start of the delimiter
+        if strings.HasPrefix(c.heredoc.delimiter, c.line) {
+            return "", fmt.Errorf("cannot use an action at the start of a line in a here-document")
+        }
+        if c.quoting == quotingHeredocLiteral {
+            return "_escape_sh_heredoc_literal", nil
+        }
+        return "_escape_sh_heredoc", nil
+    case quotingHereString:
+        return "_escape_powershell_double", nil
+    case quotingHereStringLiteral:
+        if strings.TrimSpace(c.line) == "" {
+            return "", fmt.Errorf("cannot use an action at the start of a line in a here-string")
+        }
+        return "_escape_powershell_here_literal", nil
+    }
+
+    switch e.dialect {
+    case dialectPowerShell:
+        switch c.quoting {
+        case quotingSingle:
+            return "_escape_powershell_single", nil
+        case quotingDouble:
+            return "_escape_powershell_double", nil
+        }
+        return "_escape_powershell", nil
+    case dialectCmd:
+        if c.quoting == quotingDouble {
+            return "_escape_cmd_double", nil
+        }
+        return "_escape_cmd", nil
+    default:
+        switch c.quoting {
+        case quotingSingle:
+            return "_escape_sh_single", nil
+        case quotingDouble:
+            return "_escape_sh_double", nil
+        }
+        return "_escape_sh", nil
+    }
+}
+
+func lastFunc(pipe *parse.PipeNode) string {
+    // returns the name of the function that produces the value of a pipeline, "" when it isn't a function
+    if len(pipe.Cmds) == 0 {
+        return ""
+    }
+
+    last := pipe.Cmds[len(pipe.Cmds)-1]
+    if len(last.Args) == 0 {
+        return ""
+    }
+
+    identifier, ok := last.Args[0].(*parse.IdentifierNode)
+    if !ok {
+        return ""
+    }
+    return identifier.Ident
+}
+
+//------------------------------------------------------------------------------
+
+func (c *context) push(f frame, open rune, closing string) {
+    // starts a substitution or here-document, the current context is restored when it ends
+    outer := *c
+    outer.escaped = false
+    outer.dollar = false
+    *c = context{ line: "$", frame: f, open: open, closing: closing, outer: &outer }
+}
+
+func (c *context) pop() {
+    // ends a substitution or here-document
+    f := c.frame
+    *c = *c.outer
+    c.word = f != frameHeredoc   // a substitution is part of a word
+    if f == frameHeredoc {
+        c.line = ""
+    } else if len(c.line) < 4 {
+        c.line += "$"
+    }
+}
+
+func (c *context) startHeredoc() {
+    // starts the first pending here-document, at the start of the next line
+    h := c.pending[0]
+    c.pending = c.pending[1:]
+    c.push(frameHeredoc, 0, "")
+    c.line = ""
+    c.heredoc = h
+    c.quoting = quotingHeredoc
+    if h.quoted {
+        c.quoting = quotingHeredocLiteral
+    }
+}
+
+func (c context) isBare() bool {
+    // the context is a bare word, and isn't inside a substitution that needs more escaping
+    if c.quoting != quotingBare || len(c.pending) > 0 {
+        return false
+    }
+    for o := &c; o != nil; o = o.outer {
+        if o.frame != frameTop && o.frame != frameSubst {
+            return false
+        }
+    }
+    return true
+}
+
+func (c context) same(d context) bool {
+    // the contexts have the same quoting, ignoring the state of the current word and line
+    if c.quoting != d.quoting || c.frame != d.frame || c.depth != d.depth || c.heredoc != d.heredoc || len(c.pending) != len(d.pending) {
+        return false
+    }
+    if c.outer == nil || d.outer == nil {
+        return c.outer == d.outer
+    }
+    return c.outer.same(*d.outer)
+}
+
+//------------------------------------------------------------------------------
+
+func (e *escaper) scan(c context, text []rune) context {
+    // follows the quoting context through the text between actions
+    for i := 0; i < len(text); i++ {
+        ch := text[i]
+
+        if c.escaped {
+            c.escaped = false
+            c.dollar = false
+            c.word = ch != '\n'
+            continue
+        }
+
+        switch e.dialect {
+        case dialectPowerShell:
+            i += e.scanPowerShell(&c, text[i:])
+        case dialectCmd:
+            e.scanCmd(&c, ch)
+        default:
+            i += e.scanSh(&c, text[i:])
+        }
+    }
+
+    return c
+}
+
+func (e *escaper) scanSh(c *context, text []rune) int {
+    // returns the number of characters to skip after the first character of 'text'
+    ch, next, next2 := runeAt(text, 0), runeAt(text, 1), runeAt(text, 2)
+
+    // the start of the line, to recognize the end of a here-document and actions at the start of a line
+    line := c.line
+    if ch == '\n' {
+        c.line = ""
+    } else if (len(c.line) <= 64 || len(c.line) <= len(c.heredoc.delimiter)) && !(c.frame == frameHeredoc && c.heredoc.strip && c.line == "" && ch == '\t') {
+        c.line += string(ch)
+    }
+
+    // "`...`" ends at the next unescaped backquote, also inside quotes
+    if (c.frame == frameBacktick && ch == '`') || (c.closing == "\\`" && ch == '\\' && next == '`') {
+        skip := len(c.closing) - 1
+        c.pop()
+        return skip
+    }
+    if c.quoting == quotingBare && c.closing != "" && c.depth == 0 && strings.HasPrefix(string(text), c.closing) {
+        skip := len(c.closing) - 1
+        c.pop()
+        return skip
+    }
+
+    switch c.quoting {
+    case quotingBare:
+        switch {
+        case ch == '\\' && c.frame == frameBacktick && next == '`':
+            c.push(frameUnsupported, 0, "\\`")
+            return 1
+        case ch == '\\':
+            c.escaped = true
+        case ch == '$' && next == '\'':
+            c.quoting = quotingAnsiC
+            c.word = true
+            return 1
+        case ch == '\'':
+            c.quoting = quotingSingle
+        case ch == '"':
+            c.quoting = quotingDouble
+        case ch == '#' && !c.word:
+            c.quoting = quotingComment
+        case ch == '<' && next == '<' && next2 == '<':
+            c.word = false
+            return 2   // here-string, followed by a word
+        case ch == '<' && next == '<' && c.frame != frameUnsupported:
+            c.quoting = quotingHeredocWord
+            c.heredoc = heredoc{ strip: next2 == '-' }
+            if c.heredoc.strip {
+                return 2
+            }
+            return 1
+        case ch == '\n' && len(c.pending) > 0:
+            c.startHeredoc()
+            return 0
+        case c.open != 0 && ch == c.open:
+            c.depth++
+        case c.open != 0 && ch == rune(c.closing[0]) && c.depth > 0:
+            c.depth--
+        }
+        if skip, ok := e.scanShSubst(c, ch, next, next2); ok {
+            return skip
+        }
+        c.word = !strings.ContainsRune(" \t\n;&|()<>", ch)
+        c.dollar = ch == '$'
+    case quotingSingle:
+        if ch == '\'' {
+            c.quoting = quotingBare
+            c.word = true
+        }
+    case quotingDouble:
+        switch ch {
+        case '\\':
+            c.escaped = true
+        case '"':
+            c.quoting = quotingBare
+            c.word = true
+            return 0
+        }
+        if skip, ok := e.scanShSubst(c, ch, next, next2); ok {
+            return skip
+        }
+        c.dollar = ch == '$'
+    case quotingAnsiC:
+        switch ch {
+        case '\\':
+            c.escaped = true
+        case '\'':
+            c.quoting = quotingBare
+            c.word = true
+        }
+    case quotingComment:
+        if ch == '\n' {
+            c.quoting = quotingBare
+            c.word = false
+            if len(c.pending) > 0 {
+                c.startHeredoc()
+            }
+        }
+    case quotingHeredocWord:
+        h := &c.heredoc
+        switch {
+        case h.quote != 0:
+            if ch == h.quote {
+                h.quote = 0
+            } else {
+                h.delimiter += string(ch)
+            }
+        case ch == '\'' || ch == '"':
+            h.quote = ch
+            h.quoted = true
+        case ch == '\\':
+            h.quoted = true
+            if next != 0 {
+                h.delimiter += string(next)
+                return 1
+            }
+        case (ch == ' ' || ch == '\t') && h.delimiter == "" && !h.quoted:
+            // blanks before the delimiter
+        case strings.ContainsRune(" \t\n;&|()<>", ch):
+            // the end of the delimiter, the character is part of the command
+            c.pending = append(c.pending[:len(c.pending):len(c.pending)], *h)
+            c.heredoc = heredoc{}
+            c.quoting = quotingBare
+            return e.scanSh(c, text)
+        default:
+            h.delimiter += string(ch)
+        }
+    case quotingHeredoc, quotingHeredocLiteral:
+        if ch == '\n' {
+            if line == c.heredoc.delimiter {
+                c.pop()
+                if len(c.pending) > 0 {
+                    c.startHeredoc()
+                }
+            }
+            return 0
+        }
+
+        if c.quoting == quotingHeredocLiteral {
+            return 0
+        }
+        if ch == '\\' {
+            c.escaped = true
+        }
+        if skip, ok := e.scanShSubst(c, ch, next, next2); ok {
+            return skip
+        }
+        c.dollar = ch == '$'
+    }
+
+    return 0
+}
+
+func (e *escaper) scanShSubst(c *context, ch rune, next rune, next2 rune) (int, bool) {
+    // starts the substitutions that are expanded in bare words, "..." and here-documents
+    // returns the number of characters to skip, and true when a substitution is started
+    switch {
+    case ch == '$' && next == '(' && next2 == '(':
+        c.push(frameUnsupported, '(', "))")
+        return 2, true
+    case ch == '$' && next == '(':
+        c.push(frameSubst, '(', ")")
+        return 1, true
+    case ch == '$' && next == '{':
+        c.push(frameUnsupported, '{', "}")
+        return 1, true
+    case ch == '`':
+        c.push(frameBacktick, 0, "`")
+        return 0, true
+    }
+
+    return 0, false
+}
+
+func (e *escaper) scanPowerShell(c *context, text []rune) int {
+    // returns the number of characters to skip after the first character of 'text'
+    ch, next := runeAt(text, 0), runeAt(text, 1)
+
+    if c.quoting == quotingBare && c.closing != "" && c.depth == 0 && strings.HasPrefix(string(text), c.closing) {
+        skip := len(c.closing) - 1
+        c.pop()
+        return skip
+    }
+
+    switch c.quoting {
+    case quotingBare:
+        switch {
+        case ch == '`':
+            c.escaped = true
+        case ch == '@' && isPowerShellSingleQuote(next):
+            c.quoting = quotingHereStringLiteral
+            c.line = "@"
+            return 1
+        case ch == '@' && isPowerShellDoubleQuote(next):
+            c.quoting = quotingHereString
+            c.line = "@"
+            return 1
+        case isPowerShellSingleQuote(ch):
+            c.quoting = quotingSingle
+        case isPowerShellDoubleQuote(ch):
+            c.quoting = quotingDouble
+        case ch == '<' && next == '#':
+            c.quoting = quotingBlockComment
+            return 1
+        case ch == '#' && !c.word:
+            c.quoting = quotingComment
+        case c.open != 0 && ch == c.open:
+            c.depth++
+        case c.open != 0 && ch == rune(c.closing[0]) && c.depth > 0:
+            c.depth--
+        }
+        if skip, ok := e.scanPowerShellSubst(c, ch, next); ok {
+            return skip
+        }
+        c.word = !strings.ContainsRune(" \t\n;&|(){}<>,", ch)
+        c.dollar = ch == '$'
+    case quotingSingle:
+        if isPowerShellSingleQuote(ch) {
+            if isPowerShellSingleQuote(next) {
+                return 1   // escaped quote
+            }
+            c.quoting = quotingBare
+            c.word = true
+        }
+    case quotingDouble:
+        switch {
+        case ch == '`':
+            c.escaped = true
+        case isPowerShellDoubleQuote(ch):
+            if isPowerShellDoubleQuote(next) {
+                return 1   // escaped quote
+            }
+            c.quoting = quotingBare
+            c.word = true
+            return 0
+        }
+        if skip, ok := e.scanPowerShellSubst(c, ch, next); ok {
+            return skip
+        }
+        c.dollar = ch == '$'
+    case quotingHereString, quotingHereStringLiteral:
+        // a here-string ends at a line starting with "@ or '@
+        if ch == '\n' {
+            c.line = ""
+            return 0
+        }
+        if c.line == "" && next == '@' && ((c.quoting == quotingHereString && isPowerShellDoubleQuote(ch)) || (c.quoting == quotingHereStringLiteral && isPowerShellSingleQuote(ch))) {
+            c.quoting = quotingBare
+            c.word = true
+            return 1
+        }
+        if len(c.line) < 4 {
+            c.line += string(ch)
+        }
+
+        if c.quoting == quotingHereStringLiteral {
+            return 0
+        }
+        if ch == '`' {
+            c.escaped = true
+        }
+        if skip, ok := e.scanPowerShellSubst(c, ch, next); ok {
+            return skip
+        }
+        c.dollar = ch == '$'
+    case quotingComment:
+        if ch == '\n' {
+            c.quoting = quotingBare
+            c.word = false
+        }
+    case quotingBlockComment:
+        if ch == '#' && next == '>' {
+            c.quoting = quotingBare
+            c.word = false
+            return 1
+        }
+    }
+
+    return 0
+}
+
+func (e *escaper) scanPowerShellSubst(c *context, ch rune, next rune) (int, bool) {
+    // starts the subexpressions that are expanded in bare words, "..." and here-strings
+    // returns the number of characters to skip, and true when a subexpression is started
+    switch {
+    case ch == '$' && next == '(':
+        c.push(frameSubst, '(', ")")
+        return 1, true
+    case ch == '$' && next == '{':
+        c.push(frameUnsupported, '{', "}")
+        return 1, true
+    }
+
+    return 0, false
+}
+
+func (e *escaper) scanCmd(c *context, ch rune) {
+    if ch == '\n' {
+        // quotes and comments don't continue on the next line
+        c.quoting = quotingBare
+        c.word = false
+        c.line = ""
+        return
+    }
+
+    switch c.quoting {
+    case quotingBare:
+        switch ch {
+        case '^':
+            c.escaped = true
+        case '"':
+            c.quoting = quotingDouble
+        }
+
+        if len(c.line) < 4 && !(c.line == "" && strings.ContainsRune(" \t@", ch)) {
+            c.line += strings.ToLower(string(ch))
+            if c.line == "::" || c.line == "rem " || c.line == "rem\t" {
+                c.quoting = quotingComment
+            }
+        }
+    case quotingDouble:
+        if ch == '"' {
+            c.quoting = quotingBare
+        }
+    }
+}
+
+func runeAt(text []rune, i int) rune {
+    if i < len(text) {
+        return text[i]
+    }
+    return 0
+}
+
+func isPowerShellSingleQuote(ch rune) bool {
+    return ch == '\'' || ch == '‘' || ch == '’' || ch == '‚' || ch == '‛'
+}
+
+func isPowerShellDoubleQuote(ch rune) bool {
+    return ch == '"' || ch == '“' || ch == '”' || ch == '„'
+}
+
+//------------------------------------------------------------------------------
+
+func stringValue(value interface{}) (string, bool) {
+    // returns the value as printed by text/template, and true when it is Raw
+    switch v := value.(type) {
+    case Raw:
+        return string(v), true
+    case string:
+        return v, false
+    case nil:
+        return "<no value>", false
+    }
+    return fmt.Sprint(value), false
+}
+
+func escapeSh(value interface{}) (string, error) {
+    // quotes a bare word, unless it only contains safe characters
+    s, raw := stringValue(value)
+    if raw || shSafe.MatchString(s) {
+        return s, nil
+    }
+    return "'" + strings.Replace(s, "'", `'\''`, -1) + "'", nil
+}
+
+func escapeShSingle(value interface{}) (string, error) {
+    s, raw := stringValue(value)
+    if raw {
+        return s, nil
+    }
+    return strings.Replace(s, "'", `'\''`, -1), nil
+}
+
+func escapeShDouble(value interface{}) (string, error) {
+    s, raw := stringValue(value)
+    if raw {
+        return s, nil
+    }
+    return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "`", "\\`").Replace(s), nil
+}
+
+func escapeShBackquote(value interface{}) (string, error) {
+    // escapes escaped code again for "`...`", the shell removes a level of backslashes before it executes the code
+    s, _ := stringValue(value)
+    return strings.NewReplacer(`\`, `\\`, "`", "\\`", `$`, `\$`).Replace(s), nil
+}
+
+func escapeShHeredoc(value interface{}) (string, error) {
+    s, raw := stringValue(value)
+    if raw {
+        return s, nil
+    }
+    if strings.Contains(s, "\n") {
+        return "", fmt.Errorf("cannot escape a newline in a here-document")
+    }
+    return strings.NewReplacer(`\`, `\\`, `$`, `\$`, "`", "\\`").Replace(s), nil
+}
+
+func escapeShHeredocLiteral(value interface{}) (string, error) {
+    // a here-document with a quoted delimiter is literal, a newline could start a line with the delimiter
+    s, raw := stringValue(value)
+    if raw {
+        return s, nil
+    }
+    if strings.Contains(s, "\n") {
+        return "", fmt.Errorf("cannot escape a newline in a here-document")
+    }
+    return s, nil
+}
+
+func escapeLine(value interface{}) (string, error) {
+    // rejects a newline in an escaped value
+    s, _ := stringValue(value)
+    if strings.Contains(s, "\n") {
+        return "", fmt.Errorf("cannot escape a newline in a here-document or here-string")
+    }
+    return s, nil
+}
+
+func escapePowerShell(value interface{}) (string, error) {
+    s, raw := stringValue(value)
+    if raw {
+        return s, nil
+    }
+    single, _ := escapePowerShellSingle(s)
+    return "'" + single + "'", nil
+}
+
+func escapePowerShellSingle(value interface{}) (string, error) {
+    s, raw := stringValue(value)
+    if raw {
+        return s, nil
+    }
+    return strings.NewReplacer("'", "''", "‘", "‘‘", "’", "’’", "‚", "‚‚", "‛", "‛‛").Replace(s), nil
+}
+
+func escapePowerShellDouble(value interface{}) (string, error) {
+    s, raw := stringValue(value)
+    if raw {
+        return s, nil
+    }
+    return strings.NewReplacer("`", "``", "$", "`$", `"`, "`\"", "“", "`“", "”", "`”", "„", "`„").Replace(s), nil
+}
+
+func escapePowerShellHereLiteral(value interface{}) (string, error) {
+    // a literal here-string cannot be escaped, a newline could start a line with its end
+    s, raw := stringValue(value)
+    if raw {
+        return s, nil
+    }
+    if strings.ContainsAny(s, "\r\n") {
+        return "", fmt.Errorf("cannot escape a newline in a here-string")
+    }
+    return s, nil
+}
+
+func escapePowerShellBlockComment(value interface{}) (string, error) {
+    s, raw := stringValue(value)
+    if raw {
+        return s, nil
+    }
+    return strings.Replace(s, "#>", "# >", -1), nil
+}
+
+func escapeCmd(value interface{}) (string, error) {
+    s, raw := stringValue(value)
+    if raw {
+        return s, nil
+    }
+    if strings.ContainsAny(s, "\r\n") {
+        return "", fmt.Errorf("cannot escape a newline for cmd")
+    }
+    return strings.NewReplacer("^", "^^", "&", "^&", "|", "^|", "<", "^<", ">", "^>", "(", "^(", ")", "^)", `"`, `^"`, "%", "%%").Replace(s), nil
+}
+
+func escapeCmdDouble(value interface{}) (string, error) {
+    s, raw := stringValue(value)
+    if raw {
+        return s, nil
+    }
+    if strings.ContainsAny(s, "\r\n") {
+        return "", fmt.Errorf("cannot escape a newline for cmd")
+    }
+    return strings.NewReplacer(`"`, `""`, "%", "%%").Replace(s), nil
+}
+
+func escapeComment(value interface{}) (string, error) {
+    s, raw := stringValue(value)
+    if raw {
+        return s, nil
+    }
+    return strings.NewReplacer("\r", " ", "\n", " ").Replace(s), nil
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,255 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package script
+
+import (
+    "io/ioutil"
+    "os/exec"
+    "strings"
+    "testing"
+)
+
+//------------------------------------------------------------------------------
+
+const testValue = "it's \"quoted\" $(touch injected) `id` ${HOME} ; & | % ^ ! \\ * ~\nnext line"
+
+func render(t *testing.T, s *Script, arguments interface{}) string {
+    t.Helper()
+
+    if s.Error != nil {
+        t.Fatalf("unexpected error: %v", s.Error)
+    }
+
+    reader, err := s.NewReader(arguments)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    code, _ := ioutil.ReadAll(reader)
+    return string(code)
+}
+
+//------------------------------------------------------------------------------
+
+func TestAutoescapeSh(t *testing.T) {
+    if _, err := exec.LookPath("bash"); err != nil {
+        t.Skip("bash not found")
+    }
+
+    s := New("test", "bash", `
+        # it's a comment with a value: {{.Value}}
+        printf '[%s]' {{.Value}} '{{.Value}}' "{{.Value}}" x{{.Value}}x {{.Empty}}
+        {{- if .Value}} '{{.Value}}'{{else}} "{{.Value}}"{{end}}
+        {{- range .List}} "{{.}}"{{end}}
+        {{- with $v := .Value}} {{$v}}{{end}}
+    `, WithAutoescape())
+
+    code := render(t, s, map[string]interface{}{ "Value": testValue, "Empty": "", "List": []string{ testValue } })
+    output, err := exec.Command("bash", "-c", code).Output()
+    if err != nil {
+        t.Fatalf("cannot run %q: %v", code, err)
+    }
+
+    v := "[" + testValue + "]"
+    want := v + v + v + "[x" + testValue + "x][]" + v + v + v
+    if string(output) != want {
+        t.Errorf("output = %q, want %q\ncode: %s", output, want, code)
+    }
+}
+
+func TestAutoescapeShSubstitutions(t *testing.T) {
+    if _, err := exec.LookPath("bash"); err != nil {
+        t.Skip("bash not found")
+    }
+
+    s := New("test", "bash", `
+        printf '[%s]' "$(printf '%s' {{.Value}})" $(printf '%s' "{{.Value}}" | wc -l) "$(printf '%s' "$(printf '%s' {{.Value}})")"
+        printf '[%s]' "` + "`printf '%s' {{.Value}}`" + `" "` + "`printf '%s' \"{{.Value}}\"`" + `" $((1 + 2))
+        printf '[%s]' "{{.Value | shquote}}" "$(printf '%s' {{.Value | shquote}})"
+        printf '[%s]' "$(cat <<EOF
+v {{.Value}}
+EOF
+        )"
+    `, WithAutoescape())
+
+    code := render(t, s, map[string]interface{}{ "Value": "x; echo PWNED `echo PWNED` \"$(echo PWNED)\" '" })
+    output, err := exec.Command("bash", "-c", code).Output()
+    if err != nil {
+        t.Fatalf("cannot run %q: %v", code, err)
+    }
+
+    v := "x; echo PWNED `echo PWNED` \"$(echo PWNED)\" '"
+    q := "'x; echo PWNED `echo PWNED` \"$(echo PWNED)\" '\\'''"
+    want := "[" + v + "][0][" + v + "]" + "[" + v + "][" + v + "][3]" + "[" + q + "][" + v + "]" + "[v " + v + "]"
+    if string(output) != want {
+        t.Errorf("output = %q, want %q\ncode: %s", output, want, code)
+    }
+}
+
+func TestAutoescapeShHeredoc(t *testing.T) {
+    if _, err := exec.LookPath("bash"); err != nil {
+        t.Skip("bash not found")
+    }
+
+    s := New("test", "bash", "cat <<EOF\n" +
+        "a {{.Value}}\n" +
+        "b $(printf '%s' {{.Value}}) \"{{.Value}}\"\n" +
+        "EOF\n" +
+        "cat <<-'EOF'\n" +
+        "\tc {{.Value}}\n" +
+        "\tEOF\n" +
+        "cat <<< {{.Value}}\n", WithAutoescape())
+
+    value := "$(echo PWNED) `echo PWNED` ${HOME} \\ '\""
+    code := render(t, s, map[string]string{ "Value": value })
+    output, err := exec.Command("bash", "-c", code).Output()
+    if err != nil {
+        t.Fatalf("cannot run %q: %v", code, err)
+    }
+
+    want := "a " + value + "\nb " + value + " \"" + value + "\"\nc " + value + "\n" + value + "\n"
+    if string(output) != want {
+        t.Errorf("output = %q, want %q\ncode: %s", output, want, code)
+    }
+
+    // a newline could end the here-document
+    _, err = s.NewReader(map[string]string{ "Value": "x\nEOF\necho PWNED" })
+    if err == nil {
+        t.Error("expected an error for a newline in a here-document")
+    }
+}
+
+func TestAutoescapePowerShell(t *testing.T) {
+    s := New("test", "powershell", `
+        # comment {{.Value}}
+        <# block {{.Value}} #>
+        Write-Output {{.Value}} '{{.Value}}' "{{.Value}}" 'it''s {{.Value}}'
+    `, WithAutoescape())
+
+    code := render(t, s, map[string]string{ "Value": "it's \"$x\" `n #>\nnext" })
+    want := `
+        # comment it's "$x" ` + "`n" + ` #> next
+        <# block it's "$x" ` + "`n" + ` # >
+next #>
+        Write-Output 'it''s "$x" ` + "`n" + ` #>
+next' 'it''s "$x" ` + "`n" + ` #>
+next' "it's ` + "`\"`$x`\" ``n" + ` #>
+next" 'it''s it''s "$x" ` + "`n" + ` #>
+next'
+    `
+    if code != want {
+        t.Errorf("code = %s\nwant %s", code, want)
+    }
+}
+
+func TestAutoescapePowerShellSubstitutions(t *testing.T) {
+    s := New("test", "powershell", "Write-Output \"$(Split-Path {{.Value}})\" \"$(Split-Path \"{{.Value}}\")\" {{.Value | psquote}}\n" +
+        "Write-Output @\"\nx {{.Value}} $(Split-Path {{.Value}})\n\"@\n" +
+        "Write-Output @'\nx {{.Value}}\n'@\n", WithAutoescape())
+
+    code := render(t, s, map[string]string{ "Value": "it's \"$(x)\"" })
+    want := "Write-Output \"$(Split-Path 'it''s \"$(x)\"')\" \"$(Split-Path \"it's `\"`$(x)`\"\")\" 'it''s \"$(x)\"'\n" +
+        "Write-Output @\"\nx it's `\"`$(x)`\" $(Split-Path 'it''s \"$(x)\"')\n\"@\n" +
+        "Write-Output @'\nx it's \"$(x)\"\n'@\n"
+    if code != want {
+        t.Errorf("code = %s\nwant %s", code, want)
+    }
+
+    // a newline could end the here-string
+    _, err := s.NewReader(map[string]string{ "Value": "x\n'@\nWrite-Output PWNED" })
+    if err == nil {
+        t.Error("expected an error for a newline in a here-string")
+    }
+
+    if _, err := exec.LookPath("pwsh"); err != nil {
+        return
+    }
+    output, err := exec.Command("pwsh", "-NoProfile", "-NonInteractive", "-Command", code).Output()
+    if err != nil {
+        t.Fatalf("cannot run %q: %v", code, err)
+    }
+    if strings.Contains(string(output), "PWNED") {
+        t.Errorf("output = %q", output)
+    }
+}
+
+func TestAutoescapeCmd(t *testing.T) {
+    s := New("test", "cmd", `
+        rem it's a comment {{.Value}}
+        echo {{.Value}} "{{.Value}}"
+    `, WithAutoescape())
+
+    code := render(t, s, map[string]string{ "Value": `a & b | "c" %PATH% (d) ^` })
+    want := `
+        rem it's a comment a & b | "c" %PATH% (d) ^
+        echo a ^& b ^| ^"c^" %%PATH%% ^(d^) ^^ "a & b | ""c"" %%PATH%% (d) ^"
+    `
+    if code != want {
+        t.Errorf("code = %s\nwant %s", code, want)
+    }
+
+    _, err := s.NewReader(map[string]string{ "Value": "line 1\nline 2" })
+    if err == nil {
+        t.Error("expected an error for a newline")
+    }
+}
+
+func TestAutoescapeRaw(t *testing.T) {
+    s := New("test", "bash", `{{.Code}} '{{.Value}}'`, WithAutoescape())
+
+    code := render(t, s, map[string]interface{}{ "Code": Raw("echo $HOME"), "Value": "it's" })
+    if code != `echo $HOME 'it'\''s'` {
+        t.Errorf("code = %q", code)
+    }
+}
+
+func TestAutoescapeErrors(t *testing.T) {
+    tests := []struct {
+        name  string
+        shell string
+        code  string
+    }{
+        { "shell",    "python", `print({{.Value}})` },
+        { "if",       "bash",   `echo {{if .Value}}'{{end}}'` },
+        { "range",    "bash",   `echo {{range .List}}"{{end}}"` },
+        { "template", "bash",   `{{define "t"}}x{{end}}echo '{{template "t"}}'` },
+        { "end",      "bash",   `echo '{{.Value}}` },
+        { "dollar",   "bash",   `echo ${{.Value}}` },
+        { "arith",    "bash",   `echo $((1 + {{.Value}}))` },
+        { "param",    "bash",   `echo ${HOME:-{{.Value}}}` },
+        { "ansi-c",   "bash",   `echo $'{{.Value}}'` },
+        { "backtick", "bash",   "echo `echo \\`echo {{.Value}}\\``" },
+        { "subst",    "bash",   `echo "$(echo {{.Value}}"` },
+        { "heredoc",  "bash",   "cat <<EOF\n{{.Value}}\nEOF\n" },
+        { "delim",    "bash",   "cat <<{{.Value}}\nx\n" },
+        { "nested",   "bash",   "cat <<EOF\n$(echo\n{{.Value}}\n)\nEOF\n" },
+        { "unended",  "bash",   "cat <<EOF\nx {{.Value}}\n" },
+        { "ps-subst", "powershell", `Write-Output "$(Split-Path {{.Value}}"` },
+        { "ps-here",  "powershell", "Write-Output @'\n{{.Value}}\n'@" },
+    }
+
+    for _, test := range tests {
+        s := New("test", test.shell, test.code, WithAutoescape())
+        if s.Error == nil {
+            t.Errorf("%s: expected an error", test.name)
+        }
+    }
+}
+
+func TestNoAutoescape(t *testing.T) {
+    s := New("test", "bash", `echo '{{.Value}}'`)
+
+    code := render(t, s, map[string]string{ "Value": testValue })
+    if code != "echo '" + testValue + "'" {
+        t.Errorf("code = %q", code)
+    }
+    if strings.Contains(code, "'\\''") {
+        t.Error("value is escaped without WithAutoescape()")
+    }
+}
+
+//------------------------------------------------------------------------------
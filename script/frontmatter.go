@@ -0,0 +1,162 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package script
+
+import (
+    "fmt"
+    "strings"
+    "time"
+)
+
+//------------------------------------------------------------------------------
+
+// front-matter is a header block in the comments at the start of a script file, optionally after a shebang line
+//
+//     # ---
+//     # shell: bash
+//     # description: restarts a service
+//     # timeout: 5m
+//     # params:
+//     #   Service: string, required
+//     #   Retries: int, default=3
+//     # ---
+//
+// the lines of the block start with "#", "::", "REM" or "//", and the same prefix as the first "---" line
+type frontMatter struct {
+    Shell       string
+    Description string
+    Timeout     time.Duration
+    Params      []Param
+}
+
+var commentPrefixes = []string{ "#", "::", "REM", "rem", "//" }
+
+//------------------------------------------------------------------------------
+
+func stripFrontMatter(code string) (string, error) {
+    // returns the code without the front-matter and the shebang line before it, used for partials
+    // the lines are removed, not replaced by empty lines, so they are not pasted into the script
+    fm, stripped, err := parseFrontMatter(code)
+    if err != nil || fm == nil {
+        return stripped, err
+    }
+
+    original := strings.Split(code, "\n")
+    lines := strings.Split(stripped, "\n")
+    end := 0
+    for i := range lines {
+        if lines[i] != original[i] {
+            end = i + 1
+        }
+    }
+
+    return strings.Join(lines[end:], "\n"), nil
+}
+
+func parseFrontMatter(code string) (*frontMatter, string, error) {
+    // returns the front-matter, or nil when there is no front-matter,
+    // and the code with the front-matter replaced by empty lines, to keep the line numbers in error messages
+    lines := strings.Split(code, "\n")
+
+    start := 0
+    if strings.HasPrefix(lines[0], "#!") {
+        start = 1
+    }
+    if start >= len(lines) {
+        return nil, code, nil
+    }
+    prefix, ok := frontMatterMarker(lines[start], commentPrefixes)
+    if !ok {
+        return nil, code, nil
+    }
+
+    fm := new(frontMatter)
+    params := -1   // indentation of "params:", -1 when not in params
+    for i := start + 1; i < len(lines); i++ {
+        line := strings.TrimSpace(lines[i])
+        if line == "" {
+            continue
+        }
+        if !strings.HasPrefix(line, prefix) {
+            return nil, "", fmt.Errorf("front-matter line %d doesn't start with %q", i + 1, prefix)
+        }
+        line = strings.TrimPrefix(line, prefix)
+
+        if _, end := frontMatterMarker(prefix + line, []string{ prefix }); end {
+            for j := start; j <= i; j++ {
+                lines[j] = ""
+            }
+            return fm, strings.Join(lines, "\n"), nil
+        }
+
+        if strings.TrimSpace(line) == "" {
+            continue
+        }
+
+        indent := len(line) - len(strings.TrimLeft(line, " \t"))
+        key, value, ok := splitKeyValue(line)
+        if !ok {
+            return nil, "", fmt.Errorf("front-matter line %d must be \"key: value\"", i + 1)
+        }
+
+        if params >= 0 && indent > params {
+            param, err := parseParam(key, value)
+            if err != nil {
+                return nil, "", fmt.Errorf("front-matter line %d: %w", i + 1, err)
+            }
+            fm.Params = append(fm.Params, *param)
+            continue
+        }
+        params = -1
+
+        switch strings.ToLower(key) {
+        case "shell":
+            fm.Shell = strings.ToLower(value)
+        case "description":
+            fm.Description = value
+        case "timeout":
+            timeout, err := time.ParseDuration(value)
+            if err != nil {
+                return nil, "", fmt.Errorf("front-matter line %d: invalid timeout: %w", i + 1, err)
+            }
+            fm.Timeout = timeout
+        case "params":
+            if value != "" {
+                return nil, "", fmt.Errorf("front-matter line %d: params must be on indented lines", i + 1)
+            }
+            params = indent
+        default:
+            return nil, "", fmt.Errorf("front-matter line %d: unknown key %q", i + 1, key)
+        }
+    }
+
+    return nil, "", fmt.Errorf("front-matter doesn't end with %q", prefix + " ---")
+}
+
+func frontMatterMarker(line string, prefixes []string) (string, bool) {
+    // returns the comment prefix of a "---" line
+    line = strings.TrimSpace(strings.TrimRight(line, "\r"))
+    for _, prefix := range prefixes {
+        if strings.HasPrefix(line, prefix) && strings.TrimSpace(strings.TrimPrefix(line, prefix)) == "---" {
+            return prefix, true
+        }
+    }
+    return "", false
+}
+
+func splitKeyValue(line string) (string, string, bool) {
+    i := strings.Index(line, ":")
+    if i < 0 {
+        return "", "", false
+    }
+
+    key := strings.TrimSpace(line[:i])
+    value := strings.TrimSpace(line[i+1:])
+    return key, value, key != ""
+}
+
+//------------------------------------------------------------------------------
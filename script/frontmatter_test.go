@@ -0,0 +1,222 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package script
+
+import (
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+    "testing/fstest"
+    "time"
+)
+
+//------------------------------------------------------------------------------
+
+const testFrontMatter = `#!/bin/bash
+# ---
+# shell: bash
+# description: restarts a service
+# timeout: 5m
+# params:
+#   Service: string, required
+#   Retries: int, default=3
+#   Hosts:   list, default=a, b
+#   Force:   bool
+#   Extra:
+# ---
+echo {{.Service}} {{.Retries}}
+`
+
+//------------------------------------------------------------------------------
+
+func TestParseFrontMatter(t *testing.T) {
+    fm, code, err := parseFrontMatter(testFrontMatter)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    want := &frontMatter{
+        Shell: "bash",
+        Description: "restarts a service",
+        Timeout: 5 * time.Minute,
+        Params: []Param{
+            { Name: "Service", Type: "string", Required: true },
+            { Name: "Retries", Type: "int", Default: 3 },
+            { Name: "Hosts", Type: "list", Default: []string{ "a", "b" } },
+            { Name: "Force", Type: "bool" },
+            { Name: "Extra" },
+        },
+    }
+    if !reflect.DeepEqual(fm, want) {
+        t.Errorf("front-matter = %#v, want %#v", fm, want)
+    }
+
+    // the line numbers of the code are kept
+    wantCode := "#!/bin/bash" + strings.Repeat("\n", 12) + "echo {{.Service}} {{.Retries}}\n"
+    if code != wantCode {
+        t.Errorf("code = %q, want %q", code, wantCode)
+    }
+}
+
+func TestParseFrontMatterPrefixes(t *testing.T) {
+    tests := []string{
+        ":: ---\n:: shell: cmd\n:: ---\necho",
+        "REM ---\nREM shell: cmd\nREM ---\necho",
+        "// ---\n// shell: cmd\n// ---\necho",
+        "  #---\r\n  #shell: cmd\r\n  #---\r\necho",
+    }
+
+    for _, test := range tests {
+        fm, _, err := parseFrontMatter(test)
+        if err != nil {
+            t.Errorf("%q: unexpected error: %v", test, err)
+            continue
+        }
+        if fm == nil || fm.Shell != "cmd" {
+            t.Errorf("%q: front-matter = %#v, want shell \"cmd\"", test, fm)
+        }
+    }
+}
+
+func TestParseFrontMatterNone(t *testing.T) {
+    tests := []string{
+        "",
+        "#!/bin/bash",
+        "echo ---",
+        "#!/bin/bash\n# a comment\n# ---\n",
+    }
+
+    for _, test := range tests {
+        fm, code, err := parseFrontMatter(test)
+        if err != nil || fm != nil || code != test {
+            t.Errorf("%q: front-matter = %#v, code = %q, error = %v", test, fm, code, err)
+        }
+    }
+}
+
+func TestParseFrontMatterErrors(t *testing.T) {
+    tests := []struct {
+        code string
+        want string
+    }{
+        { "# ---\n# shell: bash\n",                        "doesn't end with" },
+        { "# ---\nshell: bash\n# ---",                     "doesn't start with" },
+        { "# ---\n# shell\n# ---",                         "must be \"key: value\"" },
+        { "# ---\n# owner: me\n# ---",                     "unknown key" },
+        { "# ---\n# timeout: soon\n# ---",                 "invalid timeout" },
+        { "# ---\n# params: Path\n# ---",                  "indented lines" },
+        { "# ---\n# params:\n#   Path: file\n# ---",       "unknown type" },
+        { "# ---\n# params:\n#   Path: string, opt\n# ---", "unknown option" },
+        { "# ---\n# params:\n#   Port: int, default=x\n# ---", "invalid default" },
+    }
+
+    for _, test := range tests {
+        _, _, err := parseFrontMatter(test.code)
+        if err == nil || !strings.Contains(err.Error(), test.want) {
+            t.Errorf("%q: error %v does not contain %q", test.code, err, test.want)
+        }
+    }
+}
+
+func TestNewFromFileFrontMatter(t *testing.T) {
+    dir, err := ioutil.TempDir("", "script")
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    defer os.RemoveAll(dir)
+
+    file := filepath.Join(dir, "restart.sh")
+    err = ioutil.WriteFile(file, []byte(testFrontMatter), 0644)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    s, err := NewFromFile("restart", "", file)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if s.Shell != "bash" || s.Description != "restarts a service" || s.Timeout != 5 * time.Minute || len(s.Params) != 5 {
+        t.Errorf("script = %#v does not have the front-matter", s)
+    }
+
+    // the shell parameter takes precedence
+    s, err = NewFromFile("restart", "sh", file)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if s.Shell != "sh" {
+        t.Errorf("shell = %q, want %q", s.Shell, "sh")
+    }
+
+    got := render(t, s, map[string]string{ "Service": "nginx" })
+    if !strings.HasSuffix(got, "echo nginx 3\n") {
+        t.Errorf("rendered = %q does not end with %q", got, "echo nginx 3\n")
+    }
+}
+
+func TestNewFromFileShell(t *testing.T) {
+    dir, err := ioutil.TempDir("", "script")
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    defer os.RemoveAll(dir)
+
+    // without a shell parameter and front-matter, the shell is inferred from the extension
+    file := filepath.Join(dir, "deploy.ps1")
+    err = ioutil.WriteFile(file, []byte("Write-Output {{.Name}}"), 0644)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    s, err := NewFromFile("deploy", "", file)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if s.Shell != "powershell" {
+        t.Errorf("shell = %q, want %q", s.Shell, "powershell")
+    }
+
+    file = filepath.Join(dir, "deploy.txt")
+    err = ioutil.WriteFile(file, []byte("{{.Name}}"), 0644)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    _, err = NewFromFile("deploy", "", file)
+    if err == nil || !strings.Contains(err.Error(), "cannot infer shell") {
+        t.Errorf("error %v does not contain %q", err, "cannot infer shell")
+    }
+}
+
+func TestNewFromFSFrontMatter(t *testing.T) {
+    fsys := fstest.MapFS{
+        "restart.sh": { Data: []byte(testFrontMatter) },
+        "plain.sh":   { Data: []byte("# ---\n# timeout: 1s\n# ---\necho") },
+    }
+
+    s, err := NewFromFS(fsys, "restart.sh")
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if s.Shell != "bash" || s.Timeout != 5 * time.Minute {
+        t.Errorf("shell = %q, timeout = %s, want %q, %s", s.Shell, s.Timeout, "bash", 5 * time.Minute)
+    }
+
+    // the extension is used when the front-matter has no shell
+    s, err = NewFromFS(fsys, "plain.sh")
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if s.Shell != "sh" || s.Timeout != time.Second {
+        t.Errorf("shell = %q, timeout = %s, want %q, %s", s.Shell, s.Timeout, "sh", time.Second)
+    }
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,156 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package script
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "reflect"
+    "strings"
+    "text/template"
+)
+
+//------------------------------------------------------------------------------
+
+// functions available in every script, in addition to the functions of text/template
+// the argument that is typically piped comes last, for instance "{{.Paths | join ","}}"
+var builtinFuncs = template.FuncMap{
+    "shquote":  shquote,
+    "psquote":  psquote,
+    "cmdquote": cmdquote,
+    "json":     toJSON,
+    "toJson":   toJSON,
+    "base64":   toBase64,
+    "join":     join,
+    "default":  defaultValue,
+    "required": required,
+    "indent":   indent,
+    "lines":    lines,
+}
+
+//------------------------------------------------------------------------------
+
+func WithFuncs(funcs template.FuncMap) Option {
+    // adds functions to the script, or replaces builtin functions
+    return func(s *Script) {
+        if s.funcs == nil {
+            s.funcs = make(template.FuncMap)
+        }
+        for name, f := range funcs {
+            s.funcs[name] = f
+        }
+    }
+}
+
+//------------------------------------------------------------------------------
+
+func shquote(value interface{}) string {
+    // "it's" -> 'it'\''s', for bash, sh, ...
+    s, _ := stringValue(value)
+    return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func psquote(value interface{}) string {
+    // "it's" -> 'it''s', for powershell
+    s, _ := stringValue(value)
+    single, _ := escapePowerShellSingle(s)
+    return "'" + single + "'"
+}
+
+func cmdquote(value interface{}) (string, error) {
+    // `say "hi" 100%` -> "say ""hi"" 100%%", for cmd
+    s, _ := stringValue(value)
+    double, err := escapeCmdDouble(s)
+    if err != nil {
+        return "", err
+    }
+    return `"` + double + `"`, nil
+}
+
+func toJSON(value interface{}) (string, error) {
+    b, err := json.Marshal(value)
+    if err != nil {
+        return "", err
+    }
+    return string(b), nil
+}
+
+func toBase64(value interface{}) string {
+    if b, ok := value.([]byte); ok {
+        return base64.StdEncoding.EncodeToString(b)
+    }
+    s, _ := stringValue(value)
+    return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func join(sep string, list interface{}) (string, error) {
+    // joins the elements of a slice or array
+    v := reflect.ValueOf(list)
+    if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+        return "", fmt.Errorf("cannot join %T, must be a slice or an array", list)
+    }
+
+    elements := make([]string, v.Len())
+    for i := range elements {
+        elements[i], _ = stringValue(v.Index(i).Interface())
+    }
+    return strings.Join(elements, sep), nil
+}
+
+func defaultValue(def interface{}, value interface{}) interface{} {
+    // returns 'def' when 'value' is empty
+    if isEmpty(value) {
+        return def
+    }
+    return value
+}
+
+func required(message string, value interface{}) (interface{}, error) {
+    // fails rendering the script with 'message' when 'value' is empty
+    if isEmpty(value) {
+        return nil, fmt.Errorf("%s", message)
+    }
+    return value, nil
+}
+
+func indent(n int, value interface{}) string {
+    // indents every line with 'n' spaces
+    s, _ := stringValue(value)
+    prefix := strings.Repeat(" ", n)
+    return prefix + strings.Replace(s, "\n", "\n" + prefix, -1)
+}
+
+func lines(value interface{}) []string {
+    // splits into lines, without the line endings
+    s, _ := stringValue(value)
+    s = strings.TrimSuffix(strings.Replace(s, "\r\n", "\n", -1), "\n")
+    if s == "" {
+        return []string{}
+    }
+    return strings.Split(s, "\n")
+}
+
+//------------------------------------------------------------------------------
+
+func isEmpty(value interface{}) bool {
+    // nil, zero values, and empty slices, maps and strings are empty
+    v := reflect.ValueOf(value)
+    if !v.IsValid() {
+        return true
+    }
+
+    switch v.Kind() {
+    case reflect.Array, reflect.Slice, reflect.Map, reflect.String:
+        return v.Len() == 0
+    case reflect.Ptr, reflect.Interface:
+        return v.IsNil()
+    }
+    return reflect.DeepEqual(value, reflect.Zero(v.Type()).Interface())
+}
+
+//------------------------------------------------------------------------------
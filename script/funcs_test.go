@@ -0,0 +1,131 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package script
+
+import (
+    "os/exec"
+    "strings"
+    "testing"
+    "text/template"
+)
+
+//------------------------------------------------------------------------------
+
+func TestFuncs(t *testing.T) {
+    arguments := map[string]interface{}{
+        "Value": "it's 100%",
+        "Empty": "",
+        "Zero":  0,
+        "List":  []string{ "a", "b", "c" },
+        "Ports": []int{ 22, 80 },
+        "Map":   map[string]int{ "b": 2, "a": 1 },
+        "Text":  "first\r\nsecond\n",
+    }
+
+    tests := []struct {
+        code string
+        want string
+    }{
+        { `{{shquote .Value}}`,                  `'it'\''s 100%'` },
+        { `{{psquote .Value}}`,                  `'it''s 100%'` },
+        { `{{cmdquote .Value}}`,                 `"it's 100%%"` },
+        { `{{json .Map}}`,                       `{"a":1,"b":2}` },
+        { `{{toJson .List}}`,                    `["a","b","c"]` },
+        { `{{base64 .Value}}`,                   `aXQncyAxMDAl` },
+        { `{{.List | join ","}}`,                `a,b,c` },
+        { `{{.Ports | join " "}}`,               `22 80` },
+        { `{{.Empty | default "none"}}`,         `none` },
+        { `{{.Zero | default 8080}}`,            `8080` },
+        { `{{.Missing | default "none"}}`,       `none` },
+        { `{{.Value | default "none"}}`,         `it's 100%` },
+        { `{{required "value is required" .Value}}`, `it's 100%` },
+        { `{{.Text | indent 2}}`,                "  first\r\n  second\n  " },
+        { `{{range lines .Text}}[{{.}}]{{end}}`, `[first][second]` },
+        { `{{range lines .Empty}}[{{.}}]{{end}}`, `` },
+    }
+
+    for _, test := range tests {
+        got := render(t, New("test", "bash", test.code), arguments)
+        if got != test.want {
+            t.Errorf("%s = %q, want %q", test.code, got, test.want)
+        }
+    }
+}
+
+func TestFuncsErrors(t *testing.T) {
+    tests := []struct {
+        code string
+        want string
+    }{
+        { `{{required "value is required" .Empty}}`, "value is required" },
+        { `{{.Value | join ","}}`,                   "cannot join string" },
+        { `{{cmdquote "a\nb"}}`,                     "newline" },
+        { `{{json .Func}}`,                          "unsupported type" },
+    }
+
+    arguments := map[string]interface{}{ "Value": "abc", "Empty": "", "Func": func() {} }
+    for _, test := range tests {
+        s := New("test", "bash", test.code)
+        if s.Error != nil {
+            t.Fatalf("unexpected error: %v", s.Error)
+        }
+
+        _, err := s.NewReader(arguments)
+        if err == nil || !strings.Contains(err.Error(), test.want) {
+            t.Errorf("%s: error %v does not contain %q", test.code, err, test.want)
+        }
+    }
+}
+
+func TestFuncsShquote(t *testing.T) {
+    if _, err := exec.LookPath("bash"); err != nil {
+        t.Skip("bash not found")
+    }
+
+    s := New("test", "bash", `printf '[%s]' {{shquote .Value}} {{range .List}}{{shquote .}}{{end}}`)
+    code := render(t, s, map[string]interface{}{ "Value": testValue, "List": []string{ testValue } })
+    output, err := exec.Command("bash", "-c", code).Output()
+    if err != nil {
+        t.Fatalf("cannot run %q: %v", code, err)
+    }
+
+    want := "[" + testValue + "][" + testValue + "]"
+    if string(output) != want {
+        t.Errorf("output = %q, want %q\ncode: %s", output, want, code)
+    }
+}
+
+func TestFuncsAutoescape(t *testing.T) {
+    // quotes are not escaped again, other functions are
+    s := New("test", "bash", `echo {{shquote .Value}} {{.List | join " "}}`, WithAutoescape())
+
+    got := render(t, s, map[string]interface{}{ "Value": "it's", "List": []string{ "a", "b" } })
+    want := `echo 'it'\''s' 'a b'`
+    if got != want {
+        t.Errorf("rendered = %q, want %q", got, want)
+    }
+}
+
+func TestWithFuncs(t *testing.T) {
+    s := New("test", "bash", `{{upper .Value}} {{default .Value}}`, WithFuncs(template.FuncMap{
+        "upper":   strings.ToUpper,
+        "default": func(string) string { return "replaced" },
+    }))
+
+    got := render(t, s, map[string]string{ "Value": "abc" })
+    if got != "ABC replaced" {
+        t.Errorf("rendered = %q, want %q", got, "ABC replaced")
+    }
+
+    // functions are registered per script
+    other := New("test", "bash", `{{upper .Value}}`)
+    if other.Error == nil || !strings.Contains(other.Error.Error(), `function "upper" not defined`) {
+        t.Errorf("error %v is not an undefined function error", other.Error)
+    }
+}
+
+//------------------------------------------------------------------------------
@@ -0,0 +1,330 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package script
+
+import (
+    "fmt"
+    "reflect"
+    "strconv"
+    "strings"
+    "time"
+)
+
+//------------------------------------------------------------------------------
+
+// a parameter declared in the front-matter of a script, as "Name: type, required, default=value"
+// the default must be the last option, and can contain commas
+type Param struct {
+    Name     string
+    Type     string        // "string", "int", "float", "bool", "duration", "list", or "" for any type
+    Required bool          // rendering fails when the argument is missing
+    Default  interface{}   // used when the argument is missing, nil when no default
+}
+
+//------------------------------------------------------------------------------
+
+func parseParam(name string, spec string) (*Param, error) {
+    p := &Param{ Name: name }
+
+    options := strings.Split(spec, ",")
+    p.Type = strings.ToLower(strings.TrimSpace(options[0]))
+    switch p.Type {
+    case "", "any":
+        p.Type = ""
+    case "string", "int", "float", "bool", "duration", "list":
+    default:
+        return nil, fmt.Errorf("unknown type %q for param %q", p.Type, name)
+    }
+
+    for i := 1; i < len(options); i++ {
+        option := strings.TrimSpace(options[i])
+        switch {
+        case option == "required":
+            p.Required = true
+        case strings.HasPrefix(option, "default="):
+            value := strings.TrimPrefix(strings.TrimLeft(strings.Join(options[i:], ","), " \t"), "default=")
+            def, err := convertParam(p, value)
+            if err != nil {
+                return nil, fmt.Errorf("invalid default for param %q: %w", name, err)
+            }
+            p.Default = def
+            i = len(options)
+        default:
+            return nil, fmt.Errorf("unknown option %q for param %q", option, name)
+        }
+    }
+
+    return p, nil
+}
+
+func convertParam(p *Param, value interface{}) (interface{}, error) {
+    // returns the value converted to the type of the param
+    // strings are parsed, so arguments can come from the command line or from environment variables
+    v := reflect.ValueOf(value)
+    s, isString := value.(string)
+
+    switch p.Type {
+    case "string":
+        if v.Kind() == reflect.String {
+            return v.String(), nil
+        }
+    case "int":
+        switch v.Kind() {
+        case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+            if _, ok := value.(time.Duration); !ok {
+                return int(v.Int()), nil
+            }
+        case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+            return int(v.Uint()), nil
+        case reflect.Float32, reflect.Float64:
+            // numbers decoded from JSON
+            if f := v.Float(); f == float64(int(f)) {
+                return int(f), nil
+            }
+        }
+        if isString {
+            i, err := strconv.Atoi(strings.TrimSpace(s))
+            if err == nil {
+                return i, nil
+            }
+        }
+    case "float":
+        switch v.Kind() {
+        case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+            return float64(v.Int()), nil
+        case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+            return float64(v.Uint()), nil
+        case reflect.Float32, reflect.Float64:
+            return v.Float(), nil
+        }
+        if isString {
+            f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+            if err == nil {
+                return f, nil
+            }
+        }
+    case "bool":
+        if v.Kind() == reflect.Bool {
+            return v.Bool(), nil
+        }
+        if isString {
+            b, err := strconv.ParseBool(strings.TrimSpace(s))
+            if err == nil {
+                return b, nil
+            }
+        }
+    case "duration":
+        if d, ok := value.(time.Duration); ok {
+            return d, nil
+        }
+        if isString {
+            d, err := time.ParseDuration(strings.TrimSpace(s))
+            if err == nil {
+                return d, nil
+            }
+        }
+    case "list":
+        if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+            return value, nil
+        }
+        if isString {
+            if strings.TrimSpace(s) == "" {
+                return []string{}, nil
+            }
+            list := strings.Split(s, ",")
+            for i := range list {
+                list[i] = strings.TrimSpace(list[i])
+            }
+            return list, nil
+        }
+    default:
+        return value, nil
+    }
+
+    return nil, fmt.Errorf("cannot use %#v as %s", value, p.Type)
+}
+
+//------------------------------------------------------------------------------
+
+func (s *Script) validateArguments(arguments interface{}) (interface{}, error) {
+    // checks the arguments against the params declared in the front-matter, and applies the defaults
+    // the arguments are copied, the caller's arguments are not changed
+    if len(s.Params) == 0 {
+        return arguments, nil
+    }
+
+    v := reflect.ValueOf(arguments)
+    for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+        if v.IsNil() {
+            v = reflect.Value{}
+            break
+        }
+        v = v.Elem()
+    }
+
+    switch {
+    case !v.IsValid():
+        return s.validateMap(reflect.ValueOf(map[string]interface{}{}))
+    case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+        return s.validateMap(v)
+    case v.Kind() == reflect.Struct:
+        return s.validateStruct(v)
+    }
+
+    return nil, fmt.Errorf("arguments must be a struct or a map with string keys, not %T", arguments)
+}
+
+func (s *Script) validateMap(v reflect.Value) (interface{}, error) {
+    // copies to a map[string]interface{}, with the converted values of the params
+    m := make(map[string]interface{}, v.Len())
+    iter := v.MapRange()
+    for iter.Next() {
+        m[iter.Key().String()] = iter.Value().Interface()
+    }
+
+    for i := range s.Params {
+        p := &s.Params[i]
+        // a map value is missing when it isn't in the map, or when it is nil
+        // an explicit zero value, like 0, false or "", is used as it is
+        value, err := validateParam(p, m[p.Name], m[p.Name] == nil)
+        if err != nil {
+            return nil, err
+        }
+        if value != nil {
+            m[p.Name] = value
+        }
+    }
+
+    return m, nil
+}
+
+func (s *Script) validateStruct(v reflect.Value) (interface{}, error) {
+    // copies the struct, and sets the defaults of missing fields
+    // fields keep their type, values are only converted for the defaults
+    //
+    // a field is missing when it is a nil pointer or interface
+    // a non-pointer field cannot express "unset", so its zero value, like 0, false or "", is used as it is,
+    // except for a required param, where the zero value is missing
+    copied := reflect.New(v.Type()).Elem()
+    copied.Set(v)
+
+    for i := range s.Params {
+        p := &s.Params[i]
+        field := copied.FieldByName(p.Name)
+        if !field.IsValid() || !field.CanInterface() {
+            if p.Required || p.Default != nil {
+                return nil, fmt.Errorf("missing param %q, %s has no exported field %q", p.Name, v.Type(), p.Name)
+            }
+            continue
+        }
+
+        var argument interface{}
+        missing := false
+        switch field.Kind() {
+        case reflect.Ptr, reflect.Interface:
+            missing = field.IsNil()
+            if !missing {
+                argument = field.Elem().Interface()
+            }
+        default:
+            argument = field.Interface()
+            missing = p.Required && field.IsZero()
+        }
+
+        value, err := validateParam(p, argument, missing)
+        if err != nil {
+            return nil, err
+        }
+        if missing && value != nil {
+            t := field.Type()
+            if field.Kind() == reflect.Ptr {
+                t = t.Elem()
+            }
+
+            d, ok := convertDefault(value, t)
+            if !ok {
+                return nil, fmt.Errorf("cannot use default %#v of param %q for field of type %s", value, p.Name, field.Type())
+            }
+            if field.Kind() == reflect.Ptr {
+                ptr := reflect.New(t)
+                ptr.Elem().Set(d)
+                field.Set(ptr)
+            } else {
+                field.Set(d)
+            }
+        }
+    }
+
+    return copied.Interface(), nil
+}
+
+func convertDefault(value interface{}, t reflect.Type) (reflect.Value, bool) {
+    // converts a default to the type of a field
+    // only between types of the same kind, golang's conversions from a number to a string or to a number that overflows are rejected
+    d := reflect.ValueOf(value)
+    if d.Type().AssignableTo(t) {
+        return d, true
+    }
+
+    switch {
+    case isSignedKind(d.Kind()) && (isSignedKind(t.Kind()) || isUnsignedKind(t.Kind())):
+        // integer defaults are signed, see convertParam()
+        zero, n := reflect.Zero(t), d.Int()
+        if (isSignedKind(t.Kind()) && zero.OverflowInt(n)) || (isUnsignedKind(t.Kind()) && (n < 0 || zero.OverflowUint(uint64(n)))) {
+            return reflect.Value{}, false
+        }
+        return d.Convert(t), true
+    case isFloatKind(d.Kind()) && isFloatKind(t.Kind()),
+         d.Kind() == reflect.String && t.Kind() == reflect.String,
+         d.Kind() == reflect.Bool && t.Kind() == reflect.Bool,
+         d.Kind() == reflect.Slice && t.Kind() == reflect.Slice && d.Type().ConvertibleTo(t):
+        return d.Convert(t), true
+    }
+
+    return reflect.Value{}, false
+}
+
+func isSignedKind(k reflect.Kind) bool {
+    switch k {
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        return true
+    }
+    return false
+}
+
+func isUnsignedKind(k reflect.Kind) bool {
+    switch k {
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+        return true
+    }
+    return false
+}
+
+func isFloatKind(k reflect.Kind) bool {
+    return k == reflect.Float32 || k == reflect.Float64
+}
+
+func validateParam(p *Param, value interface{}, missing bool) (interface{}, error) {
+    // returns the converted value, the default for a missing value, or nil for a missing value without default
+    if missing {
+        if p.Default != nil {
+            return p.Default, nil
+        }
+        if p.Required {
+            return nil, fmt.Errorf("missing required param %q", p.Name)
+        }
+        return nil, nil
+    }
+
+    converted, err := convertParam(p, value)
+    if err != nil {
+        return nil, fmt.Errorf("invalid param %q: %w", p.Name, err)
+    }
+    return converted, nil
+}
+
+//------------------------------------------------------------------------------
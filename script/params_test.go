@@ -0,0 +1,218 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package script
+
+import (
+    "strings"
+    "testing"
+    "testing/fstest"
+    "time"
+)
+
+//------------------------------------------------------------------------------
+
+var testParamsFS = fstest.MapFS{
+    "params.sh": { Data: []byte(`# ---
+# params:
+#   Service: string, required
+#   Retries: int, default=3
+#   Delay:   duration, default=1s
+#   Force:   bool, default=true
+#   Hosts:   list
+# ---
+{{.Service}} {{.Retries}} {{.Delay}} {{.Force}} {{range .Hosts}}[{{.}}]{{end}}`) },
+}
+
+func newParamsScript(t *testing.T) *Script {
+    t.Helper()
+
+    s, err := NewFromFS(testParamsFS, "params.sh")
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    return s
+}
+
+type paramsArguments struct {
+    Service string
+    Retries int
+    Delay   time.Duration
+    Force   bool
+    Hosts   []string
+}
+
+type paramsPointerArguments struct {
+    Service *string
+    Retries *int
+    Delay   *time.Duration
+    Force   *bool
+    Hosts   []string
+}
+
+func intPointer(i int) *int {
+    return &i
+}
+
+//------------------------------------------------------------------------------
+
+func TestParamsMap(t *testing.T) {
+    s := newParamsScript(t)
+
+    tests := []struct {
+        arguments interface{}
+        want      string
+    }{
+        { map[string]string{ "Service": "nginx" },                                           "nginx 3 1s true " },
+        { map[string]string{ "Service": "nginx", "Retries": "5", "Force": "false", "Hosts": "a, b" }, "nginx 5 1s false [a][b]" },
+        { map[string]interface{}{ "Service": "nginx", "Retries": 5.0, "Delay": 2 * time.Second }, "nginx 5 2s true " },
+        { &map[string]interface{}{ "Service": "nginx", "Retries": 0, "Force": false },       "nginx 0 1s false " },
+        { map[string]interface{}{ "Service": "", "Retries": nil, "Delay": "0s" },            " 3 0s true " },
+    }
+
+    for _, test := range tests {
+        got := strings.TrimLeft(render(t, s, test.arguments), "\n")
+        if got != test.want {
+            t.Errorf("%v: rendered = %q, want %q", test.arguments, got, test.want)
+        }
+    }
+}
+
+func TestParamsStruct(t *testing.T) {
+    s := newParamsScript(t)
+
+    arguments := paramsArguments{ Service: "nginx", Hosts: []string{ "a" } }
+    got := strings.TrimLeft(render(t, s, arguments), "\n")
+    // non-pointer fields are never missing, their zero values are used as they are
+    if want := "nginx 0 0s false [a]"; got != want {
+        t.Errorf("rendered = %q, want %q", got, want)
+    }
+
+    // the caller's arguments are not changed
+    if arguments.Retries != 0 {
+        t.Errorf("arguments were changed: %#v", arguments)
+    }
+
+    got = strings.TrimLeft(render(t, s, &paramsArguments{ Service: "nginx", Retries: 1, Delay: time.Minute }), "\n")
+    if want := "nginx 1 1m0s false "; got != want {
+        t.Errorf("rendered = %q, want %q", got, want)
+    }
+}
+
+func TestParamsStructZero(t *testing.T) {
+    // a non-pointer field cannot be unset, so an explicit zero value doesn't get the default
+    s, err := NewFromFS(fstest.MapFS{
+        "zero.sh": { Data: []byte("# ---\n# params:\n#   Retries: int, default=5\n# ---\n{{.Retries}}") },
+    }, "zero.sh")
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    if got := strings.TrimLeft(render(t, s, struct{ Retries int }{ Retries: 0 }), "\n"); got != "0" {
+        t.Errorf("rendered = %q, want %q", got, "0")
+    }
+    if got := strings.TrimLeft(render(t, s, struct{ Retries *int }{ Retries: intPointer(0) }), "\n"); got != "0" {
+        t.Errorf("rendered = %q, want %q", got, "0")
+    }
+    if got := strings.TrimLeft(render(t, s, struct{ Retries *int }{}), "\n"); got != "5" {
+        t.Errorf("rendered = %q, want %q", got, "5")
+    }
+}
+
+func TestParamsStructDefaults(t *testing.T) {
+    s, err := NewFromFS(fstest.MapFS{
+        "port.sh": { Data: []byte("# ---\n# params:\n#   Port: int, default=22\n# ---\n{{.Port}}") },
+    }, "port.sh")
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    type port uint16
+    if got := strings.TrimLeft(render(t, s, struct{ Port *port }{}), "\n"); got != "22" {
+        t.Errorf("rendered = %q, want %q", got, "22")
+    }
+    if got := strings.TrimLeft(render(t, s, struct{ Port *int64 }{}), "\n"); got != "22" {
+        t.Errorf("rendered = %q, want %q", got, "22")
+    }
+
+    // an int is not converted to a rune, and doesn't overflow
+    tests := []interface{}{
+        struct{ Port *string }{},
+        struct{ Port *int8 }{},
+        struct{ Port *bool }{},
+        struct{ Port *float64 }{},
+    }
+    s, err = NewFromFS(fstest.MapFS{
+        "port.sh": { Data: []byte("# ---\n# params:\n#   Port: int, default=300\n# ---\n{{.Port}}") },
+    }, "port.sh")
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    for _, arguments := range tests {
+        _, err := s.NewReader(arguments)
+        if err == nil || !strings.Contains(err.Error(), "cannot use default 300 of param \"Port\"") {
+            t.Errorf("%#v: error %v is not a default error", arguments, err)
+        }
+    }
+
+    s, err = NewFromFS(fstest.MapFS{
+        "port.sh": { Data: []byte("# ---\n# params:\n#   Port: int, required, default=-1\n# ---\n{{.Port}}") },
+    }, "port.sh")
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    _, err = s.NewReader(struct{ Port uint }{})
+    if err == nil || !strings.Contains(err.Error(), "cannot use default -1 of param \"Port\"") {
+        t.Errorf("error %v is not a default error", err)
+    }
+}
+
+func TestParamsStructPointers(t *testing.T) {
+    s := newParamsScript(t)
+
+    service := "nginx"
+    force := false
+    arguments := paramsPointerArguments{ Service: &service, Force: &force }
+    got := strings.TrimLeft(render(t, s, arguments), "\n")
+    if want := "nginx 3 1s false "; got != want {
+        t.Errorf("rendered = %q, want %q", got, want)
+    }
+
+    // the caller's arguments are not changed
+    if arguments.Retries != nil || arguments.Delay != nil {
+        t.Errorf("arguments were changed: %#v", arguments)
+    }
+}
+
+func TestParamsErrors(t *testing.T) {
+    s := newParamsScript(t)
+
+    tests := []struct {
+        arguments interface{}
+        want      string
+    }{
+        { nil,                                                     "missing required param \"Service\"" },
+        { map[string]interface{}{ "Service": nil },                "missing required param \"Service\"" },
+        { map[string]interface{}{ "Service": 1 },                  "invalid param \"Service\"" },
+        { map[string]string{ "Service": "nginx", "Retries": "x" }, "invalid param \"Retries\"" },
+        { map[string]string{ "Service": "nginx", "Delay": "5" },   "invalid param \"Delay\"" },
+        { map[string]interface{}{ "Service": "nginx", "Retries": 1.5 }, "invalid param \"Retries\"" },
+        { paramsPointerArguments{},                                "missing required param \"Service\"" },
+        { paramsArguments{},                                       "missing required param \"Service\"" },
+        { &paramsArguments{ Retries: 1 },                          "missing required param \"Service\"" },
+        { struct{ Other string }{},                                "has no exported field \"Service\"" },
+        { "nginx",                                                 "must be a struct or a map" },
+    }
+
+    for _, test := range tests {
+        _, err := s.NewReader(test.arguments)
+        if err == nil || !strings.Contains(err.Error(), test.want) {
+            t.Errorf("%#v: error %v does not contain %q", test.arguments, err, test.want)
+        }
+    }
+}
+
+//------------------------------------------------------------------------------
@@ -10,8 +10,12 @@ import (
     "bytes"
     "fmt"
     "io"
+    "io/fs"
+    "io/ioutil"
     "os"
     "math/rand"
+    "path"
+    "reflect"
     "strings"
     "text/template"
     "time"
@@ -20,64 +24,292 @@ import (
 //------------------------------------------------------------------------------
 
 type Script struct {
-    Name       string
-    Shell      string   // "cmd", powershell", "bash", "sh", ...
+    Name        string
+    Shell       string          // "cmd", powershell", "bash", "sh", ...
+    Description string          // from the front-matter
+    Timeout     time.Duration   // from the front-matter, used by the runners unless overridden, 0 when no timeout
+    Params      []Param         // from the front-matter, the arguments are validated against the params before rendering
 
-    template   *template.Template
+    template     *template.Template
+    autoescape   bool
+    missingkey   bool
+    envArguments bool
+    argumentType reflect.Type
+    funcs        template.FuncMap
+    partials     []string
 
-    Error      error    // error from New()
+    Error       error           // error from New()
+}
+
+// options for New(), NewFromString(), NewFromFile() and NewFromFS(), applied before parsing the script
+type Option func(*Script)
+
+//------------------------------------------------------------------------------
+
+func WithAutoescape() Option {
+    // escapes the values of actions like "{{.Path}}" for the quoting context they are in, according to the 'Shell'
+    // use script.Raw for values that must not be escaped
+    return func(s *Script) {
+        s.autoescape = true
+    }
+}
+
+func WithShell(shell string) Option {
+    // sets the shell of the script, instead of the 'shell' parameter, the front-matter or the extension of the file
+    return func(s *Script) {
+        s.Shell = strings.ToLower(shell)
+    }
+}
+
+func WithPartials(patterns ...string) Option {
+    // adds the files matching the patterns as partials, for instance "{{template "common/retry.sh" .}}", using the path of the file
+    // only for NewFromFS(), the other functions fail with this option
+    return func(s *Script) {
+        s.partials = append(s.partials, patterns...)
+    }
+}
+
+func WithMissingKeyError() Option {
+    // fails rendering the script when a key is missing in a map, instead of rendering "<no value>"
+    return func(s *Script) {
+        s.missingkey = true
+    }
 }
 
 //------------------------------------------------------------------------------
 
-func New(name string, shell string, code string) *Script {
+func New(name string, shell string, code string, options ...Option) *Script {
     // remark that New() doesn't return any errors directly
     // instead, error are saved in the 'Error'-field of the returned script
     // this allows using New() in a package scope, while checking for errors in a function scope
-    template, err := template.New(name).Parse(code)
+    s := newScript(name, shell, options)
+    err := s.parse(func(t *template.Template) (*template.Template, error) {
+        return t.Parse(code)
+    })
     if err != nil {
-        err = fmt.Errorf("[golang-exec/script/New()] cannot parse script: %#w\n", err)
+        s.Shell = ""
+        s.Error = fmt.Errorf("[golang-exec/script/New()] cannot parse script: %w\n", err)
     }
 
-    s := new(Script)
-    s.Name = name
+    return s
+}
 
-    if err == nil {
-        s.Shell = strings.ToLower(shell)
-        s.template = template
-    } else {
-        s.Error = err
+func NewFromString(name string, shell string, code string, options ...Option) (*Script, error) {
+    s := newScript(name, shell, options)
+    err := s.parse(func(t *template.Template) (*template.Template, error) {
+        return t.Parse(code)
+    })
+    if err != nil {
+        return nil, fmt.Errorf("[golang-exec/script/NewFromString()] cannot parse script: %w\n", err)
     }
 
-    return s
+    return s, nil
 }
 
-func NewFromString(name string, shell string, code string) (*Script, error) {
-    template, err := template.New(name).Parse(code)
+func NewFromFile(name string, shell string, file string, options ...Option) (*Script, error) {
+    // when 'shell' is "", the shell is taken from the front-matter of the file, or inferred from the extension of the file
+    b, err := ioutil.ReadFile(file)
     if err != nil {
-        return nil, fmt.Errorf("[golang-exec/script/NewFromString()] cannot parse script: %#w\n", err)
+        return nil, fmt.Errorf("[golang-exec/script/NewFromFile()] cannot read script: %w\n", err)
     }
 
-    s := new(Script)
-    s.Name = name
-    s.Shell = strings.ToLower(shell)
-    s.template = template
+    fm, code, err := parseFrontMatter(string(b))
+    if err != nil {
+        return nil, fmt.Errorf("[golang-exec/script/NewFromFile()] cannot parse front-matter: %w\n", err)
+    }
+
+    s := newScript(name, shell, options)
+    s.applyFrontMatter(fm)
+    if s.Shell == "" {
+        s.Shell = shellFromExtension(file)
+        if s.Shell == "" {
+            return nil, fmt.Errorf("[golang-exec/script/NewFromFile()] cannot infer shell from extension of %q\n", file)
+        }
+    }
+
+    err = s.parse(func(t *template.Template) (*template.Template, error) {
+        return t.Parse(code)
+    })
+    if err != nil {
+        return nil, fmt.Errorf("[golang-exec/script/NewFromFile()] cannot parse script: %w\n", err)
+    }
 
     return s, nil
 }
 
-func NewFromFile(name string, shell string, file string) (*Script, error) {
-    template, err := template.New(name).ParseFiles(file)
+func NewFromFS(fsys fs.FS, pattern string, options ...Option) (*Script, error) {
+    // the first file matching 'pattern' is the script, the other files matching 'pattern' or WithPartials() can be used as
+    // partials, for instance "{{template "common/retry.sh" .}}", using the path of the file in 'fsys'
+    // the shell is taken from the front-matter of the script, or inferred from the extension of the script, unless using WithShell()
+    s := newScript("", "", options)
+    patterns := append([]string{ pattern }, s.partials...)
+    s.partials = nil
+
+    files, err := globFS(fsys, patterns)
+    if err != nil {
+        return nil, fmt.Errorf("[golang-exec/script/NewFromFS()] cannot find script: %w\n", err)
+    }
+
+    b, err := fs.ReadFile(fsys, files[0])
+    if err != nil {
+        return nil, fmt.Errorf("[golang-exec/script/NewFromFS()] cannot read script: %w\n", err)
+    }
+
+    fm, code, err := parseFrontMatter(string(b))
     if err != nil {
-        return nil, fmt.Errorf("[golang-exec/script/NewFromFile()] cannot parse script: %#w\n", err)
+        return nil, fmt.Errorf("[golang-exec/script/NewFromFS()] cannot parse front-matter: %w\n", err)
     }
 
+    s.Name = files[0]
+    s.applyFrontMatter(fm)
+    if s.Shell == "" {
+        s.Shell = shellFromExtension(files[0])
+        if s.Shell == "" {
+            return nil, fmt.Errorf("[golang-exec/script/NewFromFS()] cannot infer shell from extension of %q\n", files[0])
+        }
+    }
+
+    err = s.parse(func(t *template.Template) (*template.Template, error) {
+        _, err := t.Parse(code)
+        if err != nil {
+            return nil, err
+        }
+
+        for _, file := range files[1:] {
+            b, err := fs.ReadFile(fsys, file)
+            if err != nil {
+                return nil, err
+            }
+
+            // the front-matter of a partial is removed, its shell, description, timeout and params are ignored
+            // only the front-matter of the script applies
+            code, err := stripFrontMatter(string(b))
+            if err != nil {
+                return nil, fmt.Errorf("cannot parse front-matter of %q: %w", file, err)
+            }
+
+            _, err = t.New(file).Parse(code)
+            if err != nil {
+                return nil, err
+            }
+        }
+        return t, nil
+    })
+    if err != nil {
+        return nil, fmt.Errorf("[golang-exec/script/NewFromFS()] cannot parse script: %w\n", err)
+    }
+
+    return s, nil
+}
+
+func newScript(name string, shell string, options []Option) *Script {
     s := new(Script)
     s.Name = name
     s.Shell = strings.ToLower(shell)
-    s.template = template
+    for _, option := range options {
+        option(s)
+    }
 
-    return s, nil
+    return s
+}
+
+func (s *Script) applyFrontMatter(fm *frontMatter) {
+    if fm == nil {
+        return
+    }
+
+    if s.Shell == "" {
+        s.Shell = fm.Shell
+    }
+    s.Description = fm.Description
+    s.Timeout = fm.Timeout
+    s.Params = fm.Params
+}
+
+func (s *Script) parse(parse func(*template.Template) (*template.Template, error)) error {
+    if len(s.partials) > 0 {
+        return fmt.Errorf("WithPartials() can only be used with NewFromFS()")
+    }
+
+    t := template.New(s.Name).Funcs(escapeFuncs).Funcs(builtinFuncs).Funcs(s.funcs)
+    if s.missingkey {
+        t.Option("missingkey=error")
+    }
+
+    t, err := parse(t)
+    if err != nil {
+        return err
+    }
+
+    if s.argumentType != nil {
+        err = checkTemplate(t, s.argumentType)
+        if err != nil {
+            return err
+        }
+    }
+
+    if s.autoescape {
+        err = escapeTemplate(t, s.Shell)
+        if err != nil {
+            return err
+        }
+    }
+
+    s.template = t
+    return nil
+}
+
+func globFS(fsys fs.FS, patterns []string) ([]string, error) {
+    // returns the files matching the patterns, in the order of the patterns, without duplicates
+    var files []string
+    found := make(map[string]bool)
+    for _, pattern := range patterns {
+        matches, err := fs.Glob(fsys, pattern)
+        if err != nil {
+            return nil, err
+        }
+        if len(matches) == 0 {
+            return nil, fmt.Errorf("pattern matches no files: %q", pattern)
+        }
+
+        for _, match := range matches {
+            if !found[match] {
+                found[match] = true
+                files = append(files, match)
+            }
+        }
+    }
+    if len(files) == 0 {
+        return nil, fmt.Errorf("no patterns")
+    }
+
+    return files, nil
+}
+
+func shellFromExtension(file string) string {
+    switch strings.ToLower(path.Ext(file)) {
+    case ".sh":
+        return "sh"
+    case ".bash":
+        return "bash"
+    case ".ps1":
+        return "powershell"
+    case ".cmd", ".bat":
+        return "cmd"
+    }
+    return ""
+}
+
+func (s *Script) checkArguments(arguments interface{}) (interface{}, error) {
+    // checks the type of the arguments, and validates them against the params
+    if s.argumentType != nil {
+        err := checkArgumentType(arguments, s.argumentType)
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    return s.validateArguments(arguments)
 }
 
 //------------------------------------------------------------------------------
@@ -119,15 +351,34 @@ func (s *Script) Command() string {
 
 func (s *Script) NewReader(arguments interface{}) (io.Reader, error) {
     // returns a reader for the parsed & rendered script
+    code, err := s.Render(arguments)
+    if err != nil {
+        return nil, fmt.Errorf("[golang-exec/script/NewReader()] cannot render script: %w\n", err)
+    }
+
+    return strings.NewReader(code), nil
+}
+
+func (s *Script) Render(arguments interface{}) (string, error) {
+    // returns the rendered script, as it is sent to the shell
+    if s.Error != nil {
+        return "", fmt.Errorf("[golang-exec/script/Render()] script failed to parse: %w\n", s.Error)
+    }
+
+    arguments, err := s.checkArguments(arguments)
+    if err != nil {
+        return "", fmt.Errorf("[golang-exec/script/Render()] invalid arguments: %w\n", err)
+    }
+
     var rendered bytes.Buffer
     if s.template != nil {
         err := s.template.Execute(&rendered, arguments)
         if err != nil {
-            return nil, fmt.Errorf("[golang-exec/script/NewReader()] cannot render script: %#w\n", err)
+            return "", fmt.Errorf("[golang-exec/script/Render()] cannot render script: %w\n", err)
         }
     }
 
-    return &rendered, nil
+    return rendered.String(), nil
 }
 
 //------------------------------------------------------------------------------
@@ -0,0 +1,164 @@
+//
+// Copyright (c) 2019 Stefaan Coussement
+// MIT License
+//
+// more info: https://github.com/stefaanc/golang-exec
+//
+package script
+
+import (
+    "strings"
+    "testing"
+    "testing/fstest"
+    "time"
+)
+
+//------------------------------------------------------------------------------
+
+var testFS = fstest.MapFS{
+    "deploy.sh":         { Data: []byte(`{{template "common/retry.sh" .}} deploy {{.Name}}`) },
+    "deploy.ps1":        { Data: []byte(`Write-Output {{.Name}}`) },
+    "deploy.BAT":        { Data: []byte(`echo {{.Name}}`) },
+    "deploy.txt":        { Data: []byte(`{{.Name}}`) },
+    "broken.sh":         { Data: []byte(`{{.Name`) },
+    "common/retry.sh":   { Data: []byte(`retry {{template "common/backoff.sh"}}`) },
+    "common/backoff.sh": { Data: []byte(`--backoff 5`) },
+}
+
+//------------------------------------------------------------------------------
+
+func TestNewFromFS(t *testing.T) {
+    s, err := NewFromFS(testFS, "deploy.sh", WithPartials("common/*.sh"))
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    if s.Name != "deploy.sh" || s.Shell != "sh" {
+        t.Errorf("name = %q, shell = %q, want %q, %q", s.Name, s.Shell, "deploy.sh", "sh")
+    }
+
+    got := render(t, s, map[string]string{ "Name": "app" })
+    want := "retry --backoff 5 deploy app"
+    if got != want {
+        t.Errorf("rendered = %q, want %q", got, want)
+    }
+}
+
+func TestNewFromFSShell(t *testing.T) {
+    tests := []struct {
+        shell string
+        file  string
+        want  string
+    }{
+        { "",     "deploy.sh",  "sh" },
+        { "",     "deploy.ps1", "powershell" },
+        { "",     "deploy.BAT", "cmd" },
+        { "Bash", "deploy.sh",  "bash" },
+        { "bash", "deploy.txt", "bash" },
+    }
+
+    for _, test := range tests {
+        s, err := NewFromFS(testFS, test.file, WithPartials("common/*.sh"), WithShell(test.shell))
+        if err != nil {
+            t.Errorf("%s: unexpected error: %v", test.file, err)
+            continue
+        }
+        if s.Shell != test.want {
+            t.Errorf("%s: shell = %q, want %q", test.file, s.Shell, test.want)
+        }
+    }
+}
+
+func TestNewFromFSErrors(t *testing.T) {
+    tests := []struct {
+        pattern  string
+        partials []string
+        want     string
+    }{
+        { "",           nil,                     "matches no files" },
+        { "missing.sh", nil,                     "matches no files" },
+        { "[",          nil,                     "syntax error in pattern" },
+        { "deploy.txt", nil,                     "cannot infer shell" },
+        { "broken.sh",  nil,                     "cannot parse script" },
+        { "deploy.sh",  []string{ "common/x*" }, "matches no files" },
+    }
+
+    for _, test := range tests {
+        _, err := NewFromFS(testFS, test.pattern, WithPartials(test.partials...))
+        if err == nil || !strings.Contains(err.Error(), test.want) {
+            t.Errorf("%q: error %v does not contain %q", test.pattern, err, test.want)
+        }
+    }
+
+    // partials are only for NewFromFS()
+    s := New("test", "bash", `echo`, WithPartials("common/*.sh"))
+    if s.Error == nil || !strings.Contains(s.Error.Error(), "WithPartials() can only be used with NewFromFS()") {
+        t.Errorf("error %v does not reject WithPartials()", s.Error)
+    }
+}
+
+func TestNewFromFSPartialFrontMatter(t *testing.T) {
+    // the front-matter of a partial is removed and ignored
+    fsys := fstest.MapFS{
+        "main.sh":    { Data: []byte("# ---\n# timeout: 1s\n# ---\necho {{template \"partial.sh\" .}}") },
+        "partial.sh": { Data: []byte("#!/bin/bash\n# ---\n# shell: bash\n# timeout: 5m\n# ---\n{{.Name}}") },
+    }
+
+    s, err := NewFromFS(fsys, "main.sh", WithPartials("partial.sh"))
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if s.Shell != "sh" || s.Timeout != time.Second {
+        t.Errorf("shell = %q, timeout = %s, want %q, %s", s.Shell, s.Timeout, "sh", time.Second)
+    }
+
+    got := render(t, s, map[string]string{ "Name": "app" })
+    want := "\n\n\necho app"
+    if got != want {
+        t.Errorf("rendered = %q, want %q", got, want)
+    }
+}
+
+func TestNewFromFSAutoescape(t *testing.T) {
+    // partials are escaped too
+    fsys := fstest.MapFS{
+        "main.sh":    { Data: []byte(`echo {{.Name}} {{template "partial.sh" .}}`) },
+        "partial.sh": { Data: []byte(`"{{.Name}}"`) },
+    }
+
+    s, err := NewFromFS(fsys, "main.sh", WithPartials("partial.sh"), WithAutoescape())
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    got := render(t, s, map[string]string{ "Name": `a "b"` })
+    want := `echo 'a "b"' "a \"b\""`
+    if got != want {
+        t.Errorf("rendered = %q, want %q", got, want)
+    }
+}
+
+func TestRender(t *testing.T) {
+    s := New("test", "bash", `echo {{.Name}}`)
+
+    code, err := s.Render(map[string]string{ "Name": "app" })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if code != "echo app" {
+        t.Errorf("rendered = %q, want %q", code, "echo app")
+    }
+
+    _, err = s.Render(struct{ Other string }{})
+    if err == nil || !strings.Contains(err.Error(), "can't evaluate field Name") {
+        t.Errorf("error %v is not a render error", err)
+    }
+
+    _, err = New("test", "bash", `{{.Name`).Render(nil)
+    if err == nil || !strings.Contains(err.Error(), "script failed to parse") {
+        t.Errorf("error %v is not a parse error", err)
+    }
+}
+
+//------------------------------------------------------------------------------
+